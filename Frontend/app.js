@@ -31,6 +31,27 @@ function refreshAuthUI() {
     });
 }
 
+/**
+ * Streaks and the today/week/month windows count days in the user's time zone.
+ * Until they have one, use the browser's.
+ */
+function syncTimeZone() {
+  const timeZone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+  if (!timeZone) return Promise.resolve();
+
+  return fetch("/api/me/settings", { headers: { Accept: "application/json" } })
+    .then((r) => (r.ok ? r.json() : null))
+    .then((settings) => {
+      if (!settings || settings.timeZone) return;
+      return fetch("/api/me/settings", {
+        method: "PATCH",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ timeZone }),
+      });
+    })
+    .catch((err) => console.error("Time zone sync failed:", err));
+}
+
 /**
  * Logs out by asking the backend to destroy the session.
  * After logout, redirect to login page.
@@ -53,8 +74,14 @@ function logout() {
 /**
  * Fetch leaderboard rows from the backend API.
  */
-function getLeaderboardData(scope, windowKey) {
-  const url = `/api/leaderboard?scope=${encodeURIComponent(scope)}&window=${encodeURIComponent(windowKey)}`;
+function leaderboardQuery(scope, windowKey, verifiedOnly) {
+  let query = `scope=${encodeURIComponent(scope)}&window=${encodeURIComponent(windowKey)}`;
+  if (verifiedOnly) query += "&verified=true";
+  return query;
+}
+
+function getLeaderboardData(scope, windowKey, verifiedOnly) {
+  const url = `/api/leaderboard?${leaderboardQuery(scope, windowKey, verifiedOnly)}`;
 
   return fetch(url, {
     method: "GET",
@@ -74,13 +101,17 @@ function getLeaderboardData(scope, windowKey) {
       return response.json();
     })
     .then((payload) => {
-      if (!payload || !Array.isArray(payload.rows)) return [];
-      return payload.rows;
+      if (!payload || !Array.isArray(payload.rows)) return { rows: [], viewer: null };
+      return payload;
     });
 }
 
 let currentScope = "global";
 let currentWindow = "month";
+// "quality" adds a column with reps that reached the user's calibrated depth.
+let currentRepsView = "total";
+// "verified" only counts sessions the server counted from raw sensor data.
+let currentCounted = "all";
 let closeProfileMenu = null;
 
 function openProfileWindow(username) {
@@ -226,7 +257,12 @@ function renderUserCell(row) {
   return wrap;
 }
 
-function renderLeaderboard(rows) {
+/**
+ * Render one page of the board. Rows come ranked and in order from the server;
+ * the viewer's own row is added at the end when it isn't on the page.
+ */
+function renderLeaderboard(payload) {
+  const rows = payload.rows;
   const tbody = document.getElementById("leaderboard-body");
   const updatedLabel = document.getElementById("last-updated");
 
@@ -236,10 +272,13 @@ function renderLeaderboard(rows) {
 
   tbody.innerHTML = "";
 
+  const qualityHeader = document.getElementById("quality-reps-header");
+  if (qualityHeader) qualityHeader.hidden = currentRepsView !== "quality";
+
   if (rows.length === 0) {
     const tr = document.createElement("tr");
     const td = document.createElement("td");
-    td.colSpan = 3;
+    td.colSpan = currentRepsView === "quality" ? 4 : 3;
     td.textContent = currentScope === "friends"
       ? "No friends leaderboard entries yet. Add friends in the Manage Friends window."
       : "No leaderboard entries yet.";
@@ -247,11 +286,17 @@ function renderLeaderboard(rows) {
     tbody.appendChild(tr);
   }
 
-  rows.forEach((row, index) => {
+  const viewer = payload.viewer;
+  const viewerOnPage = rows.some((row) => row.isViewer);
+  const pageRows = viewer && !viewerOnPage && rows.length > 0 ? [...rows, viewer] : rows;
+
+  pageRows.forEach((row) => {
     const tr = document.createElement("tr");
 
+    if (row.isViewer) tr.classList.add("is-viewer");
+
     const rankTd = document.createElement("td");
-    rankTd.textContent = index + 1;
+    rankTd.textContent = row.rank;
     rankTd.classList.add("rank");
 
     const userTd = document.createElement("td");
@@ -264,6 +309,12 @@ function renderLeaderboard(rows) {
     tr.appendChild(userTd);
     tr.appendChild(repsTd);
 
+    if (currentRepsView === "quality") {
+      const qualityTd = document.createElement("td");
+      qualityTd.textContent = Number(row.qualityReps || 0);
+      tr.appendChild(qualityTd);
+    }
+
     tbody.appendChild(tr);
   });
 
@@ -273,11 +324,37 @@ function renderLeaderboard(rows) {
   }
 }
 
+let leaderboardStream = null;
+
+/**
+ * Keep the table live: the server pushes fresh rows whenever a session
+ * that affects the current board is stored. EventSource reconnects on its own.
+ */
+function openLeaderboardStream() {
+  if (leaderboardStream) leaderboardStream.close();
+  leaderboardStream = null;
+  if (typeof EventSource === "undefined") return;
+
+  const query = leaderboardQuery(currentScope, currentWindow, currentCounted === "verified");
+  leaderboardStream = new EventSource(`/api/leaderboard/stream?${query}`);
+  leaderboardStream.addEventListener("leaderboard", (event) => {
+    let payload;
+    try {
+      payload = JSON.parse(event.data);
+    } catch (err) {
+      console.error("Bad leaderboard update:", err);
+      return;
+    }
+    if (!payload || !Array.isArray(payload.rows)) return;
+    renderLeaderboard(payload);
+  });
+}
+
 function refreshLeaderboard() {
-  getLeaderboardData(currentScope, currentWindow)
-    .then((data) => {
-      const sorted = [...data].sort((a, b) => b.totalReps - a.totalReps);
-      renderLeaderboard(sorted);
+  getLeaderboardData(currentScope, currentWindow, currentCounted === "verified")
+    .then((payload) => {
+      renderLeaderboard(payload);
+      openLeaderboardStream();
     })
     .catch((err) => {
       console.error("Failed to load leaderboard:", err);
@@ -342,6 +419,8 @@ function onFriendListUpdatedFromPopup(event) {
 document.addEventListener("DOMContentLoaded", () => {
   const scopeSelect = document.getElementById("scope-select");
   const windowSelect = document.getElementById("window-select");
+  const repsViewSelect = document.getElementById("reps-view-select");
+  const countedSelect = document.getElementById("counted-select");
   const logoutBtn = document.getElementById("logout-btn");
   const manageFriendsBtn = document.getElementById("manage-friends-btn");
 
@@ -361,6 +440,22 @@ document.addEventListener("DOMContentLoaded", () => {
     });
   }
 
+  if (repsViewSelect) {
+    repsViewSelect.value = currentRepsView;
+    repsViewSelect.addEventListener("change", () => {
+      currentRepsView = repsViewSelect.value;
+      refreshLeaderboard();
+    });
+  }
+
+  if (countedSelect) {
+    countedSelect.value = currentCounted;
+    countedSelect.addEventListener("change", () => {
+      currentCounted = countedSelect.value;
+      refreshLeaderboard();
+    });
+  }
+
   if (logoutBtn) {
     logoutBtn.addEventListener("click", logout);
   }
@@ -372,6 +467,6 @@ document.addEventListener("DOMContentLoaded", () => {
   window.addEventListener("message", onFriendListUpdatedFromPopup);
 
   refreshAuthUI().then((ok) => {
-    if (ok) refreshLeaderboard();
+    if (ok) syncTimeZone().then(refreshLeaderboard);
   });
 });
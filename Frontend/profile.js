@@ -76,7 +76,12 @@ function renderProfile(profile) {
   document.getElementById("profile-username").textContent = profile.username;
   document.getElementById("profile-created-at").textContent = formatDate(profile.createdAt);
   document.getElementById("profile-total-reps").textContent = String(profile.totalReps || 0);
+  document.getElementById("profile-quality-reps").textContent = String(profile.qualityReps || 0);
+  document.getElementById("profile-form-score").textContent = profile.formScore == null
+    ? "—"
+    : `${Math.round(profile.formScore * 100)} / 100`;
   document.getElementById("profile-streak").textContent = `${profile.streakDays || 0} day(s)`;
+  document.getElementById("profile-longest-streak").textContent = `${profile.longestStreakDays || 0} day(s)`;
   document.getElementById("profile-friends-count").textContent = String(profile.friendsCount || 0);
   document.getElementById("profile-founder").textContent = profile.isFounder ? "Founder" : "No";
 
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Admin commands run instead of the server when the binary gets arguments:
+//
+//	go run . rebuild-stats [-user name] [-batch 500]
+//
+// rebuild-stats recounts user_daily_reps and user_stats from rep_sessions, for
+// everyone or one user, a batch of users per transaction.
+
+const defaultStatsRebuildBatch = 500
+
+// adminCommand is a parsed command line.
+type adminCommand struct {
+	Name     string
+	Username string
+	Batch    int
+}
+
+func parseAdminCommand(args []string) (adminCommand, error) {
+	if len(args) == 0 {
+		return adminCommand{}, errors.New("no command given (commands: rebuild-stats)")
+	}
+
+	cmd := adminCommand{Name: args[0]}
+	switch cmd.Name {
+	case "rebuild-stats":
+		fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.StringVar(&cmd.Username, "user", "", "only rebuild this user's stats")
+		fs.IntVar(&cmd.Batch, "batch", defaultStatsRebuildBatch, "users per transaction")
+		if err := fs.Parse(args[1:]); err != nil {
+			return adminCommand{}, fmt.Errorf("%s: %w", cmd.Name, err)
+		}
+		if fs.NArg() > 0 {
+			return adminCommand{}, fmt.Errorf("%s: unexpected argument %q", cmd.Name, fs.Arg(0))
+		}
+		if cmd.Batch < 1 {
+			return adminCommand{}, fmt.Errorf("%s: -batch must be at least 1", cmd.Name)
+		}
+		return cmd, nil
+	}
+
+	return adminCommand{}, fmt.Errorf("unknown command %q (commands: rebuild-stats)", cmd.Name)
+}
+
+// runAdminCommand parses and runs an admin command against the database.
+func runAdminCommand(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	cmd, err := parseAdminCommand(args)
+	if err != nil {
+		return err
+	}
+
+	// Only rebuild-stats exists so far.
+	if cmd.Username != "" {
+		var userID int64
+		err := pool.QueryRow(ctx, `SELECT id FROM users WHERE username = $1;`, cmd.Username).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("no user named %q", cmd.Username)
+		}
+		if err != nil {
+			return err
+		}
+		if err := rebuildUserStatsBatch(ctx, pool, []int64{userID}); err != nil {
+			return err
+		}
+		log.Printf("rebuilt stats for %s", cmd.Username)
+		return nil
+	}
+
+	n, err := rebuildAllUserStats(ctx, pool, cmd.Batch)
+	if err != nil {
+		return err
+	}
+	log.Printf("rebuilt stats for %d users", n)
+	return nil
+}
+
+// rebuildAllUserStats walks every user in id order, batch at a time, and returns how
+// many it rebuilt. Sessions stored while it runs are counted either by the rebuild
+// or by their own transaction, whichever comes second.
+func rebuildAllUserStats(ctx context.Context, pool *pgxpool.Pool, batch int) (int, error) {
+	const q = `
+		SELECT id
+		FROM users
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2;
+	`
+
+	var after int64
+	done := 0
+	for {
+		rows, err := pool.Query(ctx, q, after, batch)
+		if err != nil {
+			return done, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return done, err
+		}
+		if len(ids) == 0 {
+			return done, nil
+		}
+
+		if err := rebuildUserStatsBatch(ctx, pool, ids); err != nil {
+			return done, err
+		}
+		done += len(ids)
+		after = ids[len(ids)-1]
+		log.Printf("rebuild-stats: %d users done", done)
+	}
+}
+
+func rebuildUserStatsBatch(ctx context.Context, pool *pgxpool.Pool, userIDs []int64) error {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := rebuildUserStats(ctx, tx, userIDs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
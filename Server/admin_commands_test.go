@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseAdminCommand(t *testing.T) {
+	cmd, err := parseAdminCommand([]string{"rebuild-stats"})
+	if err != nil || cmd.Name != "rebuild-stats" || cmd.Username != "" || cmd.Batch != defaultStatsRebuildBatch {
+		t.Fatalf("%+v, %v", cmd, err)
+	}
+
+	cmd, err = parseAdminCommand([]string{"rebuild-stats", "-user", "sam", "-batch", "50"})
+	if err != nil || cmd.Username != "sam" || cmd.Batch != 50 {
+		t.Fatalf("%+v, %v", cmd, err)
+	}
+
+	for _, args := range [][]string{
+		nil,
+		{"drop-tables"},
+		{"rebuild-stats", "-batch", "0"},
+		{"rebuild-stats", "-verbose"},
+		{"rebuild-stats", "sam"},
+	} {
+		if _, err := parseAdminCommand(args); err == nil {
+			t.Fatalf("%q accepted", args)
+		}
+	}
+}
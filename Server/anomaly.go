@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Anomaly reason codes stored in rep_sessions.anomaly_reasons.
+const (
+	AnomalyRepRate     = "rep_rate"        // more reps per minute than the session's duration allows
+	AnomalyDailyVolume = "daily_volume"    // far above the user's usual day
+	AnomalyBurst       = "burst"           // many submissions in a few minutes
+	AnomalyUnbacked    = "unbacked"        // a large count with no sensor data behind it
+	AnomalyDeviceCount = "device_mismatch" // the device claimed a very different count than the server found
+)
+
+const (
+	anomalyFlagScore   = 1.0
+	anomalyHistoryDays = 30
+	// anomalyBurstWindow is measured on created_at, when the server received each
+	// session, because started_at is whatever the client says.
+	anomalyBurstWindow = 10 * time.Minute
+	anomalyMinHistory  = 3
+)
+
+// anomalyParams are the thresholds. Each triggered check adds its weight to the
+// session's score; a score of anomalyFlagScore or more flags the session.
+type anomalyParams struct {
+	// MaxRepsPerMinute is faster than anyone sustains real pushups.
+	MaxRepsPerMinute float64
+	// DailyVolumeFactor times the user's median active day, but at least DailyVolumeFloor,
+	// is the most a day may hold before it looks unusual.
+	DailyVolumeFactor float64
+	DailyVolumeFloor  int
+	// NewUserDailyLimit applies until the user has anomalyMinHistory active days.
+	NewUserDailyLimit int
+	// MaxBurstSessions is how many sessions may be submitted within anomalyBurstWindow.
+	MaxBurstSessions int
+	// UnbackedReps is the size above which a count without raw data or per-rep events is suspicious.
+	UnbackedReps int
+	// DeviceMismatchRatio is how far a device's claimed count may drift from the server's.
+	DeviceMismatchRatio float64
+}
+
+func defaultAnomalyParams() anomalyParams {
+	return anomalyParams{
+		MaxRepsPerMinute:    70,
+		DailyVolumeFactor:   5,
+		DailyVolumeFloor:    300,
+		NewUserDailyLimit:   1000,
+		MaxBurstSessions:    6,
+		UnbackedReps:        150,
+		DeviceMismatchRatio: 0.25,
+	}
+}
+
+var anomalyWeights = map[string]float64{
+	AnomalyRepRate:     1.0,
+	AnomalyDailyVolume: 0.6,
+	AnomalyBurst:       0.6,
+	AnomalyUnbacked:    0.5,
+	AnomalyDeviceCount: 0.5,
+}
+
+// anomalyInput is a new session plus what we know about the user's recent history.
+type anomalyInput struct {
+	Reps       int
+	Duration   time.Duration // zero when the session has no end time; devices always send one
+	Source     string
+	RepEvents  int
+	DeviceReps *int
+
+	// TodayReps is what the user already logged on the session's day in their time zone,
+	// excluding this session.
+	TodayReps int
+	// DailyTotals are the user's totals on earlier active days within anomalyHistoryDays.
+	DailyTotals []int
+	// RecentSessions counts the user's sessions received within anomalyBurstWindow before this one, including it.
+	RecentSessions int
+}
+
+type anomalyReport struct {
+	Score   float64
+	Reasons []string
+	Flagged bool
+}
+
+// scoreAnomaly runs every check on one session.
+func scoreAnomaly(in anomalyInput, p anomalyParams) anomalyReport {
+	reasons := make([]string, 0)
+
+	if in.Duration > 0 {
+		perMinute := float64(in.Reps) / in.Duration.Minutes()
+		// Very short sessions make the rate noisy; only judge from 10 reps up.
+		if in.Reps >= 10 && perMinute > p.MaxRepsPerMinute {
+			reasons = append(reasons, AnomalyRepRate)
+		}
+	}
+
+	day := in.TodayReps + in.Reps
+	if len(in.DailyTotals) < anomalyMinHistory {
+		if day > p.NewUserDailyLimit {
+			reasons = append(reasons, AnomalyDailyVolume)
+		}
+	} else {
+		limit := math.Max(float64(p.DailyVolumeFloor), p.DailyVolumeFactor*medianInt(in.DailyTotals))
+		if float64(day) > limit {
+			reasons = append(reasons, AnomalyDailyVolume)
+		}
+	}
+
+	if in.RecentSessions > p.MaxBurstSessions {
+		reasons = append(reasons, AnomalyBurst)
+	}
+
+	backed := in.Source == SourceServerDetected || in.RepEvents > 0
+	if !backed && in.Reps > p.UnbackedReps {
+		reasons = append(reasons, AnomalyUnbacked)
+	}
+
+	if in.DeviceReps != nil && in.Reps > 0 {
+		drift := math.Abs(float64(*in.DeviceReps-in.Reps)) / float64(in.Reps)
+		if drift > p.DeviceMismatchRatio {
+			reasons = append(reasons, AnomalyDeviceCount)
+		}
+	}
+
+	report := anomalyReport{Reasons: reasons}
+	for _, r := range reasons {
+		report.Score += anomalyWeights[r]
+	}
+	report.Flagged = report.Score >= anomalyFlagScore
+	return report
+}
+
+func medianInt(values []int) float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return float64(sorted[n/2])
+	}
+	return float64(sorted[n/2-1]+sorted[n/2]) / 2
+}
+
+// rescoredReviewStatus is a session's review status after it has been scored again.
+// Scoring only ever raises it: a flagged session waits for an admin whatever its new
+// score, an approved one goes back to review only if it flags again, and a rejected
+// one stays rejected.
+func rescoredReviewStatus(current string, flagged bool) string {
+	switch current {
+	case "flagged", "rejected":
+		return current
+	case "approved":
+		if flagged {
+			return "flagged"
+		}
+		return current
+	}
+	if flagged {
+		return "flagged"
+	}
+	return "ok"
+}
+
+// checkSessionAnomalies scores a session that was just inserted or edited and records
+// the result. Rejected sessions don't count towards the user's history.
+func checkSessionAnomalies(ctx context.Context, db dbQuerier, userID, sessionID int64, req repRequest) (anomalyReport, error) {
+	const historyQ = `
+		WITH this AS (
+			SELECT
+				rs.started_at,
+				rs.created_at,
+				rs.review_status,
+				(rs.started_at AT TIME ZONE COALESCE(u.time_zone, 'UTC'))::date AS day,
+				COALESCE(u.time_zone, 'UTC') AS tz
+			FROM rep_sessions rs
+			JOIN users u ON u.id = rs.user_id
+			WHERE rs.id = $2
+		),
+		days AS (
+			SELECT
+				(rs.started_at AT TIME ZONE this.tz)::date AS day,
+				SUM(rs.reps)::int AS reps
+			FROM rep_sessions rs, this
+			WHERE rs.user_id = $1
+			  AND rs.id <> $2
+			  AND rs.review_status <> 'rejected'
+			  AND rs.started_at >= this.started_at - make_interval(days => $3)
+			GROUP BY 1
+		)
+		SELECT
+			COALESCE((SELECT d.reps FROM days d, this WHERE d.day = this.day), 0),
+			COALESCE((
+				SELECT array_agg(d.reps ORDER BY d.day)
+				FROM days d, this
+				WHERE d.day < this.day
+			), '{}'),
+			(
+				SELECT COUNT(*)::int
+				FROM rep_sessions rs, this
+				WHERE rs.user_id = $1
+				  AND rs.review_status <> 'rejected'
+				  AND rs.created_at > this.created_at - make_interval(secs => $4)
+				  AND rs.created_at <= this.created_at
+			),
+			(SELECT review_status FROM this);
+	`
+
+	in := anomalyInput{
+		Reps:       req.Reps,
+		Source:     req.Source,
+		RepEvents:  len(req.RepEvents),
+		DeviceReps: req.DeviceReps,
+	}
+	if req.StartedAt != nil && req.EndedAt != nil {
+		in.Duration = req.EndedAt.Sub(*req.StartedAt)
+	}
+
+	var current string
+	err := db.QueryRow(ctx, historyQ, userID, sessionID, anomalyHistoryDays, anomalyBurstWindow.Seconds()).
+		Scan(&in.TodayReps, &in.DailyTotals, &in.RecentSessions, &current)
+	if err != nil {
+		return anomalyReport{}, err
+	}
+
+	report := scoreAnomaly(in, defaultAnomalyParams())
+
+	status := rescoredReviewStatus(current, report.Flagged)
+
+	const updateQ = `
+		UPDATE rep_sessions
+		SET anomaly_score = $2, anomaly_reasons = $3, review_status = $4
+		WHERE id = $1;
+	`
+	if _, err := db.Exec(ctx, updateQ, sessionID, report.Score, report.Reasons, status); err != nil {
+		return anomalyReport{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScoreAnomaly(t *testing.T) {
+	p := defaultAnomalyParams()
+	history := []int{40, 60, 50, 55}
+	intp := func(n int) *int { return &n }
+
+	cases := []struct {
+		name    string
+		in      anomalyInput
+		reasons []string
+		flagged bool
+	}{
+		{
+			name:    "ordinary session",
+			in:      anomalyInput{Reps: 50, Duration: 2 * time.Minute, Source: SourceDevice, RepEvents: 50, DailyTotals: history, RecentSessions: 1},
+			reasons: []string{},
+		},
+		{
+			name:    "impossible rate",
+			in:      anomalyInput{Reps: 100, Duration: time.Minute, Source: SourceDevice, RepEvents: 100, DailyTotals: []int{200, 200, 200}, RecentSessions: 1},
+			reasons: []string{AnomalyRepRate},
+			flagged: true,
+		},
+		{
+			name:    "short session not judged on rate",
+			in:      anomalyInput{Reps: 5, Duration: 2 * time.Second, Source: SourceManual, DailyTotals: history, RecentSessions: 1},
+			reasons: []string{},
+		},
+		{
+			name:    "daily volume alone is not enough",
+			in:      anomalyInput{Reps: 100, TodayReps: 250, Source: SourceDevice, RepEvents: 100, DailyTotals: history, RecentSessions: 1},
+			reasons: []string{AnomalyDailyVolume},
+		},
+		{
+			name:    "new user under the limit",
+			in:      anomalyInput{Reps: 120, TodayReps: 500, Source: SourceManual, DailyTotals: []int{10}, RecentSessions: 1},
+			reasons: []string{},
+		},
+		{
+			name:    "unbacked volume and burst",
+			in:      anomalyInput{Reps: 400, Source: SourceManual, DailyTotals: history, RecentSessions: 8},
+			reasons: []string{AnomalyDailyVolume, AnomalyBurst, AnomalyUnbacked},
+			flagged: true,
+		},
+		{
+			name:    "server-detected counts as backed",
+			in:      anomalyInput{Reps: 200, Source: SourceServerDetected, DailyTotals: []int{100, 150, 200}, RecentSessions: 1},
+			reasons: []string{},
+		},
+		{
+			name:    "device disagrees with server",
+			in:      anomalyInput{Reps: 20, Source: SourceServerDetected, DeviceReps: intp(40), DailyTotals: history, RecentSessions: 1},
+			reasons: []string{AnomalyDeviceCount},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := scoreAnomaly(tc.in, p)
+			if !reflect.DeepEqual(got.Reasons, tc.reasons) {
+				t.Fatalf("reasons = %v; want %v", got.Reasons, tc.reasons)
+			}
+			if got.Flagged != tc.flagged {
+				t.Fatalf("flagged = %v (score %.2f); want %v", got.Flagged, got.Score, tc.flagged)
+			}
+		})
+	}
+}
+
+func TestRescoredReviewStatus(t *testing.T) {
+	cases := []struct {
+		current string
+		flagged bool
+		want    string
+	}{
+		{"ok", false, "ok"},
+		{"ok", true, "flagged"},
+		// A flagged session waits for an admin even if an edit makes it look ordinary.
+		{"flagged", false, "flagged"},
+		{"flagged", true, "flagged"},
+		// An approved session goes back to review only if the edit flags it.
+		{"approved", false, "approved"},
+		{"approved", true, "flagged"},
+		{"rejected", false, "rejected"},
+		{"rejected", true, "rejected"},
+	}
+
+	for _, tc := range cases {
+		if got := rescoredReviewStatus(tc.current, tc.flagged); got != tc.want {
+			t.Errorf("rescoredReviewStatus(%q, %v) = %q; want %q", tc.current, tc.flagged, got, tc.want)
+		}
+	}
+}
+
+func TestMedianInt(t *testing.T) {
+	if got := medianInt([]int{5, 1, 3}); got != 3 {
+		t.Fatalf("odd median = %v", got)
+	}
+	if got := medianInt([]int{4, 1, 3, 2}); got != 2.5 {
+		t.Fatalf("even median = %v", got)
+	}
+}
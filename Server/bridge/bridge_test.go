@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"PUSH-UP-ANALYZER/processing/prepare"
+)
+
+// serialLog is what the firmware prints for one set, preceded by the boot banner and a
+// stop sent while idle, which must not produce a session.
+const serialLog = `Pressle sensor logger
+Type: start / stop
+EVENT,1000,STOP_CMD_IDLE,IDLE
+STOPPED
+EVENT,167862,START_CMD,ARMING
+EVENT,167862,ARMING_START,ARMING
+EVENT,171976,BASELINE_LOCKED_MM,427.08,ARMING
+EVENT,171976,COUNTDOWN_START,COUNTDOWN
+EVENT,176977,RECORDING_START,RECORDING
+timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz
+RECORDING
+177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831
+177276,414.00,-0.1514,0.1682,-0.9453,0.1221,-2.2583,-2.1362
+177376,415.0
+177476,417.00,-0.1211,0.1063,-0.9360,-0.0610,-6.4697,-2.6245
+EVENT,177500,STOP_CMD,RECORDING
+EVENT,177500,END_HOLD_START,END_HOLD
+EVENT,179600,SESSION_STOPPED_CLEAN_SPAN_MM,12.50,END_HOLD
+STOPPED
+`
+
+func recordLog(t *testing.T) []Session {
+	t.Helper()
+
+	clock := time.Date(2026, 2, 13, 22, 52, 49, 0, time.Local)
+	rec := &Recorder{Now: func() time.Time {
+		clock = clock.Add(100 * time.Millisecond)
+		return clock
+	}}
+
+	var sessions []Session
+	err := rec.Run(strings.NewReader(serialLog), func(s Session) error {
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessions
+}
+
+func TestRecorderRun(t *testing.T) {
+	sessions := recordLog(t)
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions; want 1", len(sessions))
+	}
+
+	s := sessions[0]
+	// The truncated row "177376,415.0" isn't a sample.
+	if len(s.Samples) != 3 || len(s.Events) != 8 {
+		t.Fatalf("got %d samples and %d events; want 3 and 8", len(s.Samples), len(s.Events))
+	}
+	if s.Events[0].Name != "START_CMD" || s.Events[2].Value != 427.08 {
+		t.Fatalf("events = %+v", s.Events[:3])
+	}
+	if !s.Samples[1].HostTime.After(s.Samples[0].HostTime) {
+		t.Fatal("host times not stamped")
+	}
+}
+
+func TestWriteSessionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	// An existing session3.csv means the next one is session4.
+	if err := os.WriteFile(filepath.Join(dir, "session3.csv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordLog(t)[0]
+	path, err := WriteSession(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "session4.csv" {
+		t.Fatalf("wrote %s; want session4.csv", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	samples, err := prepare.ReadSessionCSV(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 || samples[0].DeviceS != 177.177 || samples[2].TofMM != 417 || samples[0].GZ != -0.1831 {
+		t.Fatalf("samples = %+v", samples)
+	}
+	if !samples[0].HostTime.Equal(s.Samples[0].HostTime) {
+		t.Fatalf("host time %v; want %v", samples[0].HostTime, s.Samples[0].HostTime)
+	}
+
+	ef, err := os.Open(filepath.Join(dir, "session4.events.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	events, err := prepare.ReadEventsCSV(ef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 8 || events[2].Name != "BASELINE_LOCKED_MM" || events[2].Value != 427.08 || events[7].State != "END_HOLD" {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestWriteSamplesCSVFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSamplesCSV(&buf, recordLog(t)[0].Samples[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want := "host_ts,device_ts_s,tof_mm,ax,ay,az,gx,gy,gz\n" +
+		"2026-02-13T22:52:49.700000,177.177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s := recordLog(t)[0]
+
+	var got uploadBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/sessions/raw" || r.Header.Get("X-Device-Token") != "tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "sessionId": 9, "reps": 1, "samples": len(got.Samples)})
+	}))
+	defer srv.Close()
+
+	u := Uploader{ServerURL: srv.URL + "/", Token: "tok", Scope: "friends"}
+	res, err := u.Upload(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SessionID != 9 || res.Samples != 3 || res.Replayed {
+		t.Fatalf("result = %+v", res)
+	}
+	if got.ClientSessionID != ClientSessionID(s) || got.Scope != "friends" || !got.StartedAt.Equal(s.Samples[0].HostTime) {
+		t.Fatalf("body = %+v", got)
+	}
+	if got.Events[0].Value != nil || got.Events[2].Value == nil || *got.Events[2].Value != 427.08 {
+		t.Fatalf("event values = %v, %v", got.Events[0].Value, got.Events[2].Value)
+	}
+
+	u.Token = "wrong"
+	if _, err := u.Upload(context.Background(), s); err == nil {
+		t.Fatal("upload with a bad token succeeded")
+	}
+}
@@ -0,0 +1,143 @@
+package bridge
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+var samplesHeader = []string{"host_ts", "device_ts_s", "tof_mm", "ax", "ay", "az", "gx", "gy", "gz"}
+
+var sessionFileRe = regexp.MustCompile(`^session(\d+)\.csv$`)
+
+var ErrNoSamples = errors.New("session has no samples")
+
+// WriteSession writes s to dir as sessionN.csv and sessionN.events.csv, where N is one
+// past the highest session number already there. It returns the path of the samples file.
+func WriteSession(dir string, s Session) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", ErrNoSamples
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	n, err := nextSessionNumber(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		samplesPath := filepath.Join(dir, fmt.Sprintf("session%d.csv", n))
+		// O_EXCL so two bridges writing to the same directory can't clobber each other.
+		f, err := os.OpenFile(samplesPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			n++
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if err := writeAndClose(f, func(w io.Writer) error { return WriteSamplesCSV(w, s.Samples) }); err != nil {
+			return "", err
+		}
+
+		eventsPath := filepath.Join(dir, fmt.Sprintf("session%d.events.csv", n))
+		ef, err := os.Create(eventsPath)
+		if err != nil {
+			return "", err
+		}
+		if err := writeAndClose(ef, func(w io.Writer) error { return WriteEventsCSV(w, s.Events) }); err != nil {
+			return "", err
+		}
+		return samplesPath, nil
+	}
+}
+
+func writeAndClose(f *os.File, write func(io.Writer) error) error {
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func nextSessionNumber(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	next := 1
+	for _, e := range entries {
+		m := sessionFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return next, nil
+}
+
+// WriteSamplesCSV writes samples in the sessionN.csv format.
+func WriteSamplesCSV(w io.Writer, samples []firmware.Sample) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(samplesHeader); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		err := cw.Write([]string{
+			s.HostTime.Format(firmware.HostTimeLayout),
+			strconv.FormatFloat(float64(s.DeviceMS)/1000, 'f', 3, 64),
+			strconv.FormatFloat(s.TofMM, 'f', 2, 64),
+			strconv.FormatFloat(s.AX, 'f', 4, 64),
+			strconv.FormatFloat(s.AY, 'f', 4, 64),
+			strconv.FormatFloat(s.AZ, 'f', 4, 64),
+			strconv.FormatFloat(s.GX, 'f', 4, 64),
+			strconv.FormatFloat(s.GY, 'f', 4, 64),
+			strconv.FormatFloat(s.GZ, 'f', 4, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEventsCSV writes events in the sessionN.events.csv format. Events without a value
+// leave the column empty.
+func WriteEventsCSV(w io.Writer, events []firmware.Event) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(firmware.EventsHeader); err != nil {
+		return err
+	}
+	for _, ev := range events {
+		value := ""
+		if ev.HasValue() {
+			value = strconv.FormatFloat(ev.Value, 'f', 2, 64)
+		}
+		err := cw.Write([]string{
+			ev.HostTime.Format(firmware.HostTimeLayout),
+			strconv.FormatInt(ev.DeviceMS, 10),
+			string(ev.Name),
+			value,
+			string(ev.State),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
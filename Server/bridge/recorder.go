@@ -0,0 +1,117 @@
+// Package bridge records sets from the Pressle sensor's serial output, writes them in the
+// data/ format and optionally uploads them. It is the Go replacement for tools/plot_live.py;
+// cmd/pressle-bridge wires it to a real serial port.
+package bridge
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// Session is one set as the device reported it, from its first event to STOPPED.
+type Session struct {
+	// ID overrides the clientSessionId derived from the first sample when uploading.
+	ID      string
+	Samples []firmware.Sample
+	Events  []firmware.Event
+}
+
+// Recorder turns serial output into sessions. It is driven one line at a time, so anything
+// that yields lines works: a serial port, a log file or a strings.Reader in tests.
+type Recorder struct {
+	// Now stamps HostTime on events and samples; time.Now when nil.
+	Now func() time.Time
+	// OnLine, when set, is called for every line that parsed, before it is recorded.
+	OnLine func(firmware.Line)
+	// Malformed counts EVENT and sample lines that didn't parse. They are skipped:
+	// the first line after opening the port is often cut in half.
+	Malformed int
+
+	current   *Session
+	recording bool
+}
+
+// Feed records one line of serial output. It returns the session the line finished,
+// or nil if none did. Sessions without samples, like a stop sent while idle, are dropped.
+func (r *Recorder) Feed(raw string) *Session {
+	line, err := firmware.ParseLine(raw)
+	if err != nil {
+		r.Malformed++
+		return nil
+	}
+	if r.OnLine != nil {
+		r.OnLine(line)
+	}
+
+	switch line.Kind {
+	case firmware.LineEvent:
+		ev := line.Event
+		ev.HostTime = r.now()
+		if r.current == nil {
+			r.current = &Session{}
+		}
+		r.current.Events = append(r.current.Events, ev)
+
+	case firmware.LineRecording:
+		if r.current == nil {
+			r.current = &Session{}
+		}
+		r.recording = true
+
+	case firmware.LineSample:
+		// Samples outside RECORDING aren't part of a set; the firmware never sends them.
+		if r.current == nil || !r.recording {
+			return nil
+		}
+		s := line.Sample
+		s.HostTime = r.now()
+		r.current.Samples = append(r.current.Samples, s)
+
+	case firmware.LineStopped:
+		done := r.current
+		r.current, r.recording = nil, false
+		if done == nil || len(done.Samples) == 0 {
+			return nil
+		}
+		return done
+	}
+	return nil
+}
+
+// Run reads lines from src until it ends, passing each finished session to done.
+// It stops early if done returns an error. An unfinished session at the end is discarded.
+func (r *Recorder) Run(src io.Reader, done func(Session) error) error {
+	sc := bufio.NewScanner(src)
+	for sc.Scan() {
+		if s := r.Feed(sc.Text()); s != nil {
+			if err := done(*s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read serial: %w", err)
+	}
+	return nil
+}
+
+// Recording reports whether a set is being recorded right now.
+func (r *Recorder) Recording() bool { return r.recording }
+
+func (r *Recorder) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// SendCommand writes a firmware command such as firmware.CommandStart, newline-terminated.
+func SendCommand(w io.Writer, cmd string) error {
+	_, err := io.WriteString(w, cmd+"\n")
+	return err
+}
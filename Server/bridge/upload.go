@@ -0,0 +1,139 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Uploader sends finished sessions to POST /api/sessions/raw as a device.
+type Uploader struct {
+	// ServerURL is the server's base URL, e.g. http://localhost:8080.
+	ServerURL string
+	// Token is a device token from /api/me/devices.
+	Token string
+	// Scope is the session's visibility; empty leaves it to the server's default.
+	Scope  string
+	Client *http.Client
+}
+
+// UploadResult is the server's reply to a raw upload.
+type UploadResult struct {
+	SessionID int64 `json:"sessionId"`
+	Reps      int   `json:"reps"`
+	Samples   int   `json:"samples"`
+	// Replayed is true when the server already had this session and stored nothing new.
+	Replayed bool `json:"-"`
+}
+
+type uploadSample struct {
+	DeviceMS int64   `json:"timestamp_ms"`
+	TofMM    float64 `json:"tof_mm"`
+	AX       float64 `json:"ax"`
+	AY       float64 `json:"ay"`
+	AZ       float64 `json:"az"`
+	GX       float64 `json:"gx"`
+	GY       float64 `json:"gy"`
+	GZ       float64 `json:"gz"`
+}
+
+type uploadEvent struct {
+	DeviceMS int64    `json:"timestamp_ms"`
+	Name     string   `json:"event"`
+	Value    *float64 `json:"value"`
+	State    string   `json:"state"`
+}
+
+type uploadBody struct {
+	Scope           string         `json:"scope,omitempty"`
+	ClientSessionID string         `json:"clientSessionId"`
+	StartedAt       time.Time      `json:"startedAt"`
+	Samples         []uploadSample `json:"samples"`
+	Events          []uploadEvent  `json:"events"`
+}
+
+// UploadError is a response from the server other than 200 or 201.
+type UploadError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("upload: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ClientSessionID identifies a session across retries: s.ID when set, otherwise the host
+// time and device clock of its first sample, which don't change when the same recording
+// is uploaded again.
+func ClientSessionID(s Session) string {
+	if s.ID != "" {
+		return s.ID
+	}
+	first := s.Samples[0]
+	return fmt.Sprintf("bridge-%d-%d", first.HostTime.Unix(), first.DeviceMS)
+}
+
+// Upload sends s. Retrying a failed upload is safe; the server deduplicates by ClientSessionID.
+func (u Uploader) Upload(ctx context.Context, s Session) (UploadResult, error) {
+	if len(s.Samples) == 0 {
+		return UploadResult{}, ErrNoSamples
+	}
+
+	body := uploadBody{
+		Scope:           u.Scope,
+		ClientSessionID: ClientSessionID(s),
+		StartedAt:       s.Samples[0].HostTime.UTC(),
+		Samples:         make([]uploadSample, len(s.Samples)),
+		Events:          make([]uploadEvent, len(s.Events)),
+	}
+	for i, smp := range s.Samples {
+		body.Samples[i] = uploadSample{smp.DeviceMS, smp.TofMM, smp.AX, smp.AY, smp.AZ, smp.GX, smp.GY, smp.GZ}
+	}
+	for i, ev := range s.Events {
+		body.Events[i] = uploadEvent{DeviceMS: ev.DeviceMS, Name: string(ev.Name), State: string(ev.State)}
+		if ev.HasValue() {
+			v := ev.Value
+			body.Events[i].Value = &v
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	url := strings.TrimRight(u.ServerURL, "/") + "/api/sessions/raw"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return UploadResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Token", u.Token)
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return UploadResult{}, &UploadError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	var res UploadResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return UploadResult{}, fmt.Errorf("upload: invalid response: %w", err)
+	}
+	res.Replayed = resp.Header.Get("Idempotent-Replayed") == "true"
+	return res, nil
+}
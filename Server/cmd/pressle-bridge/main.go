@@ -0,0 +1,148 @@
+// Command pressle-bridge talks to the Pressle sensor over serial. It sends start/stop,
+// saves every finished set as sessionN.csv and sessionN.events.csv and, when a server
+// and device token are given, uploads it.
+//
+//	go run ./cmd/pressle-bridge -port /dev/cu.usbmodem1101 -out ../data
+//
+// Type start, stop or quit on stdin while it runs.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+
+	"PUSH-UP-ANALYZER/bridge"
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+func main() {
+	port := flag.String("port", "", "serial port of the sensor, e.g. /dev/cu.usbmodem1101")
+	baud := flag.Int("baud", 115200, "serial baud rate")
+	out := flag.String("out", "../data", "directory for sessionN.csv files")
+	server := flag.String("server", "", "server base URL to upload sessions to, e.g. http://localhost:8080")
+	scope := flag.String("scope", "", "visibility of uploaded sessions: public, friends or private")
+	start := flag.Bool("start", false, "send start as soon as the port is open")
+	once := flag.Bool("once", false, "exit after the first finished session")
+	verbose := flag.Bool("v", false, "echo every line from the device")
+	flag.Parse()
+
+	if *port == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var uploader *bridge.Uploader
+	if *server != "" {
+		token := os.Getenv("PRESSLE_DEVICE_TOKEN")
+		if token == "" {
+			log.Fatal("PRESSLE_DEVICE_TOKEN is not set; it is needed to upload to -server")
+		}
+		uploader = &bridge.Uploader{
+			ServerURL: *server,
+			Token:     token,
+			Scope:     *scope,
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+
+	sp, err := serial.Open(*port, &serial.Mode{BaudRate: *baud})
+	if err != nil {
+		log.Fatalf("open %s: %v", *port, err)
+	}
+	defer sp.Close()
+	_ = sp.ResetInputBuffer()
+
+	// Commands come from stdin while the recorder reads; serialize writes to the port.
+	var writeMu sync.Mutex
+	send := func(cmd string) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := bridge.SendCommand(sp, cmd); err != nil {
+			log.Printf("send %s: %v", cmd, err)
+			return
+		}
+		log.Printf("sent: %s", cmd)
+	}
+
+	if *start {
+		send(firmware.CommandStart)
+	}
+	go readCommands(send)
+
+	// The bridge may connect mid-set, so violations are warnings, not errors.
+	validator := firmware.NewValidator()
+	rec := &bridge.Recorder{OnLine: func(line firmware.Line) {
+		for _, v := range validator.Check(line) {
+			log.Printf("protocol: %s", v)
+		}
+		switch {
+		case line.Kind == firmware.LineEvent:
+			ev := line.Event
+			if ev.HasValue() {
+				log.Printf("%s %.2f (%s)", ev.Name, ev.Value, ev.State)
+			} else {
+				log.Printf("%s (%s)", ev.Name, ev.State)
+			}
+		case *verbose:
+			log.Print(line.Text)
+		}
+	}}
+
+	errDone := errors.New("done")
+	err = rec.Run(sp, func(s bridge.Session) error {
+		path, err := bridge.WriteSession(*out, s)
+		if err != nil {
+			return err
+		}
+		log.Printf("saved %d samples to %s", len(s.Samples), path)
+
+		if uploader != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			res, err := uploader.Upload(ctx, s)
+			cancel()
+			if err != nil {
+				// The files are already on disk; a failed upload shouldn't stop recording.
+				log.Printf("upload failed: %v", err)
+			} else {
+				log.Printf("uploaded session %d: %d reps", res.SessionID, res.Reps)
+			}
+		}
+
+		if *once {
+			return errDone
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDone) {
+		log.Fatal(err)
+	}
+	if rec.Malformed > 0 {
+		log.Printf("skipped %d malformed lines", rec.Malformed)
+	}
+}
+
+// readCommands forwards start and stop from stdin to the device and exits on quit.
+func readCommands(send func(string)) {
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		switch cmd := strings.ToLower(strings.TrimSpace(sc.Text())); cmd {
+		case firmware.CommandStart, firmware.CommandStop:
+			send(cmd)
+		case "quit", "q":
+			os.Exit(0)
+		case "":
+		default:
+			log.Printf("unknown command %q; use start, stop or quit", cmd)
+		}
+	}
+}
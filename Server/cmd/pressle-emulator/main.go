@@ -0,0 +1,92 @@
+// Command pressle-emulator is a virtual Pressle sensor on a pseudo-terminal. It prints
+// the terminal's path; point pressle-bridge, or anything else that opens the board's
+// serial port, at it.
+//
+//	go run ./cmd/pressle-emulator -reps 10
+//	go run ./cmd/pressle-bridge -port /dev/pts/4 -start -once
+//
+// Sensor data comes from a recording with -csv, or from a generator shaped by the
+// other flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+
+	"PUSH-UP-ANALYZER/emulator"
+)
+
+func main() {
+	def := emulator.DefaultSynthetic()
+	csvPath := flag.String("csv", "", "replay this sessionN.csv instead of generating pushups")
+	baseline := flag.Float64("baseline", def.BaselineMM, "ToF distance at the top of a pushup, mm")
+	depth := flag.Float64("depth", def.DepthMM, "how far each rep goes down, mm")
+	pace := flag.Duration("pace", def.Pace, "length of one rep")
+	reps := flag.Int("reps", def.Reps, "reps per set before holding at the top; 0 keeps going until stop")
+	leadIn := flag.Duration("lead-in", def.LeadIn, "hold at the top after recording starts")
+	noise := flag.Float64("noise", def.NoiseMM, "ToF noise standard deviation, mm")
+	settle := flag.Duration("settle", def.SettleAfter, "keep moving this long after arming, so the device asks to hold still")
+	fidgetEnd := flag.Bool("fidget-end", def.FidgetAtEnd, "keep moving after stop, so the set ends by timeout")
+	errEvery := flag.Int("error-every", def.ErrorEvery, "fail every Nth ToF read with TOF_ERROR; 0 never does")
+	seed := flag.Int64("seed", def.Seed, "noise seed")
+	verbose := flag.Bool("v", false, "echo everything the device prints")
+	flag.Parse()
+
+	var src emulator.Source
+	if *csvPath != "" {
+		rec, err := emulator.LoadRecorded(*csvPath)
+		if err != nil {
+			log.Fatalf("%s: %v", *csvPath, err)
+		}
+		src = rec
+	} else {
+		src = emulator.NewSynthetic(emulator.SyntheticConfig{
+			BaselineMM:  *baseline,
+			DepthMM:     *depth,
+			Pace:        *pace,
+			Reps:        *reps,
+			LeadIn:      *leadIn,
+			NoiseMM:     *noise,
+			SettleAfter: *settle,
+			FidgetAtEnd: *fidgetEnd,
+			ErrorEvery:  *errEvery,
+			Seed:        *seed,
+		})
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ptmx.Close()
+	// Keeping our end of the tty open lets clients connect and disconnect without the
+	// master seeing EOF. Raw mode stops the line discipline from echoing the device's
+	// output back to it as commands.
+	defer tty.Close()
+	if _, err := term.MakeRaw(int(tty.Fd())); err != nil {
+		log.Fatal(err)
+	}
+
+	dev := emulator.New(src)
+	defer dev.Close()
+
+	var out io.Writer = ptmx
+	if *verbose {
+		out = io.MultiWriter(ptmx, os.Stderr)
+	}
+	go func() { _, _ = io.Copy(out, dev) }()
+	go func() { _, _ = io.Copy(dev, ptmx) }()
+
+	log.Printf("emulated sensor on %s", tty.Name())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	_ = dev.Run(ctx)
+}
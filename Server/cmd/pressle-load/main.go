@@ -0,0 +1,160 @@
+// Command pressle-load replays the recordings in data/ against a running server as many
+// simulated devices and reports latency percentiles and error rates per endpoint.
+//
+//	go run ./cmd/pressle-load -tokens tokens.txt -mode raw -speed 10 -sessions 5
+//
+// Each line of the tokens file is a device token registered with POST
+// /api/device-tokens/register; every token is one simulated device. Live mode allows one
+// set at a time per user, so give each device its own user there.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"PUSH-UP-ANALYZER/loadgen"
+	"PUSH-UP-ANALYZER/processing/classifier"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "server base URL")
+	tokensPath := flag.String("tokens", "", "file with one device token per line")
+	dataDir := flag.String("data", "../data", "directory with the sessionN.csv recordings")
+	modelPath := flag.String("model", "../data/data_processing/processed/model.json", "rep classifier used to count each recording's reps; empty to skip")
+	mode := flag.String("mode", "reps", "how devices send sets: reps, raw or live")
+	speed := flag.Float64("speed", 1, "replay speed: 1 is real time, 0 is as fast as possible")
+	sessions := flag.Int("sessions", 1, "sets per device; 0 runs until -duration or Ctrl-C")
+	duration := flag.Duration("duration", 0, "stop the run after this long; 0 means no limit")
+	scope := flag.String("scope", "", "visibility of stored sessions: public, friends or private")
+	login := flag.String("login", "", "username to poll the leaderboard as; password in PRESSLE_LOAD_PASSWORD")
+	lbEvery := flag.Duration("leaderboard-every", time.Second, "leaderboard poll interval when -login is set")
+	lbQuery := flag.String("leaderboard-query", "window=day", "query string for GET /api/leaderboard")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *tokensPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	tokens, err := readTokens(*tokensPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var model *classifier.Model
+	if *modelPath != "" {
+		if model, err = classifier.LoadFile(*modelPath); err != nil {
+			log.Printf("no rep classifier (%v); counting reps by peak detection alone", err)
+		}
+	}
+
+	recs, err := loadgen.LoadRecordings(*dataDir, model)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, rec := range recs {
+		log.Printf("%s: %d samples, %v, %d reps", rec.Name, len(rec.Samples), rec.Duration().Round(time.Second), rec.Reps)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	cfg := loadgen.Config{
+		ServerURL:        *server,
+		Tokens:           tokens,
+		Mode:             loadgen.Mode(*mode),
+		Speed:            *speed,
+		Sessions:         *sessions,
+		Scope:            *scope,
+		RunID:            fmt.Sprintf("%d", time.Now().Unix()),
+		LeaderboardEvery: *lbEvery,
+		LeaderboardQuery: *lbQuery,
+		Client:           &http.Client{Timeout: 30 * time.Second},
+	}
+	if *login != "" {
+		cfg.Leaderboard, err = loginClient(*server, *login, os.Getenv("PRESSLE_LOAD_PASSWORD"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Printf("%d devices, mode %s, speed %gx", len(tokens), *mode, *speed)
+	stats := loadgen.NewStats()
+	start := time.Now()
+	if err := loadgen.Run(ctx, cfg, recs, stats); err != nil {
+		log.Fatal(err)
+	}
+
+	// Whatever finished before Ctrl-C or -duration is still worth reporting.
+	sums := stats.Summary(time.Since(start))
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(sums)
+		return
+	}
+	if err := loadgen.WriteReport(os.Stdout, sums); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tokens []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", path)
+	}
+	return tokens, nil
+}
+
+// loginClient logs in once and returns a client that carries the session cookie.
+func loginClient(server, username, password string) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Jar: jar, Timeout: 30 * time.Second}
+
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := client.Post(strings.TrimRight(server, "/")+"/api/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("login as %s: %s", username, resp.Status)
+	}
+	return client, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// Device endpoints take JSON or, for devices that would rather not format text, CBOR
+// (RFC 8949) with the same field names. Raw uploads also take a binary sample frame
+// (firmware.FrameContentType). Replies are CBOR when the Accept header asks for it.
+
+const contentTypeCBOR = "application/cbor"
+
+// deviceCBOR decodes CBOR into the JSON-tagged request types: field names come from
+// the json tags, text timestamps are RFC 3339 like JSON's, and maps nested in any-typed
+// fields get string keys so they can be re-encoded as JSON.
+var deviceCBOR, _ = cbor.DecOptions{
+	DefaultMapType:   reflect.TypeOf(map[string]any(nil)),
+	MaxArrayElements: maxRawSamples + maxRawEvents,
+}.DecMode()
+
+var deviceCBOREnc, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+
+// requestMediaType is the request's Content-Type without parameters.
+func requestMediaType(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType
+}
+
+// decodeDeviceBody decodes a rep submission body. Anything that isn't CBOR is read as
+// JSON, as it always has been.
+func decodeDeviceBody(r *http.Request, v any) error {
+	if requestMediaType(r) == contentTypeCBOR {
+		if err := deviceCBOR.NewDecoder(r.Body).Decode(v); err != nil {
+			return errors.New("invalid CBOR")
+		}
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errors.New("invalid JSON")
+	}
+	return nil
+}
+
+// decodeDevicePayload decodes a body with no content type, such as an MQTT payload:
+// CBOR when it starts with a CBOR map header, JSON otherwise. A JSON object can't
+// start with one of those bytes.
+func decodeDevicePayload(payload []byte, v any) error {
+	if len(payload) > 0 && payload[0]>>5 == 5 {
+		if err := deviceCBOR.Unmarshal(payload, v); err != nil {
+			return errors.New("invalid CBOR")
+		}
+		return nil
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return errors.New("invalid JSON")
+	}
+	return nil
+}
+
+// wantsCBOR reports whether the client listed CBOR in Accept ahead of JSON.
+func wantsCBOR(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentTypeCBOR:
+			return true
+		case "application/json", "*/*", "application/*":
+			return false
+		}
+	}
+	return false
+}
+
+// writeDeviceResponse writes a device endpoint's reply as CBOR or JSON.
+func writeDeviceResponse(w http.ResponseWriter, r *http.Request, status int, body any) {
+	w.Header().Add("Vary", "Accept")
+	if wantsCBOR(r) {
+		w.Header().Set("Content-Type", contentTypeCBOR)
+		w.WriteHeader(status)
+		_ = deviceCBOREnc.NewEncoder(w).Encode(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// parseRawFrame reads a binary sample frame into the same types as the CSV and JSON
+// paths. The frame holds no metadata; like CSV, that comes from the query string.
+func parseRawFrame(r io.Reader) (rawSessionUpload, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return rawSessionUpload{}, err
+	}
+	f, err := firmware.DecodeFrame(b)
+	if err != nil {
+		return rawSessionUpload{}, err
+	}
+
+	up := rawSessionUpload{
+		Samples: make([]rawSample, len(f.Samples)),
+		Events:  make([]rawEvent, len(f.Events)),
+	}
+	for i, s := range f.Samples {
+		up.Samples[i] = rawSample{
+			DeviceMS: s.DeviceMS,
+			TofMM:    s.TofMM,
+			AX:       s.AX, AY: s.AY, AZ: s.AZ,
+			GX: s.GX, GY: s.GY, GZ: s.GZ,
+		}
+	}
+	for i, ev := range f.Events {
+		up.Events[i] = rawEvent{DeviceMS: ev.DeviceMS, Name: string(ev.Name), State: string(ev.State)}
+		if !math.IsNaN(ev.Value) {
+			v := ev.Value
+			up.Events[i].Value = &v
+		}
+	}
+	return up, nil
+}
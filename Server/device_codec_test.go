@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+func TestDecodeDeviceBodyCBORMatchesJSON(t *testing.T) {
+	body := map[string]any{
+		"reps":            3,
+		"scope":           "friends",
+		"clientSessionId": "set-42",
+		"startedAt":       "2026-10-19T07:30:00Z",
+		"baselineMm":      412.5,
+		"tags":            []string{"morning"},
+		"repEvents": []map[string]any{
+			{"tMs": 1200, "bottomTofMm": 205, "depthMm": 210, "durationMs": 1800},
+			{"tMs": 3100, "bottomTofMm": 210, "depthMm": 205, "durationMs": 1700},
+			{"tMs": 5000, "bottomTofMm": 217, "depthMm": 198, "durationMs": 1900},
+		},
+	}
+	asJSON, _ := json.Marshal(body)
+	asCBOR, err := cbor.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(contentType string, b []byte) repRequest {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/reps", bytes.NewReader(b))
+		r.Header.Set("Content-Type", contentType)
+		var req repRequest
+		if err := decodeDeviceBody(r, &req); err != nil {
+			t.Fatalf("%s: %v", contentType, err)
+		}
+		return req
+	}
+
+	fromJSON := decode("application/json", asJSON)
+	fromCBOR := decode(contentTypeCBOR, asCBOR)
+	if !reflect.DeepEqual(fromJSON, fromCBOR) {
+		t.Fatalf("CBOR decoded to %+v; JSON to %+v", fromCBOR, fromJSON)
+	}
+	if fromCBOR.Reps != 3 || fromCBOR.StartedAt == nil || len(fromCBOR.RepEvents) != 3 || len(fromCBOR.Tags) != 1 {
+		t.Fatalf("decoded %+v", fromCBOR)
+	}
+
+	// A CBOR body sent as JSON is just bad JSON.
+	r := httptest.NewRequest(http.MethodPost, "/api/reps", bytes.NewReader(asCBOR))
+	if err := decodeDeviceBody(r, &repRequest{}); err == nil || err.Error() != "invalid JSON" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestDecodeDevicePayloadSniffsCBOR(t *testing.T) {
+	asCBOR, _ := cbor.Marshal(map[string]any{"reps": 7})
+	for _, payload := range [][]byte{asCBOR, []byte(`{"reps":7}`), []byte(" {\"reps\":7}")} {
+		var req repRequest
+		if err := decodeDevicePayload(payload, &req); err != nil || req.Reps != 7 {
+			t.Fatalf("%q: reps %d, err %v", payload, req.Reps, err)
+		}
+	}
+}
+
+func TestTelemetryJSON(t *testing.T) {
+	asCBOR, _ := cbor.Marshal(map[string]any{"batteryMv": 3900, "fw": map[string]any{"version": "1.2.0"}})
+	got, err := telemetryJSON(asCBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"batteryMv":3900,"fw":{"version":"1.2.0"}}` {
+		t.Fatalf("stored %s", got)
+	}
+
+	for _, bad := range []string{`[1,2]`, `null`, `"up"`, `{`} {
+		if _, err := telemetryJSON([]byte(bad)); err == nil {
+			t.Fatalf("%s accepted", bad)
+		}
+	}
+	if _, err := telemetryJSON([]byte(`{"pad":"` + strings.Repeat("x", maxTelemetryBytes) + `"}`)); err == nil {
+		t.Fatal("oversized telemetry accepted")
+	}
+}
+
+func TestParseRawFrameMatchesCSV(t *testing.T) {
+	fromCSV, err := parseRawCSV(strings.NewReader(firmwareStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := normalizeRawSession(&fromCSV); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := make([]firmware.Sample, len(fromCSV.Samples))
+	for i, s := range fromCSV.Samples {
+		samples[i] = firmware.Sample{DeviceMS: s.DeviceMS, TofMM: s.TofMM, AX: s.AX, AY: s.AY, AZ: s.AZ, GX: s.GX, GY: s.GY, GZ: s.GZ}
+	}
+	events := make([]firmware.Event, len(fromCSV.Events))
+	for i, ev := range fromCSV.Events {
+		events[i] = firmware.Event{DeviceMS: ev.DeviceMS, Name: firmware.EventName(ev.Name), State: firmware.State(ev.State), Value: math.NaN()}
+		if ev.Value != nil {
+			events[i].Value = *ev.Value
+		}
+	}
+	frame, err := firmware.EncodeFrame(samples, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromFrame, err := parseRawFrame(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := normalizeRawSession(&fromFrame); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromFrame.Events, fromCSV.Events) {
+		t.Fatalf("frame events %+v; CSV %+v", fromFrame.Events, fromCSV.Events)
+	}
+
+	// Same reps and baseline: the frame's resolution is finer than the pipeline cares about.
+	csvReps, csvBaseline, err := detectRawReps(fromCSV, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frameReps, frameBaseline, err := detectRawReps(fromFrame, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frameReps) != len(csvReps) || frameBaseline != csvBaseline {
+		t.Fatalf("frame: %d reps at %v; CSV: %d reps at %v", len(frameReps), frameBaseline, len(csvReps), csvBaseline)
+	}
+
+	if _, err := parseRawFrame(strings.NewReader("not a frame")); err == nil {
+		t.Fatal("garbage parsed as a frame")
+	}
+}
+
+func TestRawSessionCBOR(t *testing.T) {
+	body := map[string]any{
+		"scope":           "public",
+		"clientSessionId": "raw-7",
+		"startedAt":       time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		"samples": []map[string]any{
+			{"timestamp_ms": 100, "tof_mm": 410.0, "ax": -0.2, "ay": 0.1, "az": -1.0, "gx": 1.5, "gy": 0.0, "gz": 0.0},
+		},
+		"events": []map[string]any{
+			{"timestamp_ms": 50, "event": "BASELINE_LOCKED_MM", "value": 412.6, "state": "ARMING"},
+			{"timestamp_ms": 60, "event": "COUNTDOWN_START", "state": "COUNTDOWN"},
+		},
+	}
+	asCBOR, _ := cbor.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, "/api/sessions/raw", bytes.NewReader(asCBOR))
+	r.Header.Set("Content-Type", contentTypeCBOR)
+
+	var up rawSessionUpload
+	if err := decodeDeviceBody(r, &up); err != nil {
+		t.Fatal(err)
+	}
+	if up.Scope != "public" || up.ClientSessionID != "raw-7" || up.StartedAt == nil || len(up.Samples) != 1 || up.Samples[0].GX != 1.5 {
+		t.Fatalf("decoded %+v", up)
+	}
+	if up.Events[0].Value == nil || *up.Events[0].Value != 412.6 || up.Events[1].Value != nil {
+		t.Fatalf("events %+v", up.Events)
+	}
+}
+
+func TestWriteDeviceResponse(t *testing.T) {
+	cases := []struct {
+		accept string
+		cbor   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/cbor", true},
+		{"application/cbor, application/json;q=0.5", true},
+		{"application/json, application/cbor", false},
+		{"*/*", false},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/api/reps", nil)
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		writeDeviceResponse(w, r, http.StatusCreated, map[string]any{"ok": true, "sessionId": int64(9)})
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%q: status %d", tc.accept, w.Code)
+		}
+		var got struct {
+			OK        bool  `json:"ok"`
+			SessionID int64 `json:"sessionId"`
+		}
+		if tc.cbor {
+			if ct := w.Header().Get("Content-Type"); ct != contentTypeCBOR {
+				t.Fatalf("%q: content type %s", tc.accept, ct)
+			}
+			if err := cbor.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%q: %v", tc.accept, err)
+			}
+		} else if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%q: %v", tc.accept, err)
+		}
+		if !got.OK || got.SessionID != 9 {
+			t.Fatalf("%q: body %+v", tc.accept, got)
+		}
+	}
+}
+
+func TestRawFrameMetaFromQuery(t *testing.T) {
+	// Frames carry only sensor data; metadata comes from the query string, as for CSV.
+	meta, err := rawSessionMetaFromQuery(url.Values{"scope": {"friends"}, "reps": {"12"}})
+	if err != nil || meta.Scope != "friends" || meta.DeviceReps == nil || *meta.DeviceReps != 12 {
+		t.Fatalf("meta %+v, err %v", meta, err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package emulator is a virtual Pressle sensor. Device runs the same state machine as
+// Hardware/src/main.cpp and speaks the same serial protocol, so the bridge and anything
+// else that talks to the board can be exercised without it.
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// idleLoopMS is the firmware's delay(10) while IDLE.
+const idleLoopMS = 10
+
+// banner is what setup() prints once the sensors are up.
+var banner = []string{
+	"Pressle sensor logger",
+	"Type: start / stop",
+	"VL53L1X sensor OK!",
+	"Ranging started",
+	"Timing budget (ms): 50",
+}
+
+// Device is an emulated board. It is an io.ReadWriter like a serial port: write
+// commands such as "start\n", read what the firmware prints.
+//
+// Device time only moves when Advance is called, so tests can drive it step by step;
+// Run advances it with the wall clock.
+type Device struct {
+	src Source
+
+	mu     sync.Mutex
+	ready  *sync.Cond
+	out    bytes.Buffer
+	in     []byte
+	cmds   []string
+	closed bool
+
+	// Firmware globals, named as in main.cpp.
+	ms               int64
+	state            firmware.State
+	lastSample       int64
+	phaseStartMs     int64
+	baselineTof      float64
+	baselineLocked   bool
+	csvHeaderPrinted bool
+	tofEma           float64
+	tofEmaInit       bool
+	stableMin        float64
+	stableMax        float64
+	stopRequested    bool
+}
+
+// New returns a device that has just booted and printed its banner.
+func New(src Source) *Device {
+	d := &Device{src: src, state: firmware.StateIdle, stableMin: 100000, stableMax: -100000}
+	d.ready = sync.NewCond(&d.mu)
+	for _, line := range banner {
+		d.println(line)
+	}
+	return d
+}
+
+// Read returns what the firmware printed, blocking until there is output or the
+// device is closed.
+func (d *Device) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for d.out.Len() == 0 && !d.closed {
+		d.ready.Wait()
+	}
+	if d.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return d.out.Read(p)
+}
+
+// Write queues commands. Each complete line is handled on the next loop iteration,
+// like Serial.readStringUntil('\n').
+func (d *Device) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, io.ErrClosedPipe
+	}
+	d.in = append(d.in, p...)
+	for {
+		i := bytes.IndexByte(d.in, '\n')
+		if i < 0 {
+			break
+		}
+		d.cmds = append(d.cmds, string(d.in[:i]))
+		d.in = d.in[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close unblocks readers, which get io.EOF once the output is drained.
+func (d *Device) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	d.ready.Broadcast()
+	return nil
+}
+
+// State is the firmware's current state.
+func (d *Device) State() firmware.State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// Millis is the device clock, like millis() on the board.
+func (d *Device) Millis() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ms
+}
+
+// Advance runs the firmware loop for dt of device time.
+func (d *Device) Advance(dt time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	until := d.ms + dt.Milliseconds()
+	for d.ms < until {
+		d.loop(until)
+	}
+}
+
+// Run advances the device in real time until ctx is done.
+func (d *Device) Run(ctx context.Context) error {
+	tick := time.NewTicker(idleLoopMS * time.Millisecond)
+	defer tick.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-tick.C:
+			d.Advance(now.Sub(last))
+			last = last.Add(now.Sub(last).Truncate(time.Millisecond))
+		}
+	}
+}
+
+// loop is one pass of loop() in main.cpp. Instead of spinning until the next sample is
+// due it jumps the clock there, but never past until.
+func (d *Device) loop(until int64) {
+	d.handleSerial()
+
+	if d.state == firmware.StateIdle {
+		d.ms = min(d.ms+idleLoopMS, until)
+		return
+	}
+
+	sampleMS := firmware.SampleInterval.Milliseconds()
+	if d.ms-d.lastSample < sampleMS {
+		d.ms = min(d.lastSample+sampleMS, until)
+		return
+	}
+	d.lastSample = d.ms
+	// Whatever happens below takes the board about a millisecond.
+	defer func() { d.ms++ }()
+
+	r, tofSmooth, ok := d.sampleSensors()
+	if !ok {
+		return
+	}
+
+	d.stableMin = math.Min(d.stableMin, tofSmooth)
+	d.stableMax = math.Max(d.stableMax, tofSmooth)
+
+	switch d.state {
+	case firmware.StateArming:
+		if d.ms-d.phaseStartMs >= firmware.ArmingDuration.Milliseconds() {
+			span := d.stableMax - d.stableMin
+			if span <= firmware.StableRangeMM {
+				d.baselineTof = tofSmooth
+				d.baselineLocked = true
+				d.emitEventValue(firmware.EventBaselineLocked, d.baselineTof)
+				d.state = firmware.StateCountdown
+				d.phaseStartMs = d.ms
+				d.emitEvent(firmware.EventCountdownStart)
+			} else {
+				d.emitEventValue(firmware.EventHoldStill, span)
+				d.phaseStartMs = d.ms
+			}
+			d.resetStabilityWindow(tofSmooth)
+		}
+
+	case firmware.StateCountdown:
+		if d.ms-d.phaseStartMs >= firmware.CountdownLength.Milliseconds() {
+			d.state = firmware.StateRecording
+			d.phaseStartMs = d.ms
+			d.csvHeaderPrinted = false
+			d.emitEvent(firmware.EventRecordingStart)
+		}
+
+	case firmware.StateRecording:
+		if !d.csvHeaderPrinted {
+			d.println(firmware.Header)
+			d.println("RECORDING")
+			d.csvHeaderPrinted = true
+		}
+		d.println(strings.Join([]string{
+			strconv.FormatInt(d.ms, 10),
+			formatFloat(r.TofMM, 2),
+			formatFloat(r.AX, 4), formatFloat(r.AY, 4), formatFloat(r.AZ, 4),
+			formatFloat(r.GX, 4), formatFloat(r.GY, 4), formatFloat(r.GZ, 4),
+		}, ","))
+
+		if d.stopRequested || d.ms-d.phaseStartMs >= firmware.SessionLimit.Milliseconds() {
+			d.state = firmware.StateEndHold
+			d.phaseStartMs = d.ms
+			d.stopRequested = false
+			d.resetStabilityWindow(tofSmooth)
+			d.emitEvent(firmware.EventEndHoldStart)
+		}
+
+	case firmware.StateEndHold:
+		if d.ms-d.phaseStartMs >= firmware.EndHoldDuration.Milliseconds() {
+			span := d.stableMax - d.stableMin
+			switch {
+			case span <= firmware.StableRangeMM:
+				d.emitEventValue(firmware.EventSessionStoppedClean, span)
+				d.stopSession()
+			case d.ms-d.phaseStartMs >= firmware.EndHoldTimeout.Milliseconds():
+				d.emitEventValue(firmware.EventSessionStoppedTimeout, span)
+				d.stopSession()
+			}
+		}
+	}
+}
+
+func (d *Device) stopSession() {
+	d.println("STOPPED")
+	d.state = firmware.StateIdle
+	d.baselineLocked = false
+	d.tofEmaInit = false
+}
+
+// handleSerial handles at most one queued command per loop, as the firmware does.
+func (d *Device) handleSerial() {
+	if len(d.cmds) == 0 {
+		return
+	}
+	cmd := strings.TrimSpace(d.cmds[0])
+	d.cmds = d.cmds[1:]
+
+	switch {
+	case strings.EqualFold(cmd, firmware.CommandStart):
+		d.state = firmware.StateArming
+		d.phaseStartMs = d.ms
+		d.baselineLocked = false
+		d.csvHeaderPrinted = false
+		d.stopRequested = false
+		d.emitEvent(firmware.EventStartCmd)
+		d.emitEvent(firmware.EventArmingStart)
+
+	case strings.EqualFold(cmd, firmware.CommandStop):
+		if d.state == firmware.StateRecording {
+			d.stopRequested = true
+			d.emitEvent(firmware.EventStopCmd)
+		} else {
+			d.state = firmware.StateIdle
+			d.emitEvent(firmware.EventStopCmdIdle)
+			d.println("STOPPED")
+		}
+	}
+}
+
+// sampleSensors reads the source and smooths the ToF reading like the firmware's EMA.
+func (d *Device) sampleSensors() (Reading, float64, bool) {
+	r := d.src.Read(d.ms, d.state)
+	if r.Status != 0 {
+		d.emitEventValue(firmware.EventTofError, float64(r.Status))
+		return Reading{}, 0, false
+	}
+
+	// The VL53L1X reports whole millimetres.
+	r.TofMM = math.Round(r.TofMM)
+	if !d.tofEmaInit {
+		d.tofEma = r.TofMM
+		d.tofEmaInit = true
+		d.resetStabilityWindow(d.tofEma)
+	} else {
+		d.tofEma = firmware.TofEMAAlpha*r.TofMM + (1-firmware.TofEMAAlpha)*d.tofEma
+	}
+	return r, d.tofEma, true
+}
+
+func (d *Device) resetStabilityWindow(v float64) {
+	d.stableMin, d.stableMax = v, v
+}
+
+func (d *Device) emitEvent(name firmware.EventName) {
+	d.println("EVENT," + strconv.FormatInt(d.ms, 10) + "," + string(name) + "," + string(d.state))
+}
+
+func (d *Device) emitEventValue(name firmware.EventName, v float64) {
+	d.println("EVENT," + strconv.FormatInt(d.ms, 10) + "," + string(name) + "," + formatFloat(v, 2) + "," + string(d.state))
+}
+
+// println writes a line the way Serial.println does, with CRLF. Callers hold d.mu.
+func (d *Device) println(line string) {
+	d.out.WriteString(line)
+	d.out.WriteString("\r\n")
+	d.ready.Broadcast()
+}
+
+// formatFloat prints like Arduino's Serial.print(float, digits).
+func formatFloat(v float64, digits int) string {
+	return strconv.FormatFloat(v, 'f', digits, 64)
+}
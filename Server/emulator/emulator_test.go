@@ -0,0 +1,283 @@
+package emulator
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"PUSH-UP-ANALYZER/bridge"
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// script runs commands against d at device times and returns everything it printed.
+type step struct {
+	cmd   string
+	after time.Duration
+}
+
+func runScript(t *testing.T, d *Device, steps ...step) string {
+	t.Helper()
+	for _, s := range steps {
+		if s.cmd != "" {
+			if err := bridge.SendCommand(d, s.cmd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d.Advance(s.after)
+	}
+	d.Close()
+	out, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// checkStream parses the output, fails on protocol violations and returns the sessions
+// a bridge would record and every event name in order.
+func checkStream(t *testing.T, out string) ([]bridge.Session, []firmware.EventName) {
+	t.Helper()
+
+	v := firmware.NewValidator()
+	var names []firmware.EventName
+	rec := &bridge.Recorder{OnLine: func(line firmware.Line) {
+		for _, viol := range v.Check(line) {
+			t.Errorf("protocol: %s", viol)
+		}
+		if line.Kind == firmware.LineEvent {
+			names = append(names, line.Event.Name)
+		}
+	}}
+
+	var sessions []bridge.Session
+	err := rec.Run(strings.NewReader(out), func(s bridge.Session) error {
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Malformed != 0 {
+		t.Errorf("%d malformed lines", rec.Malformed)
+	}
+	for _, viol := range v.Finish() {
+		t.Errorf("protocol: %s", viol)
+	}
+	return sessions, names
+}
+
+func eventIndex(names []firmware.EventName, name firmware.EventName) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestCleanSet(t *testing.T) {
+	cfg := DefaultSynthetic()
+	cfg.Reps = 5
+	d := New(NewSynthetic(cfg))
+	out := runScript(t, d,
+		step{"", time.Second},
+		step{"start", 7500 * time.Millisecond}, // arming and countdown
+		step{"", 12 * time.Second},             // the lead-in and five reps
+		step{"stop", 3 * time.Second},
+	)
+
+	if !strings.HasPrefix(out, "Pressle sensor logger\r\n") {
+		t.Fatalf("no banner: %q", out[:40])
+	}
+
+	sessions, names := checkStream(t, out)
+	want := []firmware.EventName{
+		firmware.EventStartCmd, firmware.EventArmingStart, firmware.EventBaselineLocked,
+		firmware.EventCountdownStart, firmware.EventRecordingStart, firmware.EventStopCmd,
+		firmware.EventEndHoldStart, firmware.EventSessionStoppedClean,
+	}
+	if len(names) != len(want) {
+		t.Fatalf("events %v; want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("events %v; want %v", names, want)
+		}
+	}
+
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions", len(sessions))
+	}
+	s := sessions[0]
+	if n := len(s.Samples); n < 115 || n > 130 {
+		t.Fatalf("recorded %d samples over about 12s", n)
+	}
+
+	// Baseline locks near the top and the reps reach the configured depth.
+	var baseline float64
+	minTof := math.Inf(1)
+	for _, ev := range s.Events {
+		if ev.Name == firmware.EventBaselineLocked {
+			baseline = ev.Value
+		}
+	}
+	for _, smp := range s.Samples {
+		minTof = math.Min(minTof, smp.TofMM)
+	}
+	if math.Abs(baseline-cfg.BaselineMM) > 5 || math.Abs(minTof-(cfg.BaselineMM-cfg.DepthMM)) > 10 {
+		t.Fatalf("baseline %.1f, bottom %.1f", baseline, minTof)
+	}
+	if d.State() != firmware.StateIdle {
+		t.Fatalf("state %s after the set", d.State())
+	}
+}
+
+func TestHoldStillUntilSettled(t *testing.T) {
+	cfg := DefaultSynthetic()
+	cfg.SettleAfter = 3 * time.Second
+	out := runScript(t, New(NewSynthetic(cfg)), step{"start", 7 * time.Second}, step{"stop", time.Second})
+
+	_, names := checkStream(t, out)
+	hold, locked := eventIndex(names, firmware.EventHoldStill), eventIndex(names, firmware.EventBaselineLocked)
+	if hold < 0 || locked < hold {
+		t.Fatalf("events %v; want HOLD_STILL_SPAN_MM before BASELINE_LOCKED_MM", names)
+	}
+}
+
+func TestRecordingCap(t *testing.T) {
+	cfg := DefaultSynthetic()
+	cfg.Reps = 20
+	d := New(NewSynthetic(cfg))
+	out := runScript(t, d, step{"start", 75 * time.Second})
+
+	sessions, names := checkStream(t, out)
+	if eventIndex(names, firmware.EventStopCmd) >= 0 || eventIndex(names, firmware.EventSessionStoppedClean) < 0 {
+		t.Fatalf("events %v", names)
+	}
+
+	s := sessions[0]
+	var recStart, endHold int64
+	for _, ev := range s.Events {
+		switch ev.Name {
+		case firmware.EventRecordingStart:
+			recStart = ev.DeviceMS
+		case firmware.EventEndHoldStart:
+			endHold = ev.DeviceMS
+		}
+	}
+	if got := time.Duration(endHold-recStart) * time.Millisecond; got < firmware.SessionLimit || got > firmware.SessionLimit+firmware.SampleInterval+10*time.Millisecond {
+		t.Fatalf("recorded for %v; want the %v cap", got, firmware.SessionLimit)
+	}
+}
+
+func TestEndHoldTimeout(t *testing.T) {
+	cfg := DefaultSynthetic()
+	cfg.FidgetAtEnd = true
+	out := runScript(t, New(NewSynthetic(cfg)), step{"start", 10 * time.Second}, step{"stop", 7 * time.Second})
+
+	sessions, names := checkStream(t, out)
+	if eventIndex(names, firmware.EventSessionStoppedTimeout) < 0 {
+		t.Fatalf("events %v; want a timeout", names)
+	}
+	evs := sessions[0].Events
+	last, endHold := evs[len(evs)-1], evs[len(evs)-2]
+	if got := time.Duration(last.DeviceMS-endHold.DeviceMS) * time.Millisecond; got < firmware.EndHoldTimeout {
+		t.Fatalf("timed out after %v; want %v", got, firmware.EndHoldTimeout)
+	}
+}
+
+func TestStopWhileNotRecording(t *testing.T) {
+	out := runScript(t, New(NewSynthetic(DefaultSynthetic())),
+		step{"stop", 100 * time.Millisecond},
+		step{"start", 3 * time.Second},
+		step{"STOP", 100 * time.Millisecond},
+	)
+
+	sessions, names := checkStream(t, out)
+	if len(sessions) != 0 {
+		t.Fatalf("a set with no recording produced %d sessions", len(sessions))
+	}
+	if names[0] != firmware.EventStopCmdIdle || names[len(names)-1] != firmware.EventStopCmdIdle {
+		t.Fatalf("events %v", names)
+	}
+	if strings.Count(out, "STOPPED") != 2 {
+		t.Fatalf("want two STOPPED markers:\n%s", out)
+	}
+}
+
+func TestTofError(t *testing.T) {
+	cfg := DefaultSynthetic()
+	cfg.Reps = 2
+	cfg.ErrorEvery = 10
+	out := runScript(t, New(NewSynthetic(cfg)), step{"start", 14 * time.Second}, step{"stop", 3 * time.Second})
+
+	_, names := checkStream(t, out)
+	if eventIndex(names, firmware.EventTofError) < 0 {
+		t.Fatalf("events %v; want TOF_ERROR", names)
+	}
+}
+
+func TestRecordedReplay(t *testing.T) {
+	src, err := LoadRecorded("../../data/session4.csv")
+	if err != nil {
+		t.Skipf("no recording: %v", err)
+	}
+
+	out := runScript(t, New(src), step{"start", 8 * time.Second}, step{"", 16 * time.Second}, step{"stop", 3 * time.Second})
+	sessions, _ := checkStream(t, out)
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions", len(sessions))
+	}
+
+	// Samples come out at the firmware's 100ms pace, in the recording's order.
+	got := sessions[0].Samples
+	if len(got) < 150 {
+		t.Fatalf("replayed %d samples", len(got))
+	}
+	for i := 0; i < 10; i++ {
+		if got[i].TofMM != math.Round(src.samples[i].TofMM) {
+			t.Fatalf("sample %d: tof %.2f; want %.2f", i, got[i].TofMM, src.samples[i].TofMM)
+		}
+	}
+}
+
+func TestReadBlocksUntilOutput(t *testing.T) {
+	d := New(NewSynthetic(DefaultSynthetic()))
+
+	// Drain the banner.
+	buf := make([]byte, 4096)
+	var banner bytes.Buffer
+	for !strings.Contains(banner.String(), "Timing budget") {
+		n, _ := d.Read(buf)
+		banner.Write(buf[:n])
+	}
+
+	got := make(chan string)
+	go func() {
+		n, _ := d.Read(buf)
+		got <- string(buf[:n])
+	}()
+
+	select {
+	case s := <-got:
+		t.Fatalf("read %q before any output", s)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_ = bridge.SendCommand(d, "stop")
+	d.Advance(time.Millisecond)
+	if s := <-got; !strings.HasPrefix(s, "EVENT,0,STOP_CMD_IDLE,IDLE") {
+		t.Fatalf("read %q", s)
+	}
+
+	d.Close()
+	if _, err := d.Read(buf); err == nil {
+		// STOPPED may still be buffered; the read after it must be EOF.
+		if _, err := d.Read(buf); err != io.EOF {
+			t.Fatalf("read after close: %v", err)
+		}
+	}
+}
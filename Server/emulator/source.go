@@ -0,0 +1,192 @@
+package emulator
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"PUSH-UP-ANALYZER/firmware"
+	"PUSH-UP-ANALYZER/processing/prepare"
+)
+
+// Reading is one read of the sensors.
+type Reading struct {
+	TofMM      float64
+	AX, AY, AZ float64
+	GX, GY, GZ float64
+	// Status, when not zero, fails the ToF read: the firmware emits TOF_ERROR with it.
+	Status int
+}
+
+// Source produces sensor readings. The firmware state is passed in so a source can
+// act like a person: holding still while arming, moving once recording starts.
+type Source interface {
+	Read(ms int64, state firmware.State) Reading
+}
+
+// Recorded replays a recorded set. Outside a set it holds the first sample, as someone
+// waiting at the top would; once RECORDING starts it plays the samples in device time
+// and then holds the last one.
+type Recorded struct {
+	samples []firmware.Sample
+	start   int64
+	playing bool
+}
+
+func NewRecorded(samples []firmware.Sample) *Recorded {
+	s := append([]firmware.Sample(nil), samples...)
+	sort.SliceStable(s, func(i, j int) bool { return s[i].DeviceMS < s[j].DeviceMS })
+	return &Recorded{samples: s}
+}
+
+// LoadRecorded reads a data/sessionN.csv file.
+func LoadRecorded(path string) (*Recorded, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw, err := prepare.ReadSessionCSV(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []firmware.Sample
+	for _, r := range raw {
+		if math.IsNaN(r.DeviceS) || math.IsNaN(r.TofMM) {
+			continue
+		}
+		samples = append(samples, firmware.Sample{
+			DeviceMS: int64(math.Round(r.DeviceS * 1000)),
+			TofMM:    r.TofMM,
+			AX:       r.AX, AY: r.AY, AZ: r.AZ,
+			GX: r.GX, GY: r.GY, GZ: r.GZ,
+		})
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("recording has no samples")
+	}
+	return NewRecorded(samples), nil
+}
+
+func (r *Recorded) Read(ms int64, state firmware.State) Reading {
+	var s firmware.Sample
+	switch state {
+	case firmware.StateRecording, firmware.StateEndHold:
+		if !r.playing {
+			r.start, r.playing = ms, true
+		}
+		at := r.samples[0].DeviceMS + (ms - r.start)
+		i := sort.Search(len(r.samples), func(i int) bool { return r.samples[i].DeviceMS > at })
+		s = r.samples[max(i-1, 0)]
+	default:
+		r.playing = false
+		s = r.samples[0]
+	}
+	return Reading{TofMM: s.TofMM, AX: s.AX, AY: s.AY, AZ: s.AZ, GX: s.GX, GY: s.GY, GZ: s.GZ}
+}
+
+// SyntheticConfig shapes the generated pushups.
+type SyntheticConfig struct {
+	// BaselineMM is the ToF distance at the top of a pushup.
+	BaselineMM float64
+	// DepthMM is how far each rep goes down from the top.
+	DepthMM float64
+	// Pace is the length of one rep.
+	Pace time.Duration
+	// Reps per set; after the last one the person holds at the top. 0 keeps going.
+	Reps int
+	// LeadIn is how long the person holds at the top after RECORDING starts.
+	LeadIn time.Duration
+	// NoiseMM is the standard deviation of ToF noise.
+	NoiseMM float64
+	// SettleAfter is how long the person keeps moving after arming starts, which makes
+	// the firmware report HOLD_STILL_SPAN_MM until they settle.
+	SettleAfter time.Duration
+	// FidgetAtEnd keeps the person moving during END_HOLD, so the set ends by timeout.
+	FidgetAtEnd bool
+	// ErrorEvery fails every Nth ToF read with TOF_ERROR; 0 never does.
+	ErrorEvery int
+	Seed       int64
+}
+
+// DefaultSynthetic is a steady set of 2-second reps.
+func DefaultSynthetic() SyntheticConfig {
+	return SyntheticConfig{
+		BaselineMM: 420,
+		DepthMM:    220,
+		Pace:       2 * time.Second,
+		LeadIn:     time.Second,
+		NoiseMM:    1.5,
+		Seed:       1,
+	}
+}
+
+// fidgetMM is how far someone who isn't holding still moves, well past StableRangeMM.
+const fidgetMM = 60
+
+// Synthetic generates pushups: a cosine dip of DepthMM every Pace, plus noise.
+type Synthetic struct {
+	cfg      SyntheticConfig
+	rng      *rand.Rand
+	reads    int
+	armStart int64
+	recStart int64
+	prev     firmware.State
+}
+
+func NewSynthetic(cfg SyntheticConfig) *Synthetic {
+	return &Synthetic{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed)), prev: firmware.StateIdle}
+}
+
+func (g *Synthetic) Read(ms int64, state firmware.State) Reading {
+	if state != g.prev {
+		switch state {
+		case firmware.StateArming:
+			g.armStart = ms
+		case firmware.StateRecording:
+			g.recStart = ms
+		}
+		g.prev = state
+	}
+
+	g.reads++
+	if g.cfg.ErrorEvery > 0 && g.reads%g.cfg.ErrorEvery == 0 {
+		// VL53L1X range status 4: phase out of bounds.
+		return Reading{Status: 4}
+	}
+
+	tof := g.cfg.BaselineMM
+	var motion float64 // -1..1, how fast the body is moving, for the IMU
+	switch state {
+	case firmware.StateArming:
+		if time.Duration(ms-g.armStart)*time.Millisecond < g.cfg.SettleAfter {
+			tof += fidgetMM * math.Sin(2*math.Pi*float64(ms)/700)
+		}
+	case firmware.StateRecording:
+		t := time.Duration(ms-g.recStart)*time.Millisecond - g.cfg.LeadIn
+		if t > 0 && g.cfg.Pace > 0 && (g.cfg.Reps == 0 || t < time.Duration(g.cfg.Reps)*g.cfg.Pace) {
+			phase := 2 * math.Pi * float64(t) / float64(g.cfg.Pace)
+			tof -= g.cfg.DepthMM * (1 - math.Cos(phase)) / 2
+			motion = math.Sin(phase)
+		}
+	case firmware.StateEndHold:
+		if g.cfg.FidgetAtEnd {
+			tof += fidgetMM * math.Sin(2*math.Pi*float64(ms)/700)
+		}
+	}
+
+	return Reading{
+		TofMM: tof + g.rng.NormFloat64()*g.cfg.NoiseMM,
+		AX:    -0.15 + 0.01*g.rng.NormFloat64(),
+		AY:    0.15 + 0.01*g.rng.NormFloat64(),
+		AZ:    -0.96 + 0.08*motion + 0.01*g.rng.NormFloat64(),
+		GX:    25*motion + 0.5*g.rng.NormFloat64(),
+		GY:    0.5 * g.rng.NormFloat64(),
+		GZ:    0.5 * g.rng.NormFloat64(),
+	}
+}
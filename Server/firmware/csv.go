@@ -0,0 +1,74 @@
+package firmware
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// HostTimeLayout is how host loggers write host_ts: Python's datetime.isoformat(),
+// local time without a zone. Parsing accepts any number of fractional digits.
+const HostTimeLayout = "2006-01-02T15:04:05.000000"
+
+// EventsHeader is the header row of a sessionN.events.csv file.
+var EventsHeader = []string{"host_ts", "device_ts_ms", "event", "value", "state"}
+
+// ReadEventsCSV reads a data/sessionN.events.csv file into typed events. Unlike
+// prepare.ReadEventsCSV, which is lenient like pandas, every field must parse.
+func ReadEventsCSV(r io.Reader) ([]Event, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: events CSV without a header", ErrMalformed)
+	}
+
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		idx[h] = i
+	}
+	for _, col := range EventsHeader {
+		if _, ok := idx[col]; !ok {
+			return nil, fmt.Errorf("%w: events CSV missing column %q", ErrMalformed, col)
+		}
+	}
+
+	var events []Event
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ev := Event{Name: EventName(rec[idx["event"]]), Value: math.NaN(), State: State(rec[idx["state"]])}
+
+		if raw := rec[idx["host_ts"]]; raw != "" {
+			ev.HostTime, err = time.ParseInLocation("2006-01-02T15:04:05.999999999", raw, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%w: row %d: invalid host_ts %q", ErrMalformed, row, raw)
+			}
+		}
+
+		ev.DeviceMS, err = strconv.ParseInt(rec[idx["device_ts_ms"]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d: invalid device_ts_ms %q", ErrMalformed, row, rec[idx["device_ts_ms"]])
+		}
+
+		if raw := rec[idx["value"]]; raw != "" {
+			ev.Value, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: row %d: invalid value %q", ErrMalformed, row, raw)
+			}
+		}
+
+		if ev.Name == "" {
+			return nil, fmt.Errorf("%w: row %d: event without a name", ErrMalformed, row)
+		}
+		events = append(events, ev)
+	}
+}
@@ -0,0 +1,252 @@
+package firmware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A sample frame is a compact binary form of a recorded set, for devices that can't
+// afford to upload JSON or CSV. Version 1, all integers little-endian:
+//
+//	offset  size  field
+//	0       2     magic "PF"
+//	2       1     version, 1
+//	3       1     flags, 0 (reserved)
+//	4       4     t0: device ms of the first sample, uint32 like millis()
+//	8       2     sample count N, uint16
+//	10      2     event count M, uint16
+//	12            N samples, then M events
+//
+// Each sample is
+//
+//	uvarint  ms since the previous sample (since t0 for the first)
+//	int16    tof_mm
+//	int16×3  ax, ay, az in 1/4096 g      (±8 g)
+//	int16×3  gx, gy, gz in 1/16 dps      (±2048 dps)
+//
+// which is 15 bytes at the firmware's 100 ms pace. Each event is
+//
+//	varint   ms from t0, zigzag encoded: arming comes before the first sample
+//	uint8    event code; bit 7 set means a value follows
+//	uint8    state code
+//	float32  value, when bit 7 of the code is set
+//
+// Codes are indexes into frameEvents and frameStates, which only ever grow. Metadata
+// such as the scope travels outside the frame, e.g. in the query string.
+const (
+	FrameContentType = "application/vnd.pressle.frame"
+	FrameVersion     = 1
+
+	// FrameAccelScale and FrameGyroScale are how many frame units make one g and one dps.
+	FrameAccelScale = 4096
+	FrameGyroScale  = 16
+)
+
+var frameMagic = [2]byte{'P', 'F'}
+
+var (
+	ErrFrameMalformed = errors.New("malformed sample frame")
+	ErrFrameVersion   = errors.New("unsupported sample frame version")
+)
+
+const (
+	frameHeaderLen = 12
+	frameValueBit  = 0x80
+	maxFrameCount  = math.MaxUint16
+)
+
+var frameEvents = []EventName{
+	EventStartCmd,
+	EventArmingStart,
+	EventHoldStill,
+	EventBaselineLocked,
+	EventCountdownStart,
+	EventRecordingStart,
+	EventStopCmd,
+	EventEndHoldStart,
+	EventSessionStoppedClean,
+	EventSessionStoppedTimeout,
+	EventStopCmdIdle,
+	EventTofError,
+}
+
+var frameStates = []State{StateIdle, StateArming, StateCountdown, StateRecording, StateEndHold}
+
+// Frame is a decoded sample frame.
+type Frame struct {
+	Samples []Sample
+	Events  []Event
+}
+
+// EncodeFrame writes samples, which must be in time order, and events as a version 1
+// frame. IMU readings beyond the frame's range are clamped, as the sensor would.
+func EncodeFrame(samples []Sample, events []Event) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("frame needs at least one sample")
+	}
+	if len(samples) > maxFrameCount || len(events) > maxFrameCount {
+		return nil, errors.New("too many samples or events for one frame")
+	}
+	t0 := samples[0].DeviceMS
+	if t0 < 0 || t0 > math.MaxUint32 {
+		return nil, fmt.Errorf("first sample time %d does not fit in a uint32", t0)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, frameHeaderLen+len(samples)*15+len(events)*8))
+	buf.Write(frameMagic[:])
+	buf.WriteByte(FrameVersion)
+	buf.WriteByte(0)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(t0)))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(samples))))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(events))))
+
+	prev := t0
+	for i, s := range samples {
+		if s.DeviceMS < prev {
+			return nil, fmt.Errorf("sample %d is earlier than the one before it", i)
+		}
+		buf.Write(binary.AppendUvarint(nil, uint64(s.DeviceMS-prev)))
+		prev = s.DeviceMS
+
+		for _, v := range []float64{
+			s.TofMM,
+			s.AX * FrameAccelScale, s.AY * FrameAccelScale, s.AZ * FrameAccelScale,
+			s.GX * FrameGyroScale, s.GY * FrameGyroScale, s.GZ * FrameGyroScale,
+		} {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(clampInt16(v))))
+		}
+	}
+
+	for i, ev := range events {
+		name := frameCode(frameEvents, ev.Name)
+		state := frameCode(frameStates, ev.State)
+		if name < 0 || state < 0 {
+			return nil, fmt.Errorf("event %d: %s in %s has no frame code", i, ev.Name, ev.State)
+		}
+		code := byte(name)
+		if ev.HasValue() {
+			code |= frameValueBit
+		}
+
+		buf.Write(binary.AppendVarint(nil, ev.DeviceMS-t0))
+		buf.WriteByte(code)
+		buf.WriteByte(byte(state))
+		if ev.HasValue() {
+			buf.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(ev.Value))))
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeFrame reads a frame. Samples and events come back as the serial parser would
+// produce them, with values at the frame's resolution.
+func DecodeFrame(b []byte) (Frame, error) {
+	if len(b) < frameHeaderLen || b[0] != frameMagic[0] || b[1] != frameMagic[1] {
+		return Frame{}, fmt.Errorf("%w: bad magic", ErrFrameMalformed)
+	}
+	if b[2] != FrameVersion {
+		return Frame{}, fmt.Errorf("%w: %d", ErrFrameVersion, b[2])
+	}
+	if b[3] != 0 {
+		return Frame{}, fmt.Errorf("%w: unknown frame flags %#x", ErrFrameMalformed, b[3])
+	}
+
+	t0 := int64(binary.LittleEndian.Uint32(b[4:]))
+	nSamples := int(binary.LittleEndian.Uint16(b[8:]))
+	nEvents := int(binary.LittleEndian.Uint16(b[10:]))
+	r := bytes.NewReader(b[frameHeaderLen:])
+
+	malformed := func(what string, i int, err error) error {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%w: %s %d: %v", ErrFrameMalformed, what, i, err)
+	}
+
+	f := Frame{Samples: make([]Sample, 0, nSamples), Events: make([]Event, 0, nEvents)}
+	t := t0
+	var vals [7]int16
+	for i := 0; i < nSamples; i++ {
+		dt, err := binary.ReadUvarint(r)
+		if err == nil && dt > math.MaxUint32 {
+			err = errors.New("time step out of range")
+		}
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, &vals)
+		}
+		if err != nil {
+			return Frame{}, malformed("sample", i, err)
+		}
+		t += int64(dt)
+
+		f.Samples = append(f.Samples, Sample{
+			DeviceMS: t,
+			TofMM:    float64(vals[0]),
+			AX:       float64(vals[1]) / FrameAccelScale,
+			AY:       float64(vals[2]) / FrameAccelScale,
+			AZ:       float64(vals[3]) / FrameAccelScale,
+			GX:       float64(vals[4]) / FrameGyroScale,
+			GY:       float64(vals[5]) / FrameGyroScale,
+			GZ:       float64(vals[6]) / FrameGyroScale,
+		})
+	}
+
+	for i := 0; i < nEvents; i++ {
+		offset, err := binary.ReadVarint(r)
+		var codes [2]byte
+		if err == nil {
+			_, err = io.ReadFull(r, codes[:])
+		}
+		if err != nil {
+			return Frame{}, malformed("event", i, err)
+		}
+
+		name, state := int(codes[0]&^frameValueBit), int(codes[1])
+		if name >= len(frameEvents) || state >= len(frameStates) {
+			return Frame{}, malformed("event", i, fmt.Errorf("unknown codes %d/%d", name, state))
+		}
+
+		ev := Event{DeviceMS: t0 + offset, Name: frameEvents[name], State: frameStates[state], Value: math.NaN()}
+		if codes[0]&frameValueBit != 0 {
+			var bits uint32
+			if err := binary.Read(r, binary.LittleEndian, &bits); err != nil {
+				return Frame{}, malformed("event", i, err)
+			}
+			// float32 values print back the way the firmware's two decimals did.
+			ev.Value = math.Round(float64(math.Float32frombits(bits))*100) / 100
+		}
+		f.Events = append(f.Events, ev)
+	}
+
+	if r.Len() != 0 {
+		return Frame{}, fmt.Errorf("%w: %d bytes after the last event", ErrFrameMalformed, r.Len())
+	}
+	return f, nil
+}
+
+func frameCode[T comparable](codes []T, v T) int {
+	for i, c := range codes {
+		if c == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func clampInt16(v float64) int16 {
+	v = math.Round(v)
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(v)
+}
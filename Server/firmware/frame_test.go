@@ -0,0 +1,165 @@
+package firmware
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// frameStream is a short set as the firmware prints it.
+const frameStream = `EVENT,145181,START_CMD,ARMING
+EVENT,145182,ARMING_START,ARMING
+EVENT,147195,BASELINE_LOCKED_MM,412.60,ARMING
+EVENT,147196,COUNTDOWN_START,COUNTDOWN
+EVENT,152295,RECORDING_START,RECORDING
+152396,410.00,-0.2432,-0.0702,-1.0282,4.2114,15.2588,-5.5542
+152495,300.00,-0.2822,0.2039,-1.2094,3.6011,11.7187,-6.6528
+152595,117.00,-0.2394,0.0574,-1.4575,2.8076,-7.9956,-3.1738
+152695,390.00,-0.2070,-0.0425,-1.1967,-6.4697,-21.7285,6.3477
+EVENT,152700,STOP_CMD,RECORDING
+152795,405.00,-0.2070,-0.0425,-1.1967,-6.4697,-21.7285,6.3477
+EVENT,152796,END_HOLD_START,END_HOLD
+EVENT,154895,SESSION_STOPPED_CLEAN_SPAN_MM,23.25,END_HOLD
+`
+
+func parseFrameStream(t *testing.T) ([]Sample, []Event) {
+	t.Helper()
+	var samples []Sample
+	var events []Event
+	for _, raw := range strings.Split(strings.TrimSpace(frameStream), "\n") {
+		line, err := ParseLine(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch line.Kind {
+		case LineSample:
+			samples = append(samples, line.Sample)
+		case LineEvent:
+			events = append(events, line.Event)
+		}
+	}
+	return samples, events
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	samples, events := parseFrameStream(t)
+
+	b, err := EncodeFrame(samples, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 12 header bytes and 15 per sample; events are 4 bytes, 8 with a value.
+	if want := 12 + 15*len(samples) + 4*len(events) + 4*2; len(b) != want {
+		t.Fatalf("frame is %d bytes; want %d", len(b), want)
+	}
+
+	f, err := DecodeFrame(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Samples) != len(samples) || len(f.Events) != len(events) {
+		t.Fatalf("decoded %d samples and %d events", len(f.Samples), len(f.Events))
+	}
+
+	for i, got := range f.Samples {
+		want := samples[i]
+		if got.DeviceMS != want.DeviceMS || got.TofMM != want.TofMM {
+			t.Fatalf("sample %d: %+v; want %+v", i, got, want)
+		}
+		for j, pair := range [][2]float64{
+			{got.AX, want.AX}, {got.AY, want.AY}, {got.AZ, want.AZ},
+		} {
+			if math.Abs(pair[0]-pair[1]) > 0.5/FrameAccelScale {
+				t.Fatalf("sample %d accel %d: %v; want %v", i, j, pair[0], pair[1])
+			}
+		}
+		for j, pair := range [][2]float64{
+			{got.GX, want.GX}, {got.GY, want.GY}, {got.GZ, want.GZ},
+		} {
+			if math.Abs(pair[0]-pair[1]) > 0.5/FrameGyroScale {
+				t.Fatalf("sample %d gyro %d: %v; want %v", i, j, pair[0], pair[1])
+			}
+		}
+	}
+
+	for i, got := range f.Events {
+		want := events[i]
+		if got.DeviceMS != want.DeviceMS || got.Name != want.Name || got.State != want.State || got.HasValue() != want.HasValue() {
+			t.Fatalf("event %d: %+v; want %+v", i, got, want)
+		}
+		if want.HasValue() && got.Value != want.Value {
+			t.Fatalf("event %d value %v; want %v", i, got.Value, want.Value)
+		}
+	}
+}
+
+func TestFrameIsCompact(t *testing.T) {
+	samples, events := parseFrameStream(t)
+	b, err := EncodeFrame(samples, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asJSON, _ := json.Marshal(samples)
+	if len(b)*5 > len(asJSON) {
+		t.Fatalf("frame is %d bytes, JSON %d", len(b), len(asJSON))
+	}
+}
+
+func TestFrameClampsIMU(t *testing.T) {
+	b, err := EncodeFrame([]Sample{{DeviceMS: 10, TofMM: 400, AZ: -12, GX: 4000}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := DecodeFrame(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Samples[0]; s.AZ != math.MinInt16/float64(FrameAccelScale) || s.GX != math.MaxInt16/float64(FrameGyroScale) {
+		t.Fatalf("sample %+v; want clamped to the frame's range", s)
+	}
+}
+
+func TestEncodeFrameRejects(t *testing.T) {
+	if _, err := EncodeFrame(nil, nil); err == nil {
+		t.Fatal("empty frame encoded")
+	}
+	if _, err := EncodeFrame([]Sample{{DeviceMS: 200}, {DeviceMS: 100}}, nil); err == nil {
+		t.Fatal("out-of-order samples encoded")
+	}
+	if _, err := EncodeFrame([]Sample{{DeviceMS: 200}}, []Event{{Name: "REBOOT", State: StateIdle, Value: math.NaN()}}); err == nil {
+		t.Fatal("unknown event encoded")
+	}
+}
+
+func TestDecodeFrameMalformed(t *testing.T) {
+	samples, events := parseFrameStream(t)
+	good, err := EncodeFrame(samples, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version2 := append([]byte(nil), good...)
+	version2[2] = 2
+	if _, err := DecodeFrame(version2); !errors.Is(err, ErrFrameVersion) {
+		t.Fatalf("version 2: %v", err)
+	}
+
+	badCode := append([]byte(nil), good...)
+	badCode[len(badCode)-6] = 0x7f // the last event's code byte
+	cases := map[string][]byte{
+		"empty":          nil,
+		"bad magic":      append([]byte("XX"), good[2:]...),
+		"flags":          append(append([]byte(nil), good[:3]...), append([]byte{1}, good[4:]...)...),
+		"truncated":      good[:len(good)-3],
+		"trailing bytes": append(append([]byte(nil), good...), 0),
+		"unknown event":  badCode,
+	}
+	for name, b := range cases {
+		if _, err := DecodeFrame(b); !errors.Is(err, ErrFrameMalformed) {
+			t.Errorf("%s: %v; want ErrFrameMalformed", name, err)
+		}
+	}
+}
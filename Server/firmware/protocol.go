@@ -0,0 +1,185 @@
+// Package firmware reads the serial output of the Pressle sensor (Hardware/src/main.cpp).
+//
+// The firmware prints, one per line:
+//
+//	EVENT,<ms>,<name>,<state>           an event without a value
+//	EVENT,<ms>,<name>,<value>,<state>   an event with a value, e.g. BASELINE_LOCKED_MM
+//	timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz
+//	RECORDING                           after the header, once per session
+//	<ms>,<tof>,<ax>,<ay>,<az>,<gx>,<gy>,<gz>
+//	STOPPED                             the session is over and the device is IDLE
+//
+// plus free-form status text from setup() such as "Ranging started".
+package firmware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the CSV header the firmware prints before the first sample of a session.
+const Header = "timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz"
+
+// Serial commands the firmware accepts.
+const (
+	CommandStart = "start"
+	CommandStop  = "stop"
+)
+
+var ErrMalformed = errors.New("malformed firmware line")
+
+// LineKind says what a line of serial output is.
+type LineKind int
+
+const (
+	LineText      LineKind = iota // banner or status text, ignored
+	LineEvent                     // EVENT,...
+	LineHeader                    // the sample CSV header
+	LineRecording                 // RECORDING marker
+	LineStopped                   // STOPPED marker
+	LineSample                    // a sample row
+)
+
+func (k LineKind) String() string {
+	switch k {
+	case LineEvent:
+		return "event"
+	case LineHeader:
+		return "header"
+	case LineRecording:
+		return "recording"
+	case LineStopped:
+		return "stopped"
+	case LineSample:
+		return "sample"
+	default:
+		return "text"
+	}
+}
+
+// Event is one EVENT line. Value is NaN when the event has none.
+// HostTime is when a host logger received it, zero otherwise.
+type Event struct {
+	HostTime time.Time
+	DeviceMS int64
+	Name     EventName
+	Value    float64
+	State    State
+}
+
+// HasValue reports whether the event carried a value.
+func (e Event) HasValue() bool { return !math.IsNaN(e.Value) }
+
+// Sample is one sample row. ToF is in millimetres, acceleration in g and rotation in dps.
+type Sample struct {
+	HostTime time.Time
+	DeviceMS int64
+	TofMM    float64
+	AX       float64
+	AY       float64
+	AZ       float64
+	GX       float64
+	GY       float64
+	GZ       float64
+}
+
+// Line is one parsed line of serial output. Event or Sample is set to match Kind.
+type Line struct {
+	Kind   LineKind
+	Text   string
+	Event  Event
+	Sample Sample
+}
+
+// ParseLine classifies and parses one line of serial output. Lines that aren't part of
+// the protocol come back as LineText; an EVENT or sample line that doesn't parse is an error.
+// Event names and states aren't checked against the firmware's; that is Validator's job.
+func ParseLine(raw string) (Line, error) {
+	text := strings.TrimSpace(raw)
+	line := Line{Kind: LineText, Text: text}
+
+	switch {
+	case text == "RECORDING":
+		line.Kind = LineRecording
+		return line, nil
+	case text == "STOPPED":
+		line.Kind = LineStopped
+		return line, nil
+	case text == Header:
+		line.Kind = LineHeader
+		return line, nil
+	}
+
+	parts := strings.Split(text, ",")
+	if parts[0] == "EVENT" {
+		ev, err := parseEvent(parts)
+		if err != nil {
+			return Line{}, err
+		}
+		line.Kind = LineEvent
+		line.Event = ev
+		return line, nil
+	}
+
+	// Sample rows are the only other comma-separated output and always start with a number.
+	if len(parts) != 8 || !startsWithDigit(parts[0]) {
+		return line, nil
+	}
+	s, err := parseSample(parts)
+	if err != nil {
+		return Line{}, err
+	}
+	line.Kind = LineSample
+	line.Sample = s
+	return line, nil
+}
+
+// parseEvent accepts EVENT,ts,name,state and EVENT,ts,name,value,state.
+func parseEvent(parts []string) (Event, error) {
+	if len(parts) != 4 && len(parts) != 5 {
+		return Event{}, fmt.Errorf("%w: EVENT needs 4 or 5 fields", ErrMalformed)
+	}
+
+	ms, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: invalid event timestamp %q", ErrMalformed, parts[1])
+	}
+
+	ev := Event{DeviceMS: ms, Name: EventName(parts[2]), Value: math.NaN(), State: State(parts[len(parts)-1])}
+	if ev.Name == "" {
+		return Event{}, fmt.Errorf("%w: event without a name", ErrMalformed)
+	}
+	if len(parts) == 5 {
+		v, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("%w: invalid event value %q", ErrMalformed, parts[3])
+		}
+		ev.Value = v
+	}
+	return ev, nil
+}
+
+func parseSample(parts []string) (Sample, error) {
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("%w: invalid sample timestamp %q", ErrMalformed, parts[0])
+	}
+
+	var v [7]float64
+	for i := range v {
+		v[i], err = strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return Sample{}, fmt.Errorf("%w: invalid sample value %q", ErrMalformed, parts[i+1])
+		}
+	}
+
+	return Sample{DeviceMS: ms, TofMM: v[0], AX: v[1], AY: v[2], AZ: v[3], GX: v[4], GY: v[5], GZ: v[6]}, nil
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
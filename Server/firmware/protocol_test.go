@@ -0,0 +1,65 @@
+package firmware
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		raw  string
+		kind LineKind
+	}{
+		{"Pressle sensor logger", LineText},
+		{"Type: start / stop", LineText},
+		{"", LineText},
+		{"EVENT,167862,START_CMD,ARMING", LineEvent},
+		{"EVENT,171976,BASELINE_LOCKED_MM,427.08,ARMING\r", LineEvent},
+		{Header, LineHeader},
+		{"RECORDING", LineRecording},
+		{"STOPPED", LineStopped},
+		{"177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831", LineSample},
+		{"-1,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831", LineText},
+	}
+
+	for _, tt := range tests {
+		line, err := ParseLine(tt.raw)
+		if err != nil {
+			t.Fatalf("ParseLine(%q): %v", tt.raw, err)
+		}
+		if line.Kind != tt.kind {
+			t.Errorf("ParseLine(%q) kind = %s; want %s", tt.raw, line.Kind, tt.kind)
+		}
+	}
+}
+
+func TestParseLineValues(t *testing.T) {
+	line, _ := ParseLine("EVENT,171976,BASELINE_LOCKED_MM,427.08,ARMING")
+	if ev := line.Event; ev.DeviceMS != 171976 || ev.Name != "BASELINE_LOCKED_MM" || ev.Value != 427.08 || ev.State != "ARMING" {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	line, _ = ParseLine("EVENT,167862,START_CMD,ARMING")
+	if line.Event.HasValue() {
+		t.Fatalf("START_CMD has value %v", line.Event.Value)
+	}
+
+	line, _ = ParseLine("177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831")
+	if s := line.Sample; s.DeviceMS != 177177 || s.TofMM != 416 || s.AZ != -0.9674 || s.GZ != -0.1831 {
+		t.Fatalf("sample = %+v", s)
+	}
+}
+
+func TestParseLineMalformed(t *testing.T) {
+	for _, raw := range []string{
+		"EVENT,abc,START_CMD,ARMING",
+		"EVENT,1,START_CMD",
+		"EVENT,1,,ARMING",
+		"EVENT,1,BASELINE_LOCKED_MM,x,ARMING",
+		"177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,oops",
+	} {
+		if _, err := ParseLine(raw); !errors.Is(err, ErrMalformed) {
+			t.Errorf("ParseLine(%q) err = %v; want ErrMalformed", raw, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package firmware
+
+import "time"
+
+// State is the firmware's state machine state, as printed in the last field of EVENT lines.
+type State string
+
+const (
+	StateIdle      State = "IDLE"
+	StateArming    State = "ARMING"
+	StateCountdown State = "COUNTDOWN"
+	StateRecording State = "RECORDING"
+	StateEndHold   State = "END_HOLD"
+)
+
+// Known reports whether s is one of the firmware's states.
+func (s State) Known() bool {
+	switch s {
+	case StateIdle, StateArming, StateCountdown, StateRecording, StateEndHold:
+		return true
+	}
+	return false
+}
+
+// EventName is the name field of an EVENT line.
+type EventName string
+
+const (
+	EventStartCmd              EventName = "START_CMD"
+	EventArmingStart           EventName = "ARMING_START"
+	EventHoldStill             EventName = "HOLD_STILL_SPAN_MM"
+	EventBaselineLocked        EventName = "BASELINE_LOCKED_MM"
+	EventCountdownStart        EventName = "COUNTDOWN_START"
+	EventRecordingStart        EventName = "RECORDING_START"
+	EventStopCmd               EventName = "STOP_CMD"
+	EventEndHoldStart          EventName = "END_HOLD_START"
+	EventSessionStoppedClean   EventName = "SESSION_STOPPED_CLEAN_SPAN_MM"
+	EventSessionStoppedTimeout EventName = "SESSION_STOPPED_TIMEOUT_SPAN_MM"
+	EventStopCmdIdle           EventName = "STOP_CMD_IDLE"
+	EventTofError              EventName = "TOF_ERROR"
+)
+
+// Known reports whether n is an event the firmware emits.
+func (n EventName) Known() bool {
+	_, ok := eventRules[n]
+	return ok
+}
+
+// HasValue reports whether the firmware prints a value with this event.
+func (n EventName) HasValue() bool {
+	return eventRules[n].value
+}
+
+// Timing of the firmware state machine, from the constants in main.cpp.
+const (
+	SampleInterval  = 100 * time.Millisecond
+	ArmingDuration  = 2 * time.Second
+	CountdownLength = 5 * time.Second
+	SessionLimit    = 60 * time.Second
+	EndHoldDuration = 2 * time.Second
+	EndHoldTimeout  = 5 * time.Second
+	StableRangeMM   = 25.0
+	TofEMAAlpha     = 0.30
+)
+
+// eventRule says where an event may appear and what it does to the state machine.
+type eventRule struct {
+	// from lists the states the device can be in when it emits the event; nil means any.
+	from []State
+	// reports is the state printed on the line, which is the state after any transition
+	// the event announces. Empty means the current state, unchanged.
+	reports State
+	// value is whether the event carries a value.
+	value bool
+}
+
+// eventRules mirrors emitEvent and emitEventValue in main.cpp.
+var eventRules = map[EventName]eventRule{
+	// start is accepted in any state and restarts arming.
+	EventStartCmd:       {from: nil, reports: StateArming},
+	EventArmingStart:    {from: []State{StateArming}, reports: StateArming},
+	EventHoldStill:      {from: []State{StateArming}, reports: StateArming, value: true},
+	EventBaselineLocked: {from: []State{StateArming}, reports: StateArming, value: true},
+	EventCountdownStart: {from: []State{StateArming}, reports: StateCountdown},
+	EventRecordingStart: {from: []State{StateCountdown}, reports: StateRecording},
+	// STOP_CMD only requests the stop; END_HOLD begins after the next sample.
+	EventStopCmd:               {from: []State{StateRecording}, reports: StateRecording},
+	EventEndHoldStart:          {from: []State{StateRecording}, reports: StateEndHold},
+	EventSessionStoppedClean:   {from: []State{StateEndHold}, reports: StateEndHold, value: true},
+	EventSessionStoppedTimeout: {from: []State{StateEndHold}, reports: StateEndHold, value: true},
+	EventStopCmdIdle:           {from: []State{StateIdle, StateArming, StateCountdown, StateEndHold}, reports: StateIdle},
+	// TOF_ERROR comes from sampling, which only runs outside IDLE.
+	EventTofError: {from: []State{StateArming, StateCountdown, StateRecording, StateEndHold}, value: true},
+}
+
+func (r eventRule) allowed(s State) bool {
+	if r.from == nil {
+		return true
+	}
+	for _, f := range r.from {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
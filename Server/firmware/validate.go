@@ -0,0 +1,202 @@
+package firmware
+
+import (
+	"fmt"
+	"time"
+)
+
+// ViolationCode names a kind of protocol violation.
+type ViolationCode string
+
+const (
+	ViolationUnknownEvent     ViolationCode = "unknown_event"
+	ViolationTransition       ViolationCode = "transition"         // event not allowed in the current state
+	ViolationReportedState    ViolationCode = "reported_state"     // the line's state field disagrees with the state machine
+	ViolationValue            ViolationCode = "value"              // value missing, or present where none belongs
+	ViolationNoBaseline       ViolationCode = "no_baseline"        // countdown or recording without BASELINE_LOCKED_MM
+	ViolationSampleOutside    ViolationCode = "sample_outside"     // sample row outside RECORDING
+	ViolationSampleBeforeMark ViolationCode = "sample_before_mark" // sample row before the header and RECORDING marker
+	ViolationMarker           ViolationCode = "marker"             // header, RECORDING or STOPPED out of place
+	ViolationClock            ViolationCode = "clock"              // device timestamp went backwards
+	ViolationTiming           ViolationCode = "timing"             // a phase was shorter or longer than the firmware allows
+	ViolationUnfinished       ViolationCode = "unfinished"         // the stream ended mid-session
+)
+
+// Violation is one way a stream broke the protocol. Line is the 1-based position in the
+// stream of the offending line, or 0 for problems found at the end.
+type Violation struct {
+	Line    int
+	State   State
+	Code    ViolationCode
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Line == 0 {
+		return fmt.Sprintf("end of stream (%s): %s", v.State, v.Message)
+	}
+	return fmt.Sprintf("line %d (%s): %s", v.Line, v.State, v.Message)
+}
+
+// Validator checks a stream of lines against the firmware state machine,
+// IDLE → ARMING → COUNTDOWN → RECORDING → END_HOLD → IDLE. It assumes the stream starts
+// with the device idle. After a violation it follows the device rather than its own
+// expectation, so one bad line doesn't cascade into a violation on every line after it.
+type Validator struct {
+	state    State
+	line     int
+	lastMS   int64
+	haveTime bool
+
+	baselineLocked   bool
+	baselineReported bool
+	headerSeen       bool
+	markerSeen       bool
+	stopPending      bool // a stop event was seen and STOPPED may follow
+	phaseMS          int64
+}
+
+func NewValidator() *Validator {
+	return &Validator{state: StateIdle}
+}
+
+// State is where the validator believes the device is.
+func (v *Validator) State() State { return v.state }
+
+// Check validates the next line and returns any violations it causes.
+func (v *Validator) Check(line Line) []Violation {
+	v.line++
+
+	var out []Violation
+	report := func(code ViolationCode, format string, args ...any) {
+		out = append(out, Violation{Line: v.line, State: v.state, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch line.Kind {
+	case LineEvent:
+		v.checkClock(line.Event.DeviceMS, report)
+		v.checkEvent(line.Event, report)
+
+	case LineHeader:
+		if v.state != StateRecording || v.headerSeen {
+			report(ViolationMarker, "sample header out of place")
+		}
+		v.headerSeen = true
+
+	case LineRecording:
+		if v.state != StateRecording || !v.headerSeen || v.markerSeen {
+			report(ViolationMarker, "RECORDING marker out of place")
+		}
+		v.markerSeen = true
+
+	case LineSample:
+		v.checkClock(line.Sample.DeviceMS, report)
+		switch {
+		case v.state != StateRecording:
+			report(ViolationSampleOutside, "sample outside RECORDING")
+		case !v.markerSeen:
+			report(ViolationSampleBeforeMark, "sample before the header and RECORDING marker")
+		}
+
+	case LineStopped:
+		if !v.stopPending {
+			report(ViolationMarker, "STOPPED without a stop event")
+		}
+		v.stopPending = false
+		v.state = StateIdle
+	}
+	return out
+}
+
+// Finish reports what's wrong with the stream ending here.
+func (v *Validator) Finish() []Violation {
+	if v.state == StateIdle {
+		return nil
+	}
+	return []Violation{{State: v.state, Code: ViolationUnfinished, Message: fmt.Sprintf("stream ended in %s", v.state)}}
+}
+
+func (v *Validator) checkClock(ms int64, report func(ViolationCode, string, ...any)) {
+	if v.haveTime && ms < v.lastMS {
+		report(ViolationClock, "device time went from %d to %d ms", v.lastMS, ms)
+	}
+	v.lastMS, v.haveTime = ms, true
+}
+
+func (v *Validator) checkEvent(ev Event, report func(ViolationCode, string, ...any)) {
+	rule, ok := eventRules[ev.Name]
+	if !ok {
+		report(ViolationUnknownEvent, "unknown event %q", ev.Name)
+		return
+	}
+
+	if !rule.allowed(v.state) {
+		report(ViolationTransition, "%s in %s", ev.Name, v.state)
+	}
+	if rule.value != ev.HasValue() {
+		if rule.value {
+			report(ViolationValue, "%s without a value", ev.Name)
+		} else {
+			report(ViolationValue, "%s with a value", ev.Name)
+		}
+	}
+
+	// The device is the authority on its own state: follow the event, then compare.
+	next := rule.reports
+	if next == "" {
+		next = v.state
+	}
+	if ev.State != next {
+		report(ViolationReportedState, "%s reported %q; expected %s", ev.Name, ev.State, next)
+	}
+
+	switch ev.Name {
+	case EventStartCmd:
+		v.baselineLocked, v.baselineReported = false, false
+		v.headerSeen, v.markerSeen, v.stopPending = false, false, false
+		v.phaseMS = ev.DeviceMS
+
+	case EventBaselineLocked:
+		v.baselineLocked = true
+
+	case EventCountdownStart, EventRecordingStart:
+		if !v.baselineLocked && !v.baselineReported {
+			report(ViolationNoBaseline, "%s without %s", ev.Name, EventBaselineLocked)
+			v.baselineReported = true
+		}
+		if ev.Name == EventRecordingStart && v.state == StateCountdown {
+			if d := msBetween(v.phaseMS, ev.DeviceMS); d < CountdownLength {
+				report(ViolationTiming, "countdown lasted %v; the firmware counts down %v", d, CountdownLength)
+			}
+		}
+		v.headerSeen, v.markerSeen = false, false
+		v.phaseMS = ev.DeviceMS
+
+	case EventEndHoldStart:
+		// The sample that crosses the limit is printed before END_HOLD starts.
+		if d := msBetween(v.phaseMS, ev.DeviceMS); v.state == StateRecording && d > SessionLimit+SampleInterval {
+			report(ViolationTiming, "recording lasted %v; the firmware stops at %v", d, SessionLimit)
+		}
+		v.phaseMS = ev.DeviceMS
+
+	case EventSessionStoppedClean, EventSessionStoppedTimeout, EventStopCmdIdle:
+		v.stopPending = true
+		next = StateIdle
+	}
+	v.state = next
+}
+
+func msBetween(from, to int64) time.Duration {
+	return time.Duration(to-from) * time.Millisecond
+}
+
+// ValidateEvents checks a session's events on their own, as in a sessionN.events.csv file.
+// Lines are numbered from the first event, so Line matches the row after the header.
+func ValidateEvents(events []Event) []Violation {
+	v := NewValidator()
+	var out []Violation
+	for _, ev := range events {
+		out = append(out, v.Check(Line{Kind: LineEvent, Event: ev})...)
+	}
+	return append(out, v.Finish()...)
+}
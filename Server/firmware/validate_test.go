@@ -0,0 +1,166 @@
+package firmware
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const cleanSession = `Pressle sensor logger
+EVENT,167862,START_CMD,ARMING
+EVENT,167862,ARMING_START,ARMING
+EVENT,169876,HOLD_STILL_SPAN_MM,140.75,ARMING
+EVENT,171976,BASELINE_LOCKED_MM,427.08,ARMING
+EVENT,171976,COUNTDOWN_START,COUNTDOWN
+EVENT,176977,RECORDING_START,RECORDING
+timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz
+RECORDING
+177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831
+EVENT,177200,STOP_CMD,RECORDING
+177276,414.00,-0.1514,0.1682,-0.9453,0.1221,-2.2583,-2.1362
+EVENT,177276,END_HOLD_START,END_HOLD
+EVENT,179400,SESSION_STOPPED_CLEAN_SPAN_MM,12.50,END_HOLD
+STOPPED
+EVENT,180000,STOP_CMD_IDLE,IDLE
+STOPPED`
+
+func validateStream(t *testing.T, stream string) []Violation {
+	t.Helper()
+
+	v := NewValidator()
+	var out []Violation
+	for _, raw := range strings.Split(stream, "\n") {
+		line, err := ParseLine(raw)
+		if err != nil {
+			t.Fatalf("ParseLine(%q): %v", raw, err)
+		}
+		out = append(out, v.Check(line)...)
+	}
+	return append(out, v.Finish()...)
+}
+
+func violationCodes(vs []Violation) []ViolationCode {
+	codes := make([]ViolationCode, len(vs))
+	for i, v := range vs {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestValidatorCleanSession(t *testing.T) {
+	if vs := validateStream(t, cleanSession); len(vs) != 0 {
+		t.Fatalf("violations: %v", vs)
+	}
+}
+
+func TestValidatorViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []ViolationCode
+	}{
+		{
+			name:   "sample while idle",
+			stream: "177177,416.00,-0.1593,0.1426,-0.9674,0.7935,1.2207,-0.1831",
+			want:   []ViolationCode{ViolationSampleOutside},
+		},
+		{
+			name: "countdown without baseline",
+			stream: "EVENT,0,START_CMD,ARMING\nEVENT,0,ARMING_START,ARMING\n" +
+				"EVENT,2000,COUNTDOWN_START,COUNTDOWN\nEVENT,7000,RECORDING_START,RECORDING",
+			want: []ViolationCode{ViolationNoBaseline, ViolationUnfinished},
+		},
+		{
+			name:   "recording skips countdown",
+			stream: "EVENT,0,START_CMD,ARMING\nEVENT,2000,BASELINE_LOCKED_MM,400.00,ARMING\nEVENT,2000,RECORDING_START,RECORDING",
+			want:   []ViolationCode{ViolationTransition, ViolationUnfinished},
+		},
+		{
+			name: "sample before marker",
+			stream: "EVENT,0,START_CMD,ARMING\nEVENT,2000,BASELINE_LOCKED_MM,400.00,ARMING\n" +
+				"EVENT,2000,COUNTDOWN_START,COUNTDOWN\nEVENT,7000,RECORDING_START,RECORDING\n" +
+				"7100,416.00,0,0,0,0,0,0",
+			want: []ViolationCode{ViolationSampleBeforeMark, ViolationUnfinished},
+		},
+		{
+			name:   "short countdown",
+			stream: "EVENT,0,START_CMD,ARMING\nEVENT,2000,BASELINE_LOCKED_MM,400.00,ARMING\nEVENT,2000,COUNTDOWN_START,COUNTDOWN\nEVENT,3000,RECORDING_START,RECORDING",
+			want:   []ViolationCode{ViolationTiming, ViolationUnfinished},
+		},
+		{
+			name:   "missing value and wrong state",
+			stream: "EVENT,0,START_CMD,IDLE\nEVENT,2000,BASELINE_LOCKED_MM,ARMING\nEVENT,2000,STOP_CMD_IDLE,IDLE\nSTOPPED",
+			want:   []ViolationCode{ViolationReportedState, ViolationValue},
+		},
+		{
+			name:   "clock backwards and unknown event",
+			stream: "EVENT,500,STOP_CMD_IDLE,IDLE\nSTOPPED\nEVENT,100,REBOOT,IDLE",
+			want:   []ViolationCode{ViolationClock, ViolationUnknownEvent},
+		},
+		{
+			name:   "stray markers",
+			stream: "RECORDING\nSTOPPED",
+			want:   []ViolationCode{ViolationMarker, ViolationMarker},
+		},
+	}
+
+	for _, tt := range tests {
+		got := violationCodes(validateStream(t, tt.stream))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: violations %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidatorFollowsDevice(t *testing.T) {
+	v := NewValidator()
+	line, _ := ParseLine("EVENT,0,COUNTDOWN_START,COUNTDOWN")
+	if vs := v.Check(line); len(vs) != 2 {
+		t.Fatalf("violations: %v", vs)
+	}
+	if v.State() != StateCountdown {
+		t.Fatalf("state = %s; want COUNTDOWN", v.State())
+	}
+}
+
+func TestReadEventsCSVData(t *testing.T) {
+	paths, err := filepath.Glob("../../data/*.events.csv")
+	if err != nil || len(paths) == 0 {
+		t.Skip("no data/*.events.csv files")
+	}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := ReadEventsCSV(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(events) == 0 || events[0].Name != EventStartCmd || events[0].HostTime.IsZero() {
+			t.Fatalf("%s: events = %+v", path, events)
+		}
+		if vs := ValidateEvents(events); len(vs) != 0 {
+			t.Errorf("%s: violations %v", path, vs)
+		}
+	}
+}
+
+func TestReadEventsCSVMalformed(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"host_ts,device_ts_ms,event,state\n",
+		"host_ts,device_ts_ms,event,value,state\n2026-02-13T22:52:49.269575,abc,START_CMD,,ARMING\n",
+		"host_ts,device_ts_ms,event,value,state\n2026-02-13T22:52:49.269575,1,BASELINE_LOCKED_MM,x,ARMING\n",
+		"host_ts,device_ts_ms,event,value,state\nyesterday,1,START_CMD,,ARMING\n",
+	} {
+		if _, err := ReadEventsCSV(strings.NewReader(body)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("ReadEventsCSV(%q) err = %v; want ErrMalformed", body, err)
+		}
+	}
+}
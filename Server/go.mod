@@ -6,11 +6,20 @@ require github.com/go-chi/chi/v5 v5.2.3
 
 require (
 	github.com/alexedwards/scs/v2 v2.9.0 // session management library
+	github.com/creack/pty v1.1.24 // pseudo-terminal for the device emulator
+	github.com/fxamacker/cbor/v2 v2.9.4 // CBOR bodies from devices
+	github.com/gorilla/websocket v1.5.3 // live session streaming
 	github.com/jackc/pgpassfile v1.0.0 // postgres password file parser
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // postgres service file parser
 	github.com/jackc/pgx/v5 v5.8.0 // postgres driver itself
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
+	github.com/mochi-mqtt/server/v2 v2.7.9 // embedded MQTT broker for device ingestion
+	github.com/rs/xid v1.4.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	go.bug.st/serial v1.8.0 // serial port for the sensor bridge
+	golang.org/x/crypto v0.46.0
 	golang.org/x/sync v0.19.0 // indirect
+	golang.org/x/sys v0.43.0 // indirect
+	golang.org/x/term v0.38.0 // raw mode for the emulator's pseudo-terminal
 	golang.org/x/text v0.32.0 // indirect
 )
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxReviewQueueLimit = 100
+
+// reviewQueueRow is a flagged session waiting for an admin.
+type reviewQueueRow struct {
+	SessionID    int64      `json:"sessionId"`
+	Username     string     `json:"username"`
+	Reps         int        `json:"reps"`
+	Source       string     `json:"source"`
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      *time.Time `json:"endedAt"`
+	DeviceReps   *int       `json:"deviceReps"`
+	AnomalyScore *float64   `json:"anomalyScore"`
+	Reasons      []string   `json:"reasons"`
+	HasRawData   bool       `json:"hasRawData"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type reviewDecisionRequest struct {
+	Decision string `json:"decision"` // approve or reject
+}
+
+// RegisterAdminRoutes attaches admin-only endpoints under /api.
+func RegisterAdminRoutes(r chi.Router) {
+	r.Get("/admin/reviews", handleReviewQueue)
+	r.Post("/admin/reviews/{sessionID}", handleReviewDecision)
+}
+
+// adminUserID returns the logged-in user if they are an admin, writing 401/403 otherwise.
+func adminUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	const q = `
+		SELECT is_admin
+		FROM users
+		WHERE id = $1;
+	`
+
+	var isAdmin bool
+	err := dbPool.QueryRow(r.Context(), q, userID).Scan(&isAdmin)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !isAdmin {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// handleReviewQueue lists flagged sessions, oldest first. ?limit= caps the page (default 50)
+// and ?after= is the last sessionId of the previous page.
+func handleReviewQueue(w http.ResponseWriter, r *http.Request) {
+	if _, ok := adminUserID(w, r); !ok {
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxReviewQueueLimit {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	const q = `
+		SELECT
+			rs.id,
+			u.username,
+			rs.reps,
+			rs.source,
+			rs.started_at,
+			rs.ended_at,
+			rs.device_reps,
+			rs.anomaly_score,
+			rs.anomaly_reasons,
+			EXISTS (SELECT 1 FROM session_samples ss WHERE ss.session_id = rs.id) AS has_raw_data,
+			rs.created_at
+		FROM rep_sessions rs
+		JOIN users u
+		  ON u.id = rs.user_id
+		WHERE rs.review_status = 'flagged'
+		  AND rs.id > $1
+		ORDER BY rs.id ASC
+		LIMIT $2;
+	`
+
+	rows, err := dbPool.Query(ctx, q, after, limit)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	queue := make([]reviewQueueRow, 0)
+	for rows.Next() {
+		var row reviewQueueRow
+		if err := rows.Scan(
+			&row.SessionID,
+			&row.Username,
+			&row.Reps,
+			&row.Source,
+			&row.StartedAt,
+			&row.EndedAt,
+			&row.DeviceReps,
+			&row.AnomalyScore,
+			&row.Reasons,
+			&row.HasRawData,
+			&row.CreatedAt,
+		); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		queue = append(queue, row)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"sessions": queue})
+}
+
+// handleReviewDecision approves a flagged session back onto the leaderboards or rejects it for good.
+func handleReviewDecision(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	var req reviewDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	switch req.Decision {
+	case "approve":
+		status = "approved"
+	case "reject":
+		status = "rejected"
+	default:
+		http.Error(w, "decision must be approve or reject", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	ownerID, err := reviewRepSession(ctx, tx, sessionID, adminID, status)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "no flagged session with that id", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	notifySessionChange(ownerID, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "sessionId": sessionID, "reviewStatus": status})
+}
+
+// reviewRepSession records an admin's decision on a flagged session and logs the revision.
+// It returns pgx.ErrNoRows when the session doesn't exist or isn't flagged.
+func reviewRepSession(ctx context.Context, db dbQuerier, sessionID, adminID int64, status string) (ownerID int64, err error) {
+	// Lock the row so a concurrent edit can't land between the snapshot and the update.
+	const currentQ = `
+		SELECT to_jsonb(rs)
+		FROM rep_sessions rs
+		WHERE rs.id = $1
+		FOR UPDATE;
+	`
+
+	var before []byte
+	if err := db.QueryRow(ctx, currentQ, sessionID).Scan(&before); err != nil {
+		return 0, err
+	}
+
+	const q = `
+		UPDATE rep_sessions
+		SET review_status = $2, reviewed_by = $3, reviewed_at = now()
+		WHERE id = $1
+		  AND review_status = 'flagged'
+		RETURNING user_id, started_at;
+	`
+
+	var startedAt time.Time
+	if err := db.QueryRow(ctx, q, sessionID, status, adminID).Scan(&ownerID, &startedAt); err != nil {
+		return 0, err
+	}
+	// A rejected session stops counting towards the owner's streaks; an approved one
+	// starts counting on the leaderboard's.
+	if err := refreshUserStats(ctx, db, ownerID, startedAt); err != nil {
+		return 0, err
+	}
+
+	after, err := sessionSnapshot(ctx, db, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	return ownerID, recordSessionRevision(ctx, db, sessionID, ownerID, adminID, RevisionReview, before, after)
+}
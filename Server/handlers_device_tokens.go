@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 )
 
 type registerDeviceTokenRequest struct {
@@ -58,25 +60,28 @@ func handleRegisterDeviceToken(w http.ResponseWriter, r *http.Request) {
 	const insertQ = `
 		INSERT INTO device_tokens (user_id, token_hash)
 		VALUES ($1, $2)
-		ON CONFLICT (token_hash) DO NOTHING;
+		ON CONFLICT (token_hash) DO NOTHING
+		RETURNING id;
 	`
 
-	tag, err := dbPool.Exec(ctx, insertQ, userID, tokenHash)
-	if err != nil {
+	// The device ID is also the device's MQTT client ID.
+	var deviceID int64
+	err := dbPool.QueryRow(ctx, insertQ, userID, tokenHash).Scan(&deviceID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	if tag.RowsAffected() == 0 {
+	if errors.Is(err, pgx.ErrNoRows) {
 		const ownerQ = `
-			SELECT user_id
+			SELECT id, user_id
 			FROM device_tokens
 			WHERE token_hash = $1
 			LIMIT 1;
 		`
 
 		var ownerID int64
-		if err := dbPool.QueryRow(ctx, ownerQ, tokenHash).Scan(&ownerID); err != nil {
+		if err := dbPool.QueryRow(ctx, ownerQ, tokenHash).Scan(&deviceID, &ownerID); err != nil {
 			http.Error(w, "server error", http.StatusInternalServerError)
 			return
 		}
@@ -88,8 +93,9 @@ func handleRegisterDeviceToken(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]any{
-			"ok":      true,
-			"created": false,
+			"ok":       true,
+			"created":  false,
+			"deviceId": deviceID,
 		})
 		return
 	}
@@ -97,8 +103,9 @@ func handleRegisterDeviceToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(map[string]any{
-		"ok":      true,
-		"created": true,
+		"ok":       true,
+		"created":  true,
+		"deviceId": deviceID,
 	})
 }
 
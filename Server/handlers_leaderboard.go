@@ -1,20 +1,36 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 )
 
 // LeaderboardRow is the exact row shape the frontend expects.
 type LeaderboardRow struct {
-	Username   string `json:"username"`
-	TotalReps  int    `json:"totalReps"`
-	StreakDays int    `json:"streakDays"`
-	IsFounder  bool   `json:"isFounder"`
+	UserID int64 `json:"-"`
+	// Rank is the dense rank by TotalReps over the whole board: ties share a rank
+	// and the next total down is the next rank.
+	Rank      int    `json:"rank"`
+	Username  string `json:"username"`
+	TotalReps int    `json:"totalReps"`
+	// QualityReps counts reps that reached the user's calibrated depth.
+	// Sessions without per-rep data contribute none.
+	QualityReps int `json:"qualityReps"`
+	// Provenance splits TotalReps by how the sessions were counted.
+	Provenance provenanceTotals `json:"provenance"`
+	StreakDays int              `json:"streakDays"`
+	IsFounder  bool             `json:"isFounder"`
+	IsViewer   bool             `json:"isViewer"`
 }
 
 // RegisterLeaderboardRoutes attaches leaderboard endpoints under /api.
@@ -31,18 +47,13 @@ func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read query parameters from the URL: ?scope=global&window=month
-	scope := r.URL.Query().Get("scope")
-	if scope != "friends" && scope != "global" {
-		scope = "global"
-	}
-
-	windowKey := r.URL.Query().Get("window")
-	if windowKey == "" {
-		windowKey = "month"
+	q, err := parseLeaderboardQuery(r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
 	}
 
-	rows, err := loadLeaderboardRows(r.Context(), windowKey, userID, scope)
+	page, err := loadLeaderboardPage(r.Context(), q, userID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -50,43 +61,334 @@ func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
 
 	// Respond as JSON
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"scope":  scope,
-		"window": windowKey,
-		"rows":   rows,
-	})
-}
-
-func loadLeaderboardRows(ctx context.Context, windowKey string, userID int64, scope string) ([]LeaderboardRow, error) {
-	windowStart := leaderboardWindowStart(time.Now().UTC(), windowKey)
-
-	query := `
-		WITH daily_activity AS (
-			SELECT DISTINCT
-				rs.user_id,
-				(rs.created_at AT TIME ZONE 'UTC')::date AS activity_day
-			FROM rep_sessions rs
-		),
-		streaks AS (
+	_ = json.NewEncoder(w).Encode(q.response(page))
+}
+
+var (
+	ErrLeaderboardCursorInvalid = errors.New("invalid cursor")
+	ErrLeaderboardAroundInvalid = errors.New("around must be me")
+	ErrLeaderboardAroundCursor  = errors.New("around=me pages can't take a cursor")
+)
+
+const (
+	defaultLeaderboardPageSize = 50
+	maxLeaderboardPageSize     = 200
+
+	defaultLeaderboardNeighbors = 5
+	maxLeaderboardNeighbors     = 50
+)
+
+// leaderboardQuery is which board a request asked for, and which part of it.
+type leaderboardQuery struct {
+	Scope    string
+	Window   string
+	Sources  []string
+	Verified bool
+
+	// Limit rows from the top, or from after Cursor. With AroundMe, the viewer's row
+	// with Neighbors rows above and below it instead.
+	Limit     int
+	Cursor    *leaderboardCursor
+	AroundMe  bool
+	Neighbors int
+}
+
+// leaderboardCursor is the position after the last row of a page, in board order.
+// On the wire it is "<totalReps>.<username>".
+type leaderboardCursor struct {
+	TotalReps int
+	Username  string
+}
+
+func (c leaderboardCursor) String() string {
+	return strconv.Itoa(c.TotalReps) + "." + c.Username
+}
+
+func parseLeaderboardCursor(raw string) (leaderboardCursor, error) {
+	reps, username, ok := strings.Cut(raw, ".")
+	if !ok || username == "" {
+		return leaderboardCursor{}, ErrLeaderboardCursorInvalid
+	}
+	n, err := strconv.Atoi(reps)
+	if err != nil || n < 0 {
+		return leaderboardCursor{}, ErrLeaderboardCursorInvalid
+	}
+	return leaderboardCursor{TotalReps: n, Username: username}, nil
+}
+
+// parseLeaderboardQuery reads ?scope=global&window=month&source=&verified=, and which
+// part of the board to return: ?limit=&cursor= or ?around=me&neighbors=.
+// window is minute, 30s, month, today, this-week or this-month.
+// Unknown scopes fall back to global and unknown windows to a month.
+func parseLeaderboardQuery(r *http.Request) (leaderboardQuery, error) {
+	q := leaderboardQuery{
+		Scope:  r.URL.Query().Get("scope"),
+		Window: r.URL.Query().Get("window"),
+	}
+	if q.Scope != "friends" && q.Scope != "global" {
+		q.Scope = "global"
+	}
+	if q.Window == "" {
+		q.Window = "month"
+	}
+
+	// ?source=device,server-detected limits totals to those sources.
+	var err error
+	if q.Sources, err = parseSourceFilter(r.URL.Query().Get("source")); err != nil {
+		return leaderboardQuery{}, err
+	}
+	// ?verified=true only counts sessions the server counted from raw sensor data.
+	if q.Verified, err = parseVerifiedFilter(r.URL.Query().Get("verified")); err != nil {
+		return leaderboardQuery{}, err
+	}
+
+	var ok bool
+	if q.Limit, ok = parsePageSize(r.URL.Query().Get("limit"), defaultLeaderboardPageSize, maxLeaderboardPageSize); !ok {
+		return leaderboardQuery{}, errors.New("invalid limit")
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		cursor, err := parseLeaderboardCursor(v)
+		if err != nil {
+			return leaderboardQuery{}, err
+		}
+		q.Cursor = &cursor
+	}
+
+	// ?around=me&neighbors=5 is the viewer's row with five rows either side.
+	switch r.URL.Query().Get("around") {
+	case "":
+	case "me":
+		q.AroundMe = true
+	default:
+		return leaderboardQuery{}, ErrLeaderboardAroundInvalid
+	}
+	if q.AroundMe && q.Cursor != nil {
+		return leaderboardQuery{}, ErrLeaderboardAroundCursor
+	}
+	if q.Neighbors, ok = parsePageSize(r.URL.Query().Get("neighbors"), defaultLeaderboardNeighbors, maxLeaderboardNeighbors); !ok {
+		return leaderboardQuery{}, errors.New("invalid neighbors")
+	}
+	return q, nil
+}
+
+// parsePageSize reads a positive count up to max, or def when raw is empty.
+func parsePageSize(raw string, def, max int) (int, bool) {
+	if raw == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 || n > max {
+		return 0, false
+	}
+	return n, true
+}
+
+// leaderboardPage is the part of a ranked board a request asked for. Viewer is the
+// viewer's own row whether or not it is in Rows, and nil when they aren't on the board.
+// Next is where the rows after Rows start, nil at the end of the board.
+type leaderboardPage struct {
+	Rows   []LeaderboardRow
+	Viewer *LeaderboardRow
+	Next   *leaderboardCursor
+}
+
+// response is the JSON body for a page of the board.
+func (q leaderboardQuery) response(p leaderboardPage) map[string]any {
+	rows := p.Rows
+	if rows == nil {
+		rows = []LeaderboardRow{}
+	}
+
+	var nextCursor *string
+	if p.Next != nil {
+		s := p.Next.String()
+		nextCursor = &s
+	}
+
+	return map[string]any{
+		"scope":      q.Scope,
+		"window":     q.Window,
+		"sources":    q.Sources,
+		"verified":   q.Verified,
+		"rows":       rows,
+		"viewer":     p.Viewer,
+		"nextCursor": nextCursor,
+	}
+}
+
+// viewOf is the page a viewer sees of a whole ranked board shared between streams.
+// members, when not nil, keeps just those users, ranked among themselves, as the friends
+// board does. index finds a user's row on the unfiltered board.
+func (q leaderboardQuery) viewOf(board []LeaderboardRow, index map[int64]int, viewerID int64, members map[int64]bool) leaderboardPage {
+	viewer, ok := index[viewerID]
+	if !ok {
+		viewer = -1
+	}
+
+	if members != nil {
+		kept := make([]LeaderboardRow, 0, len(members))
+		viewer = -1
+		for _, row := range board {
+			if !members[row.UserID] {
+				continue
+			}
+			if row.UserID == viewerID {
+				viewer = len(kept)
+			}
+			kept = append(kept, row)
+		}
+		rankLeaderboard(kept)
+		board = kept
+	}
+	return q.pageAt(board, viewer, viewerID)
+}
+
+// pageAt cuts the requested rows out of a ranked board on which the viewer's row is
+// board[viewer], or -1 when they aren't on it.
+func (q leaderboardQuery) pageAt(board []LeaderboardRow, viewer int, viewerID int64) leaderboardPage {
+	start, end := 0, min(len(board), q.Limit)
+	switch {
+	case q.AroundMe:
+		// Off the board (which the friends and global boards never are): the top instead.
+		if viewer >= 0 {
+			start, end = max(0, viewer-q.Neighbors), min(len(board), viewer+q.Neighbors+1)
+		} else {
+			end = min(len(board), 2*q.Neighbors+1)
+		}
+	case q.Cursor != nil:
+		after := LeaderboardRow{TotalReps: q.Cursor.TotalReps, Username: q.Cursor.Username}
+		start, _ = slices.BinarySearchFunc(board, after, compareLeaderboardRows)
+		if start < len(board) && compareLeaderboardRows(board[start], after) == 0 {
+			start++
+		}
+		end = min(len(board), start+q.Limit)
+	}
+
+	var p leaderboardPage
+	p.Rows = slices.Clone(board[start:end])
+	for i := range p.Rows {
+		p.Rows[i].IsViewer = p.Rows[i].UserID == viewerID
+	}
+	if viewer >= 0 {
+		row := board[viewer]
+		row.IsViewer = true
+		p.Viewer = &row
+	}
+	if end < len(board) {
+		last := board[end-1]
+		p.Next = &leaderboardCursor{TotalReps: last.TotalReps, Username: last.Username}
+	}
+	return p
+}
+
+// trimLeaderboardPage keeps the first end rows of a page fetched with at least one row
+// more, and returns the cursor of the rows after them when that extra row came back.
+func trimLeaderboardPage(rows []LeaderboardRow, end int) ([]LeaderboardRow, *leaderboardCursor) {
+	if len(rows) <= end {
+		return rows, nil
+	}
+	last := rows[end-1]
+	return rows[:end], &leaderboardCursor{TotalReps: last.TotalReps, Username: last.Username}
+}
+
+// compareLeaderboardRows is board order: most reps first, then by username.
+func compareLeaderboardRows(a, b LeaderboardRow) int {
+	if c := cmp.Compare(b.TotalReps, a.TotalReps); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Username, b.Username)
+}
+
+// rankLeaderboard puts rows in board order and numbers them with dense ranks.
+func rankLeaderboard(rows []LeaderboardRow) {
+	slices.SortFunc(rows, compareLeaderboardRows)
+	for i := range rows {
+		switch {
+		case i == 0:
+			rows[i].Rank = 1
+		case rows[i].TotalReps == rows[i-1].TotalReps:
+			rows[i].Rank = rows[i-1].Rank
+		default:
+			rows[i].Rank = rows[i-1].Rank + 1
+		}
+	}
+}
+
+// leaderboardBoard is which board a query ranks: the window it totals and the sessions
+// it counts. The global board counts public sessions; the friends board also counts
+// friends-only sessions. Private sessions are never counted, nor are sessions flagged by
+// the anomaly checks until an admin approves them. Streaks come from the user_stats row
+// for the same sessions, whatever the window.
+type leaderboardBoard struct {
+	// From and To bound the window: dates [From, To) when ByDay, else times [From, To].
+	From, To time.Time
+	ByDay    bool
+	Key      statsKey
+}
+
+// statsKey is the sessions the query's board counts.
+func (q leaderboardQuery) statsKey() statsKey {
+	key := statsKey{Scope: ScopePublic, Sources: sourceMaskOf(q.Sources, q.Verified)}
+	if q.Scope == "friends" {
+		key.Scope = ScopeFriends
+	}
+	return key
+}
+
+// newLeaderboardBoard resolves a window in the viewer's zone. Windows of a day or more
+// total user_daily_reps over the window's dates, each user's reps on those dates in their
+// own zone; minute and 30s total the sessions themselves.
+func newLeaderboardBoard(now time.Time, window string, key statsKey, loc *time.Location) leaderboardBoard {
+	b := leaderboardBoard{Key: key}
+	b.From, b.To, b.ByDay = leaderboardWindowDays(now, window, loc)
+	if !b.ByDay {
+		b.From, b.To = leaderboardWindowStart(now, window, loc), now
+	}
+	return b
+}
+
+// leaderboardColumns are the columns of board, in the order scanLeaderboardRow reads them
+// after rank.
+const leaderboardColumns = `id, username, total_reps, quality_reps, manual_reps, device_reps, verified_reps, streak_days, is_founder`
+
+// sql is a WITH clause defining board(leaderboardColumns): everyone on the board
+// with their totals and streak, unranked. Queries continue it with the parameters from
+// args, then their own from $9.
+func (b leaderboardBoard) sql() string {
+	totals := `
+			SELECT
+				user_id,
+				SUM(reps)::bigint AS total_reps,
+				SUM(quality_reps)::bigint AS quality_reps,
+				COALESCE(SUM(reps) FILTER (WHERE source IN ('manual', 'import')), 0)::bigint AS manual_reps,
+				COALESCE(SUM(reps) FILTER (WHERE source = 'device'), 0)::bigint AS device_reps,
+				COALESCE(SUM(reps) FILTER (WHERE source = 'server-detected'), 0)::bigint AS verified_reps
+			FROM user_daily_reps
+			WHERE day >= $1::date
+			  AND day < $2::date
+			  AND scope = ANY($3::text[])
+			  AND source = ANY($4::text[])
+			GROUP BY user_id`
+	if !b.ByDay {
+		totals = `
 			SELECT
-				da.user_id,
-				COUNT(*) FILTER (
-					WHERE da.activity_day = (d.utc_today - (da.rn - 1))
-				)::int AS streak_days
-			FROM (
-				SELECT
-					user_id,
-					activity_day,
-					ROW_NUMBER() OVER (
-						PARTITION BY user_id
-						ORDER BY activity_day DESC
-					)::int AS rn
-				FROM daily_activity
-			) da
-			CROSS JOIN (
-				SELECT (NOW() AT TIME ZONE 'UTC')::date AS utc_today
-			) d
-			GROUP BY da.user_id
+				user_id,
+				SUM(reps)::bigint AS total_reps,
+				COALESCE(SUM(quality_reps), 0)::bigint AS quality_reps,
+				COALESCE(SUM(reps) FILTER (WHERE provenance = 'manual'), 0)::bigint AS manual_reps,
+				COALESCE(SUM(reps) FILTER (WHERE provenance = 'device-reported'), 0)::bigint AS device_reps,
+				COALESCE(SUM(reps) FILTER (WHERE provenance = 'server-verified'), 0)::bigint AS verified_reps
+			FROM rep_sessions
+			WHERE started_at >= $1::timestamptz
+			  AND started_at <= $2::timestamptz
+			  AND scope = ANY($3::text[])
+			  AND source = ANY($4::text[])
+			  AND review_status NOT IN ('flagged', 'rejected')
+			GROUP BY user_id`
+	}
+
+	return `
+		WITH totals AS (` + totals + `
 		),
 		founder_candidates AS (
 			SELECT
@@ -100,97 +402,201 @@ func loadLeaderboardRows(ctx context.Context, windowKey string, userID int64, sc
 			FROM founder_candidates fc
 			ORDER BY fc.first_registered_at ASC, fc.user_id ASC
 			LIMIT 50
-		)
-		SELECT
-			u.username,
-			COALESCE(SUM(rs.reps), 0) AS total_reps,
-			COALESCE(s.streak_days, 0) AS streak_days,
-			(f.user_id IS NOT NULL) AS is_founder
-		FROM users u
-		LEFT JOIN rep_sessions rs
-		  ON rs.user_id = u.id
-		 AND rs.created_at >= $1
-		LEFT JOIN streaks s
-		  ON s.user_id = u.id
-		LEFT JOIN founders f
-		  ON f.user_id = u.id
-		GROUP BY u.id, u.username, s.streak_days, f.user_id
-		ORDER BY total_reps DESC, u.username ASC;
-	`
-	args := []any{windowStart}
-
-	if scope == "friends" {
-		query = `
-			WITH daily_activity AS (
-				SELECT DISTINCT
-					rs.user_id,
-					(rs.created_at AT TIME ZONE 'UTC')::date AS activity_day
-				FROM rep_sessions rs
-			),
-			streaks AS (
-				SELECT
-					da.user_id,
-					COUNT(*) FILTER (
-						WHERE da.activity_day = (d.utc_today - (da.rn - 1))
-					)::int AS streak_days
-				FROM (
-					SELECT
-						user_id,
-						activity_day,
-						ROW_NUMBER() OVER (
-							PARTITION BY user_id
-							ORDER BY activity_day DESC
-						)::int AS rn
-					FROM daily_activity
-				) da
-				CROSS JOIN (
-					SELECT (NOW() AT TIME ZONE 'UTC')::date AS utc_today
-				) d
-				GROUP BY da.user_id
-			),
-			founder_candidates AS (
-				SELECT
-					dt.user_id,
-					MIN(dt.created_at) AS first_registered_at
-				FROM device_tokens dt
-				GROUP BY dt.user_id
-			),
-			founders AS (
-				SELECT fc.user_id
-				FROM founder_candidates fc
-				ORDER BY fc.first_registered_at ASC, fc.user_id ASC
-				LIMIT 50
-			)
+		),
+		board AS (
 			SELECT
+				u.id,
 				u.username,
-				COALESCE(SUM(rs.reps), 0) AS total_reps,
-				COALESCE(s.streak_days, 0) AS streak_days,
+				COALESCE(t.total_reps, 0) AS total_reps,
+				COALESCE(t.quality_reps, 0) AS quality_reps,
+				COALESCE(t.manual_reps, 0) AS manual_reps,
+				COALESCE(t.device_reps, 0) AS device_reps,
+				COALESCE(t.verified_reps, 0) AS verified_reps,
+				CASE
+					WHEN us.last_active_day = (NOW() AT TIME ZONE COALESCE(u.time_zone, 'UTC'))::date
+					THEN us.current_streak
+					ELSE 0
+				END AS streak_days,
 				(f.user_id IS NOT NULL) AS is_founder
 			FROM users u
-			LEFT JOIN rep_sessions rs
-			  ON rs.user_id = u.id
-			 AND rs.created_at >= $1
-			LEFT JOIN streaks s
-			  ON s.user_id = u.id
+			LEFT JOIN totals t
+			  ON t.user_id = u.id
+			LEFT JOIN user_stats us
+			  ON us.user_id = u.id
+			 AND us.scope = $5
+			 AND us.sources = $6
 			LEFT JOIN founders f
 			  ON f.user_id = u.id
-			WHERE u.id = $2
+			WHERE NOT $8::boolean
+			   OR u.id = $7
 			   OR EXISTS (
 					SELECT 1
-					FROM friendships f
-					WHERE f.user_id = $2
-					  AND f.friend_user_id = u.id
+					FROM friendships fs
+					WHERE fs.user_id = $7
+					  AND fs.friend_user_id = u.id
 			   )
-			GROUP BY u.id, u.username, s.streak_days, f.user_id
-			ORDER BY total_reps DESC, u.username ASC;
-		`
-		args = append(args, userID)
+		)`
+}
+
+// args binds sql's parameters. friendsOnly lists only the viewer and their friends.
+func (b leaderboardBoard) args(viewerID int64, friendsOnly bool) []any {
+	return []any{b.From, b.To, b.Key.visibleScopes(), b.Key.Sources.sources(), b.Key.Scope, int16(b.Key.Sources), viewerID, friendsOnly}
+}
+
+// scanLeaderboardRow reads leaderboardColumns and then the rank.
+func scanLeaderboardRow(row pgx.Row, viewerID int64) (LeaderboardRow, error) {
+	var r LeaderboardRow
+	err := row.Scan(
+		&r.UserID,
+		&r.Username,
+		&r.TotalReps,
+		&r.QualityReps,
+		&r.Provenance.Manual,
+		&r.Provenance.DeviceReported,
+		&r.Provenance.ServerVerified,
+		&r.StreakDays,
+		&r.IsFounder,
+		&r.Rank,
+	)
+	r.IsViewer = r.UserID == viewerID
+	return r, err
+}
+
+// loadLeaderboardPage ranks the board in Postgres and reads just the requested page of it,
+// and the viewer's own row.
+// Usernames compare bytewise (COLLATE "C"), as cursors do, whatever the database's collation.
+func loadLeaderboardPage(ctx context.Context, q leaderboardQuery, userID int64) (leaderboardPage, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	loc, err := loadUserLocation(queryCtx, dbPool, userID)
+	if err != nil {
+		return leaderboardPage{}, err
+	}
+	b := newLeaderboardBoard(time.Now(), q.Window, q.statsKey(), loc)
+	args := b.args(userID, q.Scope == "friends")
+
+	// The viewer's dense rank is one more than the number of distinct totals above theirs.
+	viewerQ := b.sql() + `
+		SELECT
+			` + leaderboardColumns + `,
+			(SELECT COUNT(DISTINCT above.total_reps) FROM board above WHERE above.total_reps > me.total_reps)::int + 1
+		FROM board me
+		WHERE me.id = $7;
+	`
+	var page leaderboardPage
+	viewer, err := scanLeaderboardRow(dbPool.QueryRow(queryCtx, viewerQ, args...), userID)
+	switch {
+	case err == nil:
+		page.Viewer = &viewer
+	case !errors.Is(err, pgx.ErrNoRows):
+		return leaderboardPage{}, err
+	}
+
+	ranked := b.sql() + `,
+		ranked AS (
+			SELECT board.*, DENSE_RANK() OVER (ORDER BY total_reps DESC)::int AS rank
+			FROM board
+		)`
+
+	var (
+		pageQ string
+		end   int
+	)
+	if q.AroundMe && page.Viewer != nil {
+		// Up to Neighbors rows above the viewer, read backwards, then the viewer and up to
+		// Neighbors rows below, and one more to tell whether the board goes on.
+		pageQ = ranked + `
+		SELECT ` + leaderboardColumns + `, rank
+		FROM (
+			(
+				SELECT *
+				FROM ranked
+				WHERE total_reps > $9
+				   OR (total_reps = $9 AND username COLLATE "C" < $10::text)
+				ORDER BY total_reps ASC, username COLLATE "C" DESC
+				LIMIT $11
+			)
+			UNION ALL
+			(
+				SELECT *
+				FROM ranked
+				WHERE total_reps < $9
+				   OR (total_reps = $9 AND username COLLATE "C" >= $10::text)
+				ORDER BY total_reps DESC, username COLLATE "C" ASC
+				LIMIT $11 + 2
+			)
+		) around
+		ORDER BY total_reps DESC, username COLLATE "C" ASC;
+	`
+		args = append(args, viewer.TotalReps, viewer.Username, q.Neighbors)
+		// Set again from where the viewer's row comes back, unless it moved in between.
+		end = 2*q.Neighbors + 1
+	} else {
+		limit := q.Limit
+		if q.AroundMe {
+			// Off the board (which the friends and global boards never are): the top instead.
+			limit = 2*q.Neighbors + 1
+		}
+		var (
+			afterReps *int
+			afterName *string
+		)
+		if q.Cursor != nil {
+			afterReps, afterName = &q.Cursor.TotalReps, &q.Cursor.Username
+		}
+
+		pageQ = ranked + `
+		SELECT ` + leaderboardColumns + `, rank
+		FROM ranked
+		WHERE $9::bigint IS NULL
+		   OR total_reps < $9::bigint
+		   OR (total_reps = $9::bigint AND username COLLATE "C" > $10::text)
+		ORDER BY total_reps DESC, username COLLATE "C" ASC
+		LIMIT $11;
+	`
+		args = append(args, afterReps, afterName, limit+1)
+		end = limit
+	}
+
+	rows, err := dbPool.Query(queryCtx, pageQ, args...)
+	if err != nil {
+		return leaderboardPage{}, err
+	}
+	defer rows.Close()
+
+	page.Rows = make([]LeaderboardRow, 0)
+	for rows.Next() {
+		row, err := scanLeaderboardRow(rows, userID)
+		if err != nil {
+			return leaderboardPage{}, err
+		}
+		if row.IsViewer && q.AroundMe && page.Viewer != nil {
+			end = len(page.Rows) + q.Neighbors + 1
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return leaderboardPage{}, err
 	}
 
+	page.Rows, page.Next = trimLeaderboardPage(page.Rows, end)
+	return page, nil
+}
+
+// loadLeaderboardBoard loads and ranks a whole board with every user on it, for
+// streams to share and page in memory as it changes.
+// Ranked in Go so cursors compare usernames the way the board is ordered,
+// whatever the database's collation.
+func loadLeaderboardBoard(ctx context.Context, b leaderboardBoard) ([]LeaderboardRow, error) {
 	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := dbPool.Query(queryCtx, query, args...)
+	query := b.sql() + `
+		SELECT ` + leaderboardColumns + `, 0
+		FROM board;
+	`
+	rows, err := dbPool.Query(queryCtx, query, b.args(0, false)...)
 	if err != nil {
 		return nil, err
 	}
@@ -198,18 +604,58 @@ func loadLeaderboardRows(ctx context.Context, windowKey string, userID int64, sc
 
 	results := make([]LeaderboardRow, 0)
 	for rows.Next() {
-		var row LeaderboardRow
-		if err := rows.Scan(&row.Username, &row.TotalReps, &row.StreakDays, &row.IsFounder); err != nil {
+		row, err := scanLeaderboardRow(rows, 0)
+		if err != nil {
 			return nil, err
 		}
 		results = append(results, row)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return results, rows.Err()
+	rankLeaderboard(results)
+	return results, nil
 }
 
-func leaderboardWindowStart(now time.Time, windowKey string) time.Time {
+// leaderboardWindowDays is the calendar dates [from, to) a window of a day or more
+// covers in loc, as dates at midnight UTC like a DATE scans: today, this week or this
+// month, or for month the dates since a month ago. byDay is false for minute and 30s,
+// which count from leaderboardWindowStart to now instead.
+func leaderboardWindowDays(now time.Time, windowKey string, loc *time.Location) (from, to time.Time, byDay bool) {
+	switch windowKey {
+	case "minute", "30s":
+		return time.Time{}, time.Time{}, false
+	}
+
+	from = localDate(leaderboardWindowStart(now, windowKey, loc), loc)
+	switch windowKey {
+	case "today":
+		to = from.AddDate(0, 0, 1)
+	case "this-week":
+		to = from.AddDate(0, 0, 7)
+	case "this-month":
+		to = from.AddDate(0, 1, 0)
+	default:
+		to = localDate(now, loc).AddDate(0, 0, 1)
+	}
+	return from, to, true
+}
+
+// leaderboardWindowStart is where a window begins. minute, 30s and month slide with now;
+// today, this-week (from Monday) and this-month are calendar periods in loc.
+func leaderboardWindowStart(now time.Time, windowKey string, loc *time.Location) time.Time {
+	local := now.In(loc)
+	y, m, d := local.Date()
+
 	switch windowKey {
+	case "today":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "this-week":
+		sinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(y, m, d-sinceMonday, 0, 0, 0, 0, loc)
+	case "this-month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
 	case "minute":
 		return now.Add(-1 * time.Minute)
 	case "30s":
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// leaderboardStreamDebounce batches a burst of changes into one reload of a feed.
+	leaderboardStreamDebounce = 500 * time.Millisecond
+	// leaderboardStreamHeartbeat keeps proxies from closing an idle stream.
+	leaderboardStreamHeartbeat = 25 * time.Second
+	// leaderboardStreamSlide re-checks sliding windows, where reps age out without any insert.
+	leaderboardStreamSlide = 5 * time.Second
+	// leaderboardStreamRescan catches what a change can't tell us, like a new friend or
+	// the start of a new calendar day.
+	leaderboardStreamRescan = time.Minute
+)
+
+// RegisterLeaderboardStreamRoutes attaches the leaderboard event stream under /api.
+// It stays open indefinitely, so it must be registered outside the request timeout.
+func RegisterLeaderboardStreamRoutes(r chi.Router) {
+	r.Get("/leaderboard/stream", handleLeaderboardStream)
+}
+
+// handleLeaderboardStream sends the board as Server-Sent Events: a "leaderboard" event
+// with the same body as GET /api/leaderboard on connect, then again whenever a session
+// for someone on the board is stored, edited or reviewed and the rows actually changed.
+// Streams showing the same board share one feed (see leaderboard_feeds.go) and each cuts
+// its own page out of it.
+func handleLeaderboardStream(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseLeaderboardQuery(r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	loc, err := loadUserLocation(r.Context(), dbPool, userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// The friends board is the viewer and their friends, cut out of a board of everyone.
+	var members map[int64]bool
+	if q.Scope == "friends" {
+		if members, err = loadFriendBoardMembers(r.Context(), userID); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sub := leaderboardStreams.Subscribe(newLeaderboardFeedKey(q, loc), loc)
+	defer leaderboardStreams.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, "retry: 5000\n\n"); err != nil {
+		return
+	}
+
+	var last []byte
+	send := func() error {
+		snap := sub.Snapshot()
+		if snap == nil {
+			return nil
+		}
+		if snap.Err != nil {
+			return snap.Err
+		}
+
+		payload, err := json.Marshal(q.response(q.viewOf(snap.Rows, snap.Index, userID, members)))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(payload, last) {
+			return nil
+		}
+		last = payload
+
+		if _, err := fmt.Fprintf(w, "event: leaderboard\ndata: %s\n\n", payload); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	heartbeat := time.NewTicker(leaderboardStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	// The feed can't tell when the viewer gains or loses a friend.
+	rescan := time.NewTicker(leaderboardStreamRescan)
+	defer rescan.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-sub.C:
+			if err := send(); err != nil {
+				return
+			}
+
+		case <-rescan.C:
+			if members == nil {
+				continue
+			}
+			if members, err = loadFriendBoardMembers(r.Context(), userID); err != nil {
+				return
+			}
+			if err := send(); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// loadFriendBoardMembers is who is on a user's friends board: them and their friends.
+func loadFriendBoardMembers(ctx context.Context, userID int64) (map[int64]bool, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	const q = `
+		SELECT friend_user_id
+		FROM friendships
+		WHERE user_id = $1;
+	`
+	rows, err := dbPool.Query(queryCtx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	friends, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[int64]bool{userID: true}
+	for _, id := range friends {
+		members[id] = true
+	}
+	return members, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -8,18 +9,261 @@ import (
 func TestLeaderboardWindowStart(t *testing.T) {
 	now := time.Date(2026, 1, 9, 12, 0, 0, 0, time.UTC)
 
-	got := leaderboardWindowStart(now, "minute")
+	got := leaderboardWindowStart(now, "minute", time.UTC)
 	if got != now.Add(-1*time.Minute) {
 		t.Fatalf("minute window mismatch: %v", got)
 	}
 
-	got = leaderboardWindowStart(now, "30s")
+	got = leaderboardWindowStart(now, "30s", time.UTC)
 	if got != now.Add(-30*time.Second) {
 		t.Fatalf("30s window mismatch: %v", got)
 	}
 
-	got = leaderboardWindowStart(now, "month")
+	got = leaderboardWindowStart(now, "month", time.UTC)
 	if got != now.AddDate(0, -1, 0) {
 		t.Fatalf("month window mismatch: %v", got)
 	}
 }
+
+func TestLeaderboardCalendarWindowsUseViewerZone(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Friday 7pm in California is already Saturday in UTC.
+	now := time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		window string
+		loc    *time.Location
+		want   time.Time
+	}{
+		{"today", la, time.Date(2026, 10, 23, 0, 0, 0, 0, la)},
+		{"today", time.UTC, time.Date(2026, 10, 24, 0, 0, 0, 0, time.UTC)},
+		{"this-week", la, time.Date(2026, 10, 19, 0, 0, 0, 0, la)},
+		{"this-week", time.UTC, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"this-month", la, time.Date(2026, 10, 1, 0, 0, 0, 0, la)},
+	}
+	for _, tc := range cases {
+		if got := leaderboardWindowStart(now, tc.window, tc.loc); !got.Equal(tc.want) {
+			t.Fatalf("%s in %s: %v; want %v", tc.window, tc.loc, got, tc.want)
+		}
+	}
+
+	// A week that crosses the end of daylight saving still starts at local midnight.
+	got := leaderboardWindowStart(time.Date(2026, 11, 3, 20, 0, 0, 0, time.UTC), "this-week", la)
+	if want := time.Date(2026, 11, 2, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("week after DST ends: %v; want %v", got, want)
+	}
+	// On a Sunday the week began six days ago.
+	got = leaderboardWindowStart(time.Date(2026, 11, 1, 18, 0, 0, 0, time.UTC), "this-week", la)
+	if want := time.Date(2026, 10, 26, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("Sunday: %v; want %v", got, want)
+	}
+}
+
+func TestLeaderboardWindowDays(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Friday evening in California, Saturday in UTC.
+	now := time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		window   string
+		from, to string
+	}{
+		{"today", "2026-10-23", "2026-10-24"},
+		{"this-week", "2026-10-19", "2026-10-26"},
+		{"this-month", "2026-10-01", "2026-11-01"},
+		{"month", "2026-09-23", "2026-10-24"},
+	}
+	for _, tc := range cases {
+		from, to, byDay := leaderboardWindowDays(now, tc.window, la)
+		if !byDay || !from.Equal(day(tc.from)) || !to.Equal(day(tc.to)) {
+			t.Fatalf("%s: [%v, %v) %v; want [%s, %s)", tc.window, from, to, byDay, tc.from, tc.to)
+		}
+	}
+
+	for _, window := range []string{"minute", "30s"} {
+		if _, _, byDay := leaderboardWindowDays(now, window, la); byDay {
+			t.Fatalf("%s counted by day", window)
+		}
+	}
+}
+
+// testBoard is ranked: 1 ann 90, 2 bo 75, 2 cy 75, 3 di 40, 3 ed.x 40, 4 flo 10, 5 gus 0.
+func testBoard() []LeaderboardRow {
+	rows := []LeaderboardRow{
+		{UserID: 7, Username: "gus", TotalReps: 0},
+		{UserID: 4, Username: "di", TotalReps: 40},
+		{UserID: 2, Username: "cy", TotalReps: 75},
+		{UserID: 1, Username: "ann", TotalReps: 90},
+		{UserID: 5, Username: "ed.x", TotalReps: 40},
+		{UserID: 3, Username: "bo", TotalReps: 75},
+		{UserID: 6, Username: "flo", TotalReps: 10},
+	}
+	rankLeaderboard(rows)
+	return rows
+}
+
+// testView is viewer's page of testBoard, shared as a stream's feed shares it.
+func testView(q leaderboardQuery, viewer string, members map[int64]bool) leaderboardPage {
+	snap := newLeaderboardSnapshot(testBoard(), nil)
+	var viewerID int64
+	for _, row := range snap.Rows {
+		if row.Username == viewer {
+			viewerID = row.UserID
+		}
+	}
+	return q.viewOf(snap.Rows, snap.Index, viewerID, members)
+}
+
+func boardNames(rows []LeaderboardRow) string {
+	var names string
+	for _, row := range rows {
+		names += row.Username + " "
+	}
+	return names
+}
+
+func TestRankLeaderboardIsDense(t *testing.T) {
+	board := testBoard()
+	want := []struct {
+		name string
+		rank int
+	}{{"ann", 1}, {"bo", 2}, {"cy", 2}, {"di", 3}, {"ed.x", 3}, {"flo", 4}, {"gus", 5}}
+	for i, w := range want {
+		if board[i].Username != w.name || board[i].Rank != w.rank {
+			t.Fatalf("row %d: %s ranked %d; want %s ranked %d", i, board[i].Username, board[i].Rank, w.name, w.rank)
+		}
+	}
+}
+
+func TestLeaderboardPagesWithCursor(t *testing.T) {
+	q := leaderboardQuery{Limit: 3}
+
+	var got string
+	for pages := 0; ; pages++ {
+		if pages > len(testBoard()) {
+			t.Fatal("paging never ended")
+		}
+		p := testView(q, "flo", nil)
+		got += boardNames(p.Rows)
+		if p.Next == nil {
+			break
+		}
+		// Cursors go over the wire; usernames may hold the separator.
+		cursor, err := parseLeaderboardCursor(p.Next.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Cursor = &cursor
+	}
+	if want := "ann bo cy di ed.x flo gus "; got != want {
+		t.Fatalf("pages %q; want %q", got, want)
+	}
+
+	// A cursor whose row has since moved still picks up where the board order says.
+	q.Cursor = &leaderboardCursor{TotalReps: 50, Username: "zed"}
+	if p := testView(q, "flo", nil); boardNames(p.Rows) != "di ed.x flo " {
+		t.Fatalf("page after a vanished row: %q", boardNames(p.Rows))
+	}
+}
+
+func TestLeaderboardAroundMe(t *testing.T) {
+	cases := []struct {
+		viewer string
+		want   string
+		next   bool
+	}{
+		{"di", "bo cy di ed.x flo ", true},
+		{"ann", "ann bo cy ", true},
+		{"gus", "ed.x flo gus ", false},
+		{"", "ann bo cy di ed.x ", true}, // not on the board: the top
+	}
+	for _, tc := range cases {
+		q := leaderboardQuery{Limit: 50, AroundMe: true, Neighbors: 2}
+		p := testView(q, tc.viewer, nil)
+		if boardNames(p.Rows) != tc.want || (p.Next != nil) != tc.next {
+			t.Fatalf("around %q: %q, next %v; want %q", tc.viewer, boardNames(p.Rows), p.Next, tc.want)
+		}
+	}
+}
+
+func TestLeaderboardResponseAlwaysHasViewer(t *testing.T) {
+	q := leaderboardQuery{Limit: 2}
+	resp := q.response(testView(q, "flo", nil))
+
+	viewer, _ := resp["viewer"].(*LeaderboardRow)
+	if viewer == nil || viewer.Username != "flo" || viewer.Rank != 4 {
+		t.Fatalf("viewer %+v", viewer)
+	}
+	if rows := resp["rows"].([]LeaderboardRow); boardNames(rows) != "ann bo " {
+		t.Fatalf("rows %q", boardNames(rows))
+	}
+	if next, _ := resp["nextCursor"].(*string); next == nil || *next != "75.bo" {
+		t.Fatalf("nextCursor %v", resp["nextCursor"])
+	}
+}
+
+func TestLeaderboardViewOfFriendsBoard(t *testing.T) {
+	// cy, di and flo: ranked among themselves, whatever their rank on the whole board.
+	members := map[int64]bool{2: true, 4: true, 6: true}
+	p := testView(leaderboardQuery{Limit: 50}, "di", members)
+
+	if boardNames(p.Rows) != "cy di flo " {
+		t.Fatalf("rows %q", boardNames(p.Rows))
+	}
+	for i, rank := range []int{1, 2, 3} {
+		if p.Rows[i].Rank != rank {
+			t.Fatalf("%s ranked %d; want %d", p.Rows[i].Username, p.Rows[i].Rank, rank)
+		}
+	}
+	if p.Viewer == nil || p.Viewer.Username != "di" || p.Viewer.Rank != 2 || !p.Rows[1].IsViewer || p.Rows[0].IsViewer {
+		t.Fatalf("viewer %+v, rows %+v", p.Viewer, p.Rows)
+	}
+
+	// Other streams share the board; a view must leave it as it was.
+	snap := newLeaderboardSnapshot(testBoard(), nil)
+	leaderboardQuery{Limit: 50}.viewOf(snap.Rows, snap.Index, 4, members)
+	if di := snap.Rows[snap.Index[4]]; di.Rank != 3 || di.IsViewer {
+		t.Fatalf("shared board changed: %+v", di)
+	}
+}
+
+func TestTrimLeaderboardPage(t *testing.T) {
+	board := testBoard()
+
+	rows, next := trimLeaderboardPage(board[:4], 3)
+	if boardNames(rows) != "ann bo cy " || next == nil || next.String() != "75.cy" {
+		t.Fatalf("page %q, next %v", boardNames(rows), next)
+	}
+	// No extra row came back: the board ends here.
+	if rows, next := trimLeaderboardPage(board[5:], 3); boardNames(rows) != "flo gus " || next != nil {
+		t.Fatalf("last page %q, next %v", boardNames(rows), next)
+	}
+}
+
+func TestParseLeaderboardQueryPaging(t *testing.T) {
+	q, err := parseLeaderboardQuery(httptest.NewRequest("GET", "/api/leaderboard", nil))
+	if err != nil || q.Limit != defaultLeaderboardPageSize || q.Cursor != nil || q.AroundMe {
+		t.Fatalf("defaults %+v, %v", q, err)
+	}
+
+	q, err = parseLeaderboardQuery(httptest.NewRequest("GET", "/api/leaderboard?around=me&neighbors=3", nil))
+	if err != nil || !q.AroundMe || q.Neighbors != 3 {
+		t.Fatalf("around=me %+v, %v", q, err)
+	}
+
+	for _, query := range []string{
+		"limit=0", "limit=201", "limit=ten",
+		"cursor=abc", "cursor=12.", "cursor=-1.ann",
+		"around=you", "around=me&cursor=10.ann", "around=me&neighbors=51",
+	} {
+		if _, err := parseLeaderboardQuery(httptest.NewRequest("GET", "/api/leaderboard?"+query, nil)); err == nil {
+			t.Fatalf("%s accepted", query)
+		}
+	}
+}
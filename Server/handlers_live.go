@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	liveWriteWait       = 10 * time.Second
+	livePongWait        = 60 * time.Second
+	livePingPeriod      = livePongWait * 9 / 10
+	maxLiveMessageBytes = 256 << 10
+)
+
+// liveUpgrader keeps gorilla's default origin check, so browsers can only open viewer
+// sockets from our own pages. Devices don't send an Origin header.
+var liveUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// liveSummary is sent to the device and viewers when a live session ends.
+// SessionID is null when nothing was recorded, e.g. the set was stopped during the countdown.
+type liveSummary struct {
+	Type       string  `json:"type"`
+	SessionID  *int64  `json:"sessionId"`
+	Reps       int     `json:"reps"`
+	DeviceReps *int    `json:"deviceReps"`
+	Samples    int     `json:"samples"`
+	DurationS  float64 `json:"durationS"`
+	Source     string  `json:"source,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// RegisterLiveRoutes attaches the live streaming websockets under /api.
+// They are long-lived, so they must be registered outside the request timeout.
+func RegisterLiveRoutes(r chi.Router) {
+	r.Get("/live/device", handleLiveDevice)
+	r.Get("/live/users/{username}", handleLiveViewer)
+}
+
+// handleLiveDevice is the device's side of live streaming. The device authenticates with
+// X-Device-Token, then sends liveDeviceMessage frames; one connection can carry several sets.
+// The server replies only with errors and, when a set ends, its liveSummary.
+func handleLiveDevice(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.Header.Get("X-Device-Token"))
+	if token == "" {
+		http.Error(w, "missing device token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, deviceID, err := userIDFromDeviceToken(r.Context(), token)
+	if err != nil {
+		http.Error(w, "invalid device token", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(maxLiveMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go livePinger(conn, done)
+
+	var session *liveSession
+	// A dropped connection ends the set with whatever was recorded so far.
+	defer func() {
+		if session != nil {
+			endLiveSession(session)
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg liveDeviceMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			writeLiveJSON(conn, map[string]any{"type": "error", "error": "invalid JSON"})
+			continue
+		}
+
+		now := time.Now().UTC()
+		if session == nil {
+			if !startsLiveSession(msg) {
+				writeLiveJSON(conn, map[string]any{"type": "error", "error": ErrLiveNotLive.Error()})
+				continue
+			}
+			session = newLiveSession(userID, deviceID, now)
+			if err := liveSessions.start(session); err != nil {
+				session = nil
+				writeLiveJSON(conn, map[string]any{"type": "error", "error": err.Error()})
+				continue
+			}
+		}
+
+		err = liveSessions.apply(session, msg, now)
+		if errors.Is(err, ErrLiveTooLarge) {
+			// Keep what fits rather than losing the whole set.
+			writeLiveJSON(conn, map[string]any{"type": "error", "error": err.Error()})
+			writeLiveJSON(conn, endLiveSession(session))
+			session = nil
+			continue
+		}
+		if err != nil {
+			writeLiveJSON(conn, map[string]any{"type": "error", "error": err.Error()})
+			continue
+		}
+
+		if session.State == LiveEnded {
+			writeLiveJSON(conn, endLiveSession(session))
+			session = nil
+		}
+	}
+}
+
+// startsLiveSession reports whether a message may open a new set: a start message
+// or the firmware entering ARMING.
+func startsLiveSession(msg liveDeviceMessage) bool {
+	if msg.Type == "start" {
+		return true
+	}
+	if msg.Type != "event" || msg.Event == nil {
+		return false
+	}
+	state, ok := liveStateForEvent(*msg.Event)
+	return ok && state == LiveArmed
+}
+
+// endLiveSession ends the set if the device hadn't, stores it and tells the viewers.
+func endLiveSession(s *liveSession) liveSummary {
+	if s.State != LiveEnded {
+		_ = liveSessions.apply(s, liveDeviceMessage{Type: "end"}, time.Now().UTC())
+	}
+
+	// The device's request context may already be gone; the set should still be saved.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	summary, err := persistLiveSession(ctx, s)
+	if err != nil {
+		log.Printf("live session for user %d not stored: %v", s.UserID, err)
+		summary.SessionID = nil
+		summary.Error = "session could not be stored"
+	}
+
+	liveSessions.finish(s, newLiveUpdate(summary, false))
+	return summary
+}
+
+// persistLiveSession stores an ended set through the same paths as uploads.
+// Streamed samples are stored like a raw upload and counted by the server;
+// a set with only device-detected reps is stored like a /api/reps submission, as is
+// one with samples while the rep classifier isn't loaded, since the server can't
+// verify its count.
+func persistLiveSession(ctx context.Context, s *liveSession) (liveSummary, error) {
+	summary := liveSummary{
+		Type:       "summary",
+		Reps:       len(s.Reps),
+		DeviceReps: s.DeviceReps,
+		Samples:    len(s.Samples),
+	}
+	if s.RecordingAt.IsZero() {
+		return summary, nil
+	}
+	summary.DurationS = s.EndedAt.Sub(s.RecordingAt).Seconds()
+	startedAt := s.RecordingAt
+
+	if len(s.Samples) > 0 && repModel != nil {
+		up := rawSessionUpload{
+			rawSessionMeta: s.Meta,
+			Samples:        s.Samples,
+			Events:         s.Events,
+		}
+		up.StartedAt = &startedAt
+		if up.DeviceReps == nil {
+			up.DeviceReps = s.DeviceReps
+		}
+		if up.DeviceReps == nil && len(s.Reps) > 0 {
+			n := len(s.Reps)
+			up.DeviceReps = &n
+		}
+		if err := normalizeRawSession(&up); err != nil {
+			return summary, err
+		}
+
+		detected, baselineMM, err := detectRawReps(up, repModel)
+		if err != nil {
+			return summary, err
+		}
+		// Like a live session without reps, there is nothing to store.
+		if len(detected) == 0 {
+			return summary, nil
+		}
+		sessionID, _, err := storeRawSession(ctx, s.UserID, &s.DeviceID, up, up.ClientSessionID, detected, baselineMM)
+		if err != nil {
+			return summary, err
+		}
+
+		notifySessionChange(s.UserID, sessionID)
+
+		summary.SessionID = &sessionID
+		summary.Reps = len(detected)
+		summary.DeviceReps = up.DeviceReps
+		summary.Source = up.Source
+		return summary, nil
+	}
+
+	if len(s.Reps) == 0 {
+		return summary, nil
+	}
+
+	endedAt := s.EndedAt
+	if last := startedAt.Add(time.Duration(s.Reps[len(s.Reps)-1].OffsetMS) * time.Millisecond); last.After(endedAt) {
+		// The device's clock ran a little ahead of ours.
+		endedAt = last
+	}
+	req := repRequest{
+		Reps:               len(s.Reps),
+		Scope:              s.Meta.Scope,
+		ClientSessionID:    s.Meta.ClientSessionID,
+		StartedAt:          &startedAt,
+		EndedAt:            &endedAt,
+		RepEvents:          s.Reps,
+		BaselineMM:         liveBaseline(s.Events),
+		sessionAnnotations: s.Meta.sessionAnnotations,
+		DeviceID:           &s.DeviceID,
+	}
+	if err := normalizeRepRequest(&req); err != nil {
+		return summary, err
+	}
+	if err := validateRepRequest(req, time.Now().UTC()); err != nil {
+		return summary, err
+	}
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback(ctx)
+
+	sessionID, _, err := insertRepSession(ctx, tx, s.UserID, req, req.ClientSessionID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	notifySessionChange(s.UserID, sessionID)
+
+	summary.SessionID = &sessionID
+	summary.Source = req.Source
+	return summary, nil
+}
+
+// liveBaseline is the distance the firmware locked during ARMING, if it said.
+func liveBaseline(events []rawEvent) *float64 {
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		if ev.Name == "BASELINE_LOCKED_MM" && ev.Value != nil && *ev.Value > 0 && *ev.Value <= 4000 {
+			v := *ev.Value
+			return &v
+		}
+	}
+	return nil
+}
+
+// handleLiveViewer streams a user's live sessions to the user or one of their friends.
+// Viewers get a snapshot on connect, then state, rep and sample messages and a summary per set.
+func handleLiveViewer(w http.ResponseWriter, r *http.Request) {
+	viewerID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if viewerID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	username := strings.TrimSpace(chi.URLParam(r, "username"))
+	if username == "" {
+		http.Error(w, "missing username", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	targetID, err := liveTargetUserID(ctx, username, viewerID)
+	cancel()
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	viewer, err := liveSessions.subscribe(targetID, targetID == viewerID)
+	if err != nil {
+		closeLive(conn, websocket.CloseTryAgainLater, err.Error())
+		return
+	}
+	defer liveSessions.unsubscribe(targetID, viewer)
+
+	// Viewers don't send anything, but reading is how pongs and close frames arrive.
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(livePingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case payload, ok := <-viewer.send:
+			if !ok {
+				closeLive(conn, websocket.ClosePolicyViolation, "viewer fell too far behind")
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// liveTargetUserID resolves a username the viewer may watch: themselves or a friend.
+// It returns pgx.ErrNoRows otherwise so strangers can't probe who is live.
+func liveTargetUserID(ctx context.Context, username string, viewerID int64) (int64, error) {
+	const q = `
+		SELECT u.id
+		FROM users u
+		WHERE u.username = $1
+		  AND (
+			u.id = $2
+			OR EXISTS (
+				SELECT 1
+				FROM friendships f
+				WHERE f.user_id = $2
+				  AND f.friend_user_id = u.id
+			)
+		  );
+	`
+
+	var id int64
+	err := dbPool.QueryRow(ctx, q, username, viewerID).Scan(&id)
+	return id, err
+}
+
+// livePinger keeps a device connection alive through proxies until done is closed.
+// WriteControl may be called alongside the handler's own writes.
+func livePinger(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(livePingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func writeLiveJSON(conn *websocket.Conn, v any) {
+	_ = conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+	_ = conn.WriteJSON(v)
+}
+
+func closeLive(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(liveWriteWait))
+}
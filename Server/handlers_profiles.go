@@ -12,14 +12,21 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// profileResponse is the public profile. FormScore averages the user's scored
+// sessions and is null until they have one. LongestStreakDays is the longest run of
+// consecutive active days the user has ever had.
 type profileResponse struct {
-	Username     string `json:"username"`
-	CreatedAt    string `json:"createdAt"`
-	TotalReps    int64  `json:"totalReps"`
-	StreakDays   int    `json:"streakDays"`
-	IsFounder    bool   `json:"isFounder"`
-	FriendsCount int    `json:"friendsCount"`
-	IsSelf       bool   `json:"isSelf"`
+	Username          string           `json:"username"`
+	CreatedAt         string           `json:"createdAt"`
+	TotalReps         int64            `json:"totalReps"`
+	QualityReps       int64            `json:"qualityReps"`
+	Provenance        provenanceTotals `json:"provenance"`
+	FormScore         *float64         `json:"formScore"`
+	StreakDays        int              `json:"streakDays"`
+	LongestStreakDays int              `json:"longestStreakDays"`
+	IsFounder         bool             `json:"isFounder"`
+	FriendsCount      int              `json:"friendsCount"`
+	IsSelf            bool             `json:"isSelf"`
 }
 
 // RegisterProfileRoutes attaches profile endpoints under /api.
@@ -28,6 +35,10 @@ func RegisterProfileRoutes(r chi.Router) {
 	r.Delete("/profiles/me", handleDeleteOwnProfile)
 }
 
+// handleGetProfile shows a user's totals as the viewer may see them: their own sessions
+// in full, a friend's public and friends-only sessions, anyone else's public ones.
+// ?source= and ?verified= filter the totals like the leaderboard. Flagged and rejected
+// sessions don't count, as on the leaderboard.
 func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	viewerID := int64(sessionMgr.GetInt(r.Context(), "userID"))
 	if viewerID == 0 {
@@ -41,42 +52,43 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sources, err := parseSourceFilter(r.URL.Query().Get("source"))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	verified, err := parseVerifiedFilter(r.URL.Query().Get("verified"))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// The viewer sees a stranger's public sessions, a friend's friends-only ones as well,
+	// and all of their own: the user_stats row for that scope and the source filters
+	// holds the totals and streaks. Form scores still average the sessions themselves.
 	const q = `
 		WITH target_user AS (
-			SELECT u.id, u.username, u.created_at
+			SELECT
+				u.id,
+				u.username,
+				u.created_at,
+				CASE
+					WHEN u.id = $2 THEN 'private'
+					WHEN EXISTS (
+						SELECT 1
+						FROM friendships vf
+						WHERE vf.user_id = $2
+						  AND vf.friend_user_id = u.id
+					) THEN 'friends'
+					ELSE 'public'
+				END AS visible_scope
 			FROM users u
 			WHERE u.username = $1
 		),
-		daily_activity AS (
-			SELECT DISTINCT
-				rs.user_id,
-				(rs.created_at AT TIME ZONE 'UTC')::date AS activity_day
-			FROM rep_sessions rs
-		),
-		streaks AS (
-			SELECT
-				da.user_id,
-				COUNT(*) FILTER (
-					WHERE da.activity_day = (d.utc_today - (da.rn - 1))
-				)::int AS streak_days
-			FROM (
-				SELECT
-					user_id,
-					activity_day,
-					ROW_NUMBER() OVER (
-						PARTITION BY user_id
-						ORDER BY activity_day DESC
-					)::int AS rn
-				FROM daily_activity
-			) da
-			CROSS JOIN (
-				SELECT (NOW() AT TIME ZONE 'UTC')::date AS utc_today
-			) d
-			GROUP BY da.user_id
-		),
 		founder_candidates AS (
 			SELECT
 				dt.user_id,
@@ -99,33 +111,59 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 			tu.id,
 			tu.username,
 			tu.created_at,
-			COALESCE(SUM(rs.reps), 0)::bigint AS total_reps,
-			COALESCE(s.streak_days, 0) AS streak_days,
+			COALESCE(us.lifetime_reps, 0),
+			COALESCE(us.lifetime_quality_reps, 0),
+			COALESCE(us.lifetime_manual_reps, 0),
+			COALESCE(us.lifetime_device_reps, 0),
+			COALESCE(us.lifetime_verified_reps, 0),
+			COALESCE(us.current_streak, 0),
+			COALESCE(us.longest_streak, 0),
+			us.last_active_day,
+			(
+				SELECT AVG(rs.form_score)::float8
+				FROM rep_sessions rs
+				WHERE rs.user_id = tu.id
+				  AND rs.review_status NOT IN ('flagged', 'rejected')
+				  AND rs.source = ANY($4::text[])
+				  AND (
+					rs.scope = 'public'
+					OR tu.visible_scope = 'private'
+					OR (rs.scope = 'friends' AND tu.visible_scope = 'friends')
+				  )
+			) AS form_score,
 			(founders.user_id IS NOT NULL) AS is_founder,
 			COALESCE(fc.friend_count, 0) AS friend_count
 		FROM target_user tu
-		LEFT JOIN rep_sessions rs
-		  ON rs.user_id = tu.id
-		LEFT JOIN streaks s
-		  ON s.user_id = tu.id
+		LEFT JOIN user_stats us
+		  ON us.user_id = tu.id
+		 AND us.scope = tu.visible_scope
+		 AND us.sources = $3
 		LEFT JOIN founders
 		  ON founders.user_id = tu.id
 		LEFT JOIN friend_counts fc
-		  ON fc.user_id = tu.id
-		GROUP BY tu.id, tu.username, tu.created_at, s.streak_days, founders.user_id, fc.friend_count;
+		  ON fc.user_id = tu.id;
 	`
 
+	mask := sourceMaskOf(sources, verified)
 	var (
 		profileID   int64
 		profile     profileResponse
 		profileTime time.Time
+		stats       userStats
 	)
-	err := dbPool.QueryRow(ctx, q, username).Scan(
+	err = dbPool.QueryRow(ctx, q, username, viewerID, int16(mask), mask.sources()).Scan(
 		&profileID,
 		&profile.Username,
 		&profileTime,
 		&profile.TotalReps,
-		&profile.StreakDays,
+		&profile.QualityReps,
+		&profile.Provenance.Manual,
+		&profile.Provenance.DeviceReported,
+		&profile.Provenance.ServerVerified,
+		&stats.CurrentStreak,
+		&stats.LongestStreak,
+		&stats.LastActiveDay,
+		&profile.FormScore,
 		&profile.IsFounder,
 		&profile.FriendsCount,
 	)
@@ -141,6 +179,14 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	profile.CreatedAt = profileTime.UTC().Format(time.RFC3339)
 	profile.IsSelf = profileID == viewerID
 
+	loc, err := loadUserLocation(ctx, dbPool, profileID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	profile.StreakDays = stats.streakOn(localDate(time.Now(), loc))
+	profile.LongestStreakDays = stats.LongestStreak
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(profile)
 }
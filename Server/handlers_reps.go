@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
@@ -16,82 +15,385 @@ import (
 
 var ErrDeviceTokenInvalid = errors.New("device token invalid")
 
+var (
+	ErrRepsInvalid            = errors.New("invalid reps")
+	ErrSessionEndWithoutStart = errors.New("endedAt requires startedAt")
+	ErrSessionTooOld          = errors.New("session timestamp is too far in the past")
+	ErrSessionInFuture        = errors.New("session timestamp is in the future")
+	ErrSessionEndBeforeStart  = errors.New("endedAt is before startedAt")
+	ErrSessionTooLong         = errors.New("session duration is too long")
+	ErrBaselineInvalid        = errors.New("invalid baselineMm")
+
+	// ErrDeviceTimesRequired keeps device counts checkable: the rep-rate anomaly check
+	// needs the session's duration, so a device can't skip it by leaving the times out.
+	ErrDeviceTimesRequired = &validationError{
+		Field:   "endedAt",
+		Code:    "device_times_required",
+		Message: "device sessions require startedAt and endedAt",
+	}
+)
+
+const (
+	// maxSessionBackdate bounds how old an offline-buffered session may be.
+	maxSessionBackdate = 14 * 24 * time.Hour
+	// maxSessionClockSkew tolerates device clocks that run slightly ahead of ours.
+	maxSessionClockSkew = 5 * time.Minute
+	// maxSessionDuration rejects sessions that obviously span more than one workout.
+	maxSessionDuration = 12 * time.Hour
+
+	maxRepBatchSize  = 100
+	maxRepBatchBytes = 1 << 20
+)
+
 type repRequest struct {
 	Reps   int    `json:"reps"`
 	Source string `json:"source"`
 	Scope  string `json:"scope"`
+
+	// ClientSessionID is an optional device-generated UUID used to dedupe retries.
+	ClientSessionID string `json:"clientSessionId"`
+
+	// StartedAt and EndedAt are device timestamps, required for device sessions.
+	// When missing, the server's clock is used.
+	StartedAt *time.Time `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+
+	// RepEvents optionally describes each rep; when present there must be one per rep.
+	RepEvents []repEvent `json:"repEvents"`
+	// BaselineMM is the distance the device locked at the top, used to score lockout.
+	BaselineMM *float64 `json:"baselineMm"`
+
+	sessionAnnotations
+
+	// DeviceID is set by the server from X-Device-Token, never by the client.
+	DeviceID *int64 `json:"-"`
+	// DeviceReps is what a raw upload's device counted when the server counted Reps itself.
+	DeviceReps *int `json:"-"`
+}
+
+type repBatchRequest struct {
+	Sessions []repRequest `json:"sessions"`
+}
+
+// repBatchResult reports what happened to one item of a batch upload.
+type repBatchResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"` // created, replayed, invalid, conflict
+	SessionID int64  `json:"sessionId,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Field and Code are set when the item failed a vocabulary check (see validationError).
+	Field string `json:"field,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+func (res *repBatchResult) invalid(err error) {
+	res.Status = "invalid"
+	res.Error = err.Error()
+
+	var ve *validationError
+	if errors.As(err, &ve) {
+		res.Field = ve.Field
+		res.Code = ve.Code
+	}
 }
 
 // RegisterRepRoutes attaches rep ingestion endpoints under /api.
 func RegisterRepRoutes(r chi.Router) {
 	r.Post("/reps", handleReps)
+	r.Post("/reps/batch", handleRepsBatch)
 }
 
-// handleReps accepts device or session-authenticated rep submissions.
+// handleReps accepts device or session-authenticated rep submissions, as JSON or CBOR.
 func handleReps(w http.ResponseWriter, r *http.Request) {
-	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
-	if userID == 0 {
-		token := strings.TrimSpace(r.Header.Get("X-Device-Token"))
-		if token == "" {
-			http.Error(w, "missing device token", http.StatusUnauthorized)
-			return
-		}
-
-		var err error
-		userID, err = userIDFromDeviceToken(r.Context(), token)
-		if err != nil {
-			http.Error(w, "invalid device token", http.StatusUnauthorized)
-			return
-		}
+	userID, deviceID, ok := repSubmitterID(w, r)
+	if !ok {
+		return
 	}
 
 	var req repRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeDeviceBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	req.DeviceID = deviceID
 
-	if req.Reps <= 0 || req.Reps > 1000 {
-		http.Error(w, "invalid reps", http.StatusBadRequest)
+	if err := prepareRepRequest(&req, time.Now().UTC()); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	key, err := idempotencyKeyFromRequest(r, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	const q = `
-		INSERT INTO rep_sessions (user_id, reps, scope, source)
-		VALUES ($1, $2, $3, $4);
-	`
+	sessionID, replayed, err := storeRepRequest(ctx, userID, req, key)
+	if errors.Is(err, ErrIdempotencyConflict) {
+		http.Error(w, "idempotency key already used for a different submission", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A replay gets the same body as the original so retrying clients can't tell the difference.
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	writeDeviceResponse(w, r, http.StatusOK, map[string]any{"ok": true, "sessionId": sessionID})
+}
+
+// handleRepsBatch stores sessions a device buffered while offline.
+// Invalid items are reported and skipped; valid items are inserted in one transaction.
+func handleRepsBatch(w http.ResponseWriter, r *http.Request) {
+	userID, deviceID, ok := repSubmitterID(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRepBatchBytes)
+
+	var req repBatchRequest
+	if err := decodeDeviceBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Sessions) == 0 {
+		http.Error(w, "sessions is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sessions) > maxRepBatchSize {
+		http.Error(w, "too many sessions in one batch", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now().UTC()
+	results := make([]repBatchResult, len(req.Sessions))
+	keys := make([]string, len(req.Sessions))
+
+	for i, item := range req.Sessions {
+		results[i].Index = i
+		req.Sessions[i].DeviceID = deviceID
+
+		err := prepareRepRequest(&req.Sessions[i], now)
+		item = req.Sessions[i]
+		if err != nil {
+			results[i].invalid(err)
+			continue
+		}
+
+		key, err := normalizeIdempotencyKey(item.ClientSessionID)
+		if err != nil {
+			results[i].invalid(err)
+			continue
+		}
+		keys[i] = key
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	if _, err := dbPool.Exec(ctx, q, userID, req.Reps, req.Scope, req.Source); err != nil {
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback(ctx)
+
+	for i, item := range req.Sessions {
+		if results[i].Status == "invalid" {
+			continue
+		}
+
+		sessionID, replayed, err := insertRepSession(ctx, tx, userID, item, keys[i])
+		if errors.Is(err, ErrIdempotencyConflict) {
+			results[i].Status = "conflict"
+			results[i].Error = "idempotency key already used for a different submission"
+			continue
+		}
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+
+		results[i].SessionID = sessionID
+		if replayed {
+			results[i].Status = "replayed"
+		} else {
+			results[i].Status = "created"
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	for _, res := range results {
+		if res.Status == "created" {
+			notifySessionChange(userID, res.SessionID)
+		}
+	}
+
+	writeDeviceResponse(w, r, http.StatusOK, map[string]any{
+		"ok":      true,
+		"results": results,
+	})
+}
+
+// prepareRepRequest normalizes and validates one submission. Its errors are the
+// client's fault and safe to show them.
+func prepareRepRequest(req *repRequest, now time.Time) error {
+	if err := normalizeRepRequest(req); err != nil {
+		return err
+	}
+	return validateRepRequest(*req, now)
+}
+
+// storeRepRequest stores one prepared submission in its own transaction and announces
+// it once committed. It is the path every single-session submission takes, whether it
+// arrived over HTTP or MQTT.
+func storeRepRequest(ctx context.Context, userID int64, req repRequest, key string) (sessionID int64, replayed bool, err error) {
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	sessionID, replayed, err = insertRepSession(ctx, tx, userID, req, key)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, err
+	}
+
+	if !replayed {
+		notifySessionChange(userID, sessionID)
+	}
+	return sessionID, replayed, nil
+}
+
+// repSubmitterID resolves the user behind a rep submission.
+// Logged-in browsers use their session cookie; devices send X-Device-Token.
+// deviceID is the device_tokens row for device submissions and nil otherwise.
+func repSubmitterID(w http.ResponseWriter, r *http.Request) (userID int64, deviceID *int64, ok bool) {
+	userID = int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID != 0 {
+		return userID, nil, true
+	}
+
+	token := strings.TrimSpace(r.Header.Get("X-Device-Token"))
+	if token == "" {
+		http.Error(w, "missing device token", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	userID, id, err := userIDFromDeviceToken(r.Context(), token)
+	if err != nil {
+		http.Error(w, "invalid device token", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	return userID, &id, true
+}
+
+// normalizeRepRequest resolves defaults and canonical spellings before validation:
+// source and scope vocabularies and annotation formatting.
+func normalizeRepRequest(req *repRequest) error {
+	source, err := normalizeSessionSource(req.Source, req.DeviceID != nil)
+	if err != nil {
+		return err
+	}
+	scope, err := normalizeSessionScope(req.Scope)
+	if err != nil {
+		return err
+	}
+
+	req.Source = source
+	req.Scope = scope
+	req.sessionAnnotations = normalizeSessionAnnotations(req.sessionAnnotations)
+	return nil
+}
+
+// validateRepRequest checks the rep count, any device timestamps against now, the baseline,
+// annotations and per-rep events. Device sessions must carry both timestamps.
+func validateRepRequest(req repRequest, now time.Time) error {
+	if req.Reps <= 0 || req.Reps > 1000 {
+		return ErrRepsInvalid
+	}
+	if req.Source == SourceDevice && (req.StartedAt == nil || req.EndedAt == nil) {
+		return ErrDeviceTimesRequired
+	}
+	if err := validateSessionTimes(req.StartedAt, req.EndedAt, now); err != nil {
+		return err
+	}
+	if req.BaselineMM != nil && (*req.BaselineMM <= 0 || *req.BaselineMM > 4000) {
+		return ErrBaselineInvalid
+	}
+	if err := validateSessionAnnotations(req.sessionAnnotations); err != nil {
+		return err
+	}
+	return validateRepEvents(req)
+}
+
+// validateSessionTimes keeps device timestamps within a sane range of the server clock.
+func validateSessionTimes(startedAt, endedAt *time.Time, now time.Time) error {
+	if startedAt == nil {
+		if endedAt != nil {
+			return ErrSessionEndWithoutStart
+		}
+		return nil
+	}
+
+	if startedAt.Before(now.Add(-maxSessionBackdate)) {
+		return ErrSessionTooOld
+	}
+	if startedAt.After(now.Add(maxSessionClockSkew)) {
+		return ErrSessionInFuture
+	}
+
+	if endedAt == nil {
+		return nil
+	}
+	if endedAt.Before(*startedAt) {
+		return ErrSessionEndBeforeStart
+	}
+	if endedAt.After(now.Add(maxSessionClockSkew)) {
+		return ErrSessionInFuture
+	}
+	if endedAt.Sub(*startedAt) > maxSessionDuration {
+		return ErrSessionTooLong
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
+	return nil
 }
 
-func userIDFromDeviceToken(ctx context.Context, token string) (int64, error) {
+// userIDFromDeviceToken returns the token's owner and the device_tokens row ID.
+func userIDFromDeviceToken(ctx context.Context, token string) (userID, deviceID int64, err error) {
 	hash := hashDeviceToken(token)
 
 	const q = `
-		SELECT user_id
+		SELECT user_id, id
 		FROM device_tokens
 		WHERE token_hash = $1;
 	`
 
-	var userID int64
-	err := dbPool.QueryRow(ctx, q, hash).Scan(&userID)
+	err = dbPool.QueryRow(ctx, q, hash).Scan(&userID, &deviceID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, ErrDeviceTokenInvalid
+			return 0, 0, ErrDeviceTokenInvalid
 		}
-		return 0, err
+		return 0, 0, err
 	}
 
-	return userID, nil
+	return userID, deviceID, nil
 }
 
 func hashDeviceToken(token string) string {
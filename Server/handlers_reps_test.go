@@ -3,6 +3,7 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHashDeviceToken(t *testing.T) {
@@ -15,3 +16,34 @@ func TestHashDeviceToken(t *testing.T) {
 		t.Fatalf("hash should be lowercase hex: %s", hash)
 	}
 }
+
+func TestValidateSessionTimes(t *testing.T) {
+	now := time.Date(2026, 3, 23, 20, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+
+	cases := []struct {
+		name    string
+		started *time.Time
+		ended   *time.Time
+		want    error
+	}{
+		{"no timestamps", nil, nil, nil},
+		{"offline yesterday", at(-24 * time.Hour), at(-24*time.Hour + time.Minute), nil},
+		{"slight clock skew", at(2 * time.Minute), nil, nil},
+		{"end without start", nil, at(0), ErrSessionEndWithoutStart},
+		{"too old", at(-maxSessionBackdate - time.Hour), nil, ErrSessionTooOld},
+		{"future start", at(time.Hour), nil, ErrSessionInFuture},
+		{"future end", at(-time.Minute), at(time.Hour), ErrSessionInFuture},
+		{"end before start", at(-time.Minute), at(-2 * time.Minute), ErrSessionEndBeforeStart},
+		{"too long", at(-13 * time.Hour), at(0), ErrSessionTooLong},
+	}
+
+	for _, tc := range cases {
+		if got := validateSessionTimes(tc.started, tc.ended, now); got != tc.want {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
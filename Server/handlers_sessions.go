@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// RegisterSessionRoutes attaches rep session endpoints under /api.
+func RegisterSessionRoutes(r chi.Router) {
+	r.Post("/sessions/raw", handleRawSessionUpload)
+	r.Get("/sessions/{sessionID}", handleGetSession)
+	r.Patch("/sessions/{sessionID}", handlePatchSession)
+	r.Delete("/sessions/{sessionID}", handleDeleteSession)
+	r.Get("/sessions/{sessionID}/reps", handleGetSessionReps)
+	r.Get("/sessions/{sessionID}/revisions", handleGetSessionRevisions)
+	r.Get("/me/sessions", handleListMySessions)
+}
+
+// handleRawSessionUpload stores a device's raw sensor stream and counts reps on the server.
+// The body is the firmware's serial output as text/csv, a JSON or CBOR object,
+// NDJSON (application/x-ndjson) with one meta, sample or event record per line,
+// or a binary sample frame (firmware.FrameContentType).
+// Without the rep classifier the server can't verify a count, so uploads get 503 until it loads.
+func handleRawSessionUpload(w http.ResponseWriter, r *http.Request) {
+	userID, deviceID, ok := repSubmitterID(w, r)
+	if !ok {
+		return
+	}
+	if repModel == nil {
+		http.Error(w, "rep classifier unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRawBodyBytes)
+
+	var (
+		up  rawSessionUpload
+		err error
+	)
+	switch requestMediaType(r) {
+	case "text/csv", "text/plain":
+		up, err = parseRawCSV(r.Body)
+		if err == nil {
+			up.rawSessionMeta, err = rawSessionMetaFromQuery(r.URL.Query())
+		}
+	case firmware.FrameContentType:
+		up, err = parseRawFrame(r.Body)
+		if err == nil {
+			up.rawSessionMeta, err = rawSessionMetaFromQuery(r.URL.Query())
+		}
+	case "application/x-ndjson":
+		up, err = parseRawNDJSON(r.Body)
+	case "application/json", contentTypeCBOR, "":
+		err = decodeDeviceBody(r, &up)
+	default:
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := normalizeRawSession(&up); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if err := validateSessionTimes(up.StartedAt, nil, time.Now().UTC()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := idempotencyKeyFromRequest(r, repRequest{ClientSessionID: up.ClientSessionID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	up.ClientSessionID = key
+
+	detected, baselineMM, err := detectRawReps(up, repModel)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessionID, replayed, err := storeRawSession(ctx, userID, deviceID, up, key, detected, baselineMM)
+	if errors.Is(err, ErrRawNoReps) {
+		writeRequestErrorStatus(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, ErrIdempotencyConflict) {
+		http.Error(w, "idempotency key already used for a different submission", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	} else {
+		notifySessionChange(userID, sessionID)
+	}
+
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	writeDeviceResponse(w, r, status, map[string]any{
+		"ok":         true,
+		"sessionId":  sessionID,
+		"reps":       len(detected),
+		"deviceReps": up.DeviceReps,
+		"baselineMm": baselineMM,
+		"samples":    len(up.Samples),
+	})
+}
+
+// handleGetSessionReps lists the individual reps of a session.
+// Owners and their friends can see them; anyone else gets 404 so session IDs don't leak.
+func handleGetSessionReps(w http.ResponseWriter, r *http.Request) {
+	viewerID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if viewerID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	session, err := loadRepSession(ctx, dbPool, sessionID, viewerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := loadRepEvents(ctx, dbPool, sessionID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"sessionId":   sessionID,
+		"reps":        session.Reps,
+		"baselineMm":  session.BaselineMM,
+		"formScore":   session.FormScore,
+		"qualityReps": session.QualityReps,
+		"events":      events,
+	})
+}
+
+// handleGetSession returns one session with its annotations.
+// Owners and their friends can see it; notes are only shown to the owner.
+func handleGetSession(w http.ResponseWriter, r *http.Request) {
+	viewerID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if viewerID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	session, err := loadRepSession(ctx, dbPool, sessionID, viewerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// handlePatchSession lets the owner correct a session: its rep count, times, scope and annotations.
+// Device-counted sessions need ?force=true to change the count or times.
+func handlePatchSession(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	var patch sessionPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the patched fields the same way as on submission.
+	if patch.Reps != nil && (*patch.Reps <= 0 || *patch.Reps > 1000) {
+		http.Error(w, ErrRepsInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Scope != nil {
+		scope, err := normalizeSessionScope(*patch.Scope)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		patch.Scope = &scope
+	}
+
+	var a sessionAnnotations
+	if patch.Pace != nil {
+		a.Pace = *patch.Pace
+	}
+	if patch.Notes != nil {
+		a.Notes = *patch.Notes
+	}
+	if patch.Tags != nil {
+		a.Tags = *patch.Tags
+	}
+	a = normalizeSessionAnnotations(a)
+	if err := validateSessionAnnotations(a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Pace != nil {
+		patch.Pace = &a.Pace
+	}
+	if patch.Notes != nil {
+		patch.Notes = &a.Notes
+	}
+	if patch.Tags != nil {
+		patch.Tags = &a.Tags
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	err = updateRepSession(ctx, tx, sessionID, userID, patch, forceParam(r), time.Now().UTC())
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if !writeSessionEditError(w, err) {
+		return
+	}
+	notifySessionChange(userID, sessionID)
+
+	session, err := loadRepSession(ctx, dbPool, sessionID, userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// handleDeleteSession removes one of the owner's sessions.
+// Device-counted sessions need ?force=true.
+func handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	err = deleteRepSession(ctx, tx, sessionID, userID, forceParam(r))
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if !writeSessionEditError(w, err) {
+		return
+	}
+	notifySessionChange(userID, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "sessionId": sessionID})
+}
+
+// handleGetSessionRevisions returns a session's change history to its owner or an admin.
+func handleGetSessionRevisions(w http.ResponseWriter, r *http.Request) {
+	viewerID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if viewerID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, ok := parseSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	revisions, err := loadSessionRevisions(ctx, dbPool, sessionID, viewerID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"sessionId": sessionID,
+		"revisions": revisions,
+	})
+}
+
+// handleListMySessions pages through the logged-in user's sessions, newest first.
+// ?from= and ?to= take a date (YYYY-MM-DD in the viewer's time zone, both inclusive) or an
+// RFC 3339 time (to is exclusive);
+// ?limit= is the page size and ?cursor= the nextCursor of the previous page.
+func handleListMySessions(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := sessionListFilter{Limit: defaultSessionPageSize}
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxSessionPageSize {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := parseSessionCursor(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.After = &cursor
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	loc, err := loadUserLocation(ctx, dbPool, userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if filter.From, err = parseDateBound(query.Get("from"), false, loc); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseDateBound(query.Get("to"), true, loc); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	sessions, next, err := listUserSessions(ctx, dbPool, userID, filter)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor *string
+	if next != nil {
+		s := next.String()
+		nextCursor = &s
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"sessions":   sessions,
+		"nextCursor": nextCursor,
+	})
+}
+
+// writeSessionEditError maps the errors of updateRepSession and deleteRepSession to responses.
+// It returns true when err is nil and the handler should carry on.
+func writeSessionEditError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "session not found", http.StatusNotFound)
+	case errors.Is(err, ErrSessionDeviceCounted), errors.Is(err, ErrSessionRejected):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case isSessionTimeError(err):
+		writeRequestError(w, err)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// forceParam reads ?force=true, which allows changing device-counted sessions.
+func forceParam(r *http.Request) bool {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	return force
+}
+
+// parseDateBound reads a from/to query value. A bare date covers the whole day in loc,
+// so as an upper bound it becomes the start of the next day. Empty means unbounded.
+func parseDateBound(raw string, upper bool, loc *time.Location) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	if day, err := time.ParseInLocation(time.DateOnly, raw, loc); err == nil {
+		if upper {
+			day = day.AddDate(0, 0, 1)
+		}
+		day = day.UTC()
+		return &day, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func parseSessionID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	idText := strings.TrimSpace(chi.URLParam(r, "sessionID"))
+	sessionID, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || sessionID <= 0 {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return sessionID, true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrTimeZoneInvalid = &validationError{
+	Field:   "timeZone",
+	Code:    "invalid_time_zone",
+	Message: "timeZone must be an IANA time zone such as America/Los_Angeles",
+}
+
+// userSettings are the viewer's own preferences.
+type userSettings struct {
+	// TimeZone is the IANA zone the user's days are counted in: streaks, and the
+	// today/this-week/this-month leaderboard windows. Null until set, counted as UTC.
+	TimeZone *string `json:"timeZone"`
+}
+
+// settingsPatch is a PATCH /api/me/settings body; omitted fields are left alone.
+type settingsPatch struct {
+	TimeZone *string `json:"timeZone"`
+}
+
+// RegisterSettingsRoutes attaches the viewer's settings under /api.
+func RegisterSettingsRoutes(r chi.Router) {
+	r.Get("/me/settings", handleGetSettings)
+	r.Patch("/me/settings", handlePatchSettings)
+}
+
+func handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	settings, err := loadUserSettings(ctx, dbPool, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(settings)
+}
+
+// handlePatchSettings changes the viewer's settings and returns them all.
+func handlePatchSettings(w http.ResponseWriter, r *http.Request) {
+	userID := int64(sessionMgr.GetInt(r.Context(), "userID"))
+	if userID == 0 {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	var patch settingsPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if patch.TimeZone != nil {
+		name, err := normalizeTimeZone(*patch.TimeZone)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		patch.TimeZone = &name
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if patch.TimeZone != nil {
+		err := setUserTimeZone(ctx, userID, *patch.TimeZone)
+		if errors.Is(err, ErrTimeZoneInvalid) {
+			writeRequestError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	settings, err := loadUserSettings(ctx, dbPool, userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The user's streak may have moved with the zone, though no session changed.
+	if patch.TimeZone != nil {
+		notifySessionChange(userID, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(settings)
+}
+
+// setUserTimeZone stores the user's zone and recounts their days in it.
+func setUserTimeZone(ctx context.Context, userID int64, name string) error {
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Postgres does the day arithmetic, so it has to know the zone as well as Go does.
+	const q = `
+		UPDATE users
+		SET time_zone = $2
+		WHERE id = $1
+		  AND EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = $2);
+	`
+	tag, err := tx.Exec(ctx, q, userID, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTimeZoneInvalid
+	}
+
+	if err := rebuildUserStats(ctx, tx, []int64{userID}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func loadUserSettings(ctx context.Context, db dbQuerier, userID int64) (userSettings, error) {
+	const q = `
+		SELECT time_zone
+		FROM users
+		WHERE id = $1;
+	`
+
+	var settings userSettings
+	err := db.QueryRow(ctx, q, userID).Scan(&settings.TimeZone)
+	return settings, err
+}
+
+// loadUserLocation returns the zone a user's days are counted in, UTC until they set one.
+func loadUserLocation(ctx context.Context, db dbQuerier, userID int64) (*time.Location, error) {
+	settings, err := loadUserSettings(ctx, db, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && settings.TimeZone == nil) {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(*settings.TimeZone)
+	if err != nil {
+		// Stored before this build's zone database knew it: count in UTC rather than fail.
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// normalizeTimeZone accepts IANA zone names. "Local" and "" would mean the server's
+// own zone to Go, which no user means.
+func normalizeTimeZone(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" || len(name) > 64 {
+		return "", ErrTimeZoneInvalid
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return "", ErrTimeZoneInvalid
+	}
+	return loc.String(), nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeTimeZone(t *testing.T) {
+	for in, want := range map[string]string{
+		"America/Los_Angeles": "America/Los_Angeles",
+		" Europe/Berlin ":     "Europe/Berlin",
+		"UTC":                 "UTC",
+	} {
+		got, err := normalizeTimeZone(in)
+		if err != nil || got != want {
+			t.Fatalf("%q: %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "Local", "Mars/Olympus_Mons", "PST8PDT/../../etc", "+05:00"} {
+		if _, err := normalizeTimeZone(in); !errors.Is(err, ErrTimeZoneInvalid) {
+			t.Fatalf("%q: %v; want ErrTimeZoneInvalid", in, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A leaderboard feed keeps one whole board up to date for every stream that shows it:
+// it reloads once per burst of session changes, however many streams are open, and each
+// stream cuts its own page out of the shared board in memory.
+
+// leaderboardFeedKey is what a shared board depends on. Calendar windows also depend on
+// the viewer's zone; the sliding ones don't, so their Zone is empty.
+type leaderboardFeedKey struct {
+	Window string
+	Zone   string
+	Stats  statsKey
+}
+
+func newLeaderboardFeedKey(q leaderboardQuery, loc *time.Location) leaderboardFeedKey {
+	key := leaderboardFeedKey{Window: q.Window, Zone: loc.String(), Stats: q.statsKey()}
+	if _, _, byDay := leaderboardWindowDays(time.Now(), q.Window, loc); !byDay {
+		key.Zone = ""
+	}
+	return key
+}
+
+// leaderboardSnapshot is a whole ranked board as one load left it. Subscribers share it
+// and must not modify it. Err is set instead when the load failed.
+type leaderboardSnapshot struct {
+	Rows  []LeaderboardRow
+	Index map[int64]int // row by user ID
+	Err   error
+}
+
+func newLeaderboardSnapshot(rows []LeaderboardRow, err error) *leaderboardSnapshot {
+	index := make(map[int64]int, len(rows))
+	for i, row := range rows {
+		index[row.UserID] = i
+	}
+	return &leaderboardSnapshot{Rows: rows, Index: index, Err: err}
+}
+
+// leaderboardFeedLoader loads a whole board for a feed.
+type leaderboardFeedLoader func(ctx context.Context, key leaderboardFeedKey, loc *time.Location) ([]LeaderboardRow, error)
+
+func loadLeaderboardFeed(ctx context.Context, key leaderboardFeedKey, loc *time.Location) ([]LeaderboardRow, error) {
+	return loadLeaderboardBoard(ctx, newLeaderboardBoard(time.Now(), key.Window, key.Stats, loc))
+}
+
+// leaderboardFeeds runs a feed for each board some stream is showing.
+type leaderboardFeeds struct {
+	bus  sessionChangeBus
+	load leaderboardFeedLoader
+
+	// debounce batches a burst of changes into one reload; slide reloads sliding windows,
+	// where reps age out without any change; rescan catches what a change can't tell us.
+	debounce, slide, rescan time.Duration
+
+	mu    sync.Mutex
+	feeds map[leaderboardFeedKey]*leaderboardFeed
+}
+
+type leaderboardFeed struct {
+	latest atomic.Pointer[leaderboardSnapshot]
+	stop   context.CancelFunc
+
+	// subs is guarded by leaderboardFeeds.mu.
+	subs map[*leaderboardFeedSubscription]struct{}
+}
+
+// leaderboardFeedSubscription is told on C, without blocking, when its feed has a new
+// snapshot; Snapshot is the latest, nil until the first load.
+type leaderboardFeedSubscription struct {
+	C    chan struct{}
+	key  leaderboardFeedKey
+	feed *leaderboardFeed
+}
+
+func (s *leaderboardFeedSubscription) Snapshot() *leaderboardSnapshot {
+	return s.feed.latest.Load()
+}
+
+func newLeaderboardFeeds(bus sessionChangeBus, load leaderboardFeedLoader) *leaderboardFeeds {
+	return &leaderboardFeeds{
+		bus:      bus,
+		load:     load,
+		debounce: leaderboardStreamDebounce,
+		slide:    leaderboardStreamSlide,
+		rescan:   leaderboardStreamRescan,
+		feeds:    map[leaderboardFeedKey]*leaderboardFeed{},
+	}
+}
+
+// leaderboardStreams are the feeds behind /api/leaderboard/stream.
+var leaderboardStreams = newLeaderboardFeeds(sessionChanges, loadLeaderboardFeed)
+
+// Subscribe joins the feed for key, starting it for the first subscriber. loc is the
+// zone a new feed counts calendar windows in.
+func (f *leaderboardFeeds) Subscribe(key leaderboardFeedKey, loc *time.Location) *leaderboardFeedSubscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed := f.feeds[key]
+	if feed == nil {
+		ctx, stop := context.WithCancel(context.Background())
+		feed = &leaderboardFeed{stop: stop, subs: map[*leaderboardFeedSubscription]struct{}{}}
+		f.feeds[key] = feed
+		go f.run(ctx, key, loc, feed)
+	}
+
+	sub := &leaderboardFeedSubscription{C: make(chan struct{}, 1), key: key, feed: feed}
+	feed.subs[sub] = struct{}{}
+	if feed.latest.Load() != nil {
+		sub.C <- struct{}{}
+	}
+	return sub
+}
+
+// Unsubscribe leaves a feed, stopping it after its last subscriber.
+func (f *leaderboardFeeds) Unsubscribe(sub *leaderboardFeedSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(sub.feed.subs, sub)
+	if len(sub.feed.subs) == 0 && f.feeds[sub.key] == sub.feed {
+		delete(f.feeds, sub.key)
+		sub.feed.stop()
+	}
+}
+
+func (f *leaderboardFeeds) publish(feed *leaderboardFeed, snap *leaderboardSnapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed.latest.Store(snap)
+	for sub := range feed.subs {
+		select {
+		case sub.C <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *leaderboardFeeds) run(ctx context.Context, key leaderboardFeedKey, loc *time.Location, feed *leaderboardFeed) {
+	// Subscribe before the first load so nothing committed in between is missed.
+	changes := f.bus.Subscribe()
+	defer f.bus.Unsubscribe(changes)
+
+	reload := func() {
+		rows, err := f.load(ctx, key, loc)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("leaderboard feed %+v: %v", key, err)
+		}
+		f.publish(feed, newLeaderboardSnapshot(rows, err))
+	}
+	reload()
+
+	rescanEvery := f.rescan
+	if key.Zone == "" {
+		rescanEvery = f.slide
+	}
+	rescan := time.NewTicker(rescanEvery)
+	defer rescan.Stop()
+
+	// debounce is armed by the first change and fires once for the whole burst.
+	debounce := time.NewTimer(f.debounce)
+	debounce.Stop()
+	pending := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-changes.C:
+			// Anyone can appear on a shared board, so every change is relevant, and a
+			// lagged subscription only lost changes that would have reloaded it anyway.
+			changes.Lagged.Store(false)
+			if !pending {
+				pending = true
+				debounce.Reset(f.debounce)
+			}
+
+		case <-debounce.C:
+			pending = false
+			reload()
+
+		case <-rescan.C:
+			reload()
+		}
+	}
+}
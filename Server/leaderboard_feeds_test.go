@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFeedLoader loads a one-row board and counts the loads per key.
+type countingFeedLoader struct {
+	mu    sync.Mutex
+	loads map[leaderboardFeedKey]int
+	total atomic.Int64
+}
+
+func (l *countingFeedLoader) load(ctx context.Context, key leaderboardFeedKey, loc *time.Location) ([]LeaderboardRow, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loads[key]++
+	n := int(l.total.Add(1))
+	return []LeaderboardRow{{UserID: 1, Username: "ann", TotalReps: n, Rank: 1}}, nil
+}
+
+func (l *countingFeedLoader) count(key leaderboardFeedKey) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loads[key]
+}
+
+func newTestFeeds() (*leaderboardFeeds, *localSessionBus, *countingFeedLoader) {
+	bus := newLocalSessionBus()
+	loader := &countingFeedLoader{loads: map[leaderboardFeedKey]int{}}
+	feeds := newLeaderboardFeeds(bus, loader.load)
+	feeds.debounce = 10 * time.Millisecond
+	return feeds, bus, loader
+}
+
+func waitForSnapshot(t *testing.T, sub *leaderboardFeedSubscription) *leaderboardSnapshot {
+	t.Helper()
+	select {
+	case <-sub.C:
+		return sub.Snapshot()
+	case <-time.After(2 * time.Second):
+		t.Fatal("no snapshot")
+		return nil
+	}
+}
+
+func TestLeaderboardFeedsShareOneLoad(t *testing.T) {
+	feeds, bus, loader := newTestFeeds()
+	key := leaderboardFeedKey{Window: "today", Zone: "UTC", Stats: statsKey{ScopePublic, allSources}}
+
+	a := feeds.Subscribe(key, time.UTC)
+	defer feeds.Unsubscribe(a)
+	first := waitForSnapshot(t, a)
+
+	// A second stream of the same board joins the running feed and gets its board at once.
+	b := feeds.Subscribe(key, time.UTC)
+	defer feeds.Unsubscribe(b)
+	if got := waitForSnapshot(t, b); got != first {
+		t.Fatal("second subscriber didn't get the shared board")
+	}
+
+	// A burst of changes is one reload, whichever stream it is for.
+	for i := range 5 {
+		bus.Publish(sessionChange{UserID: int64(i)})
+	}
+	next := waitForSnapshot(t, a)
+	if got := waitForSnapshot(t, b); got != next || next == first {
+		t.Fatal("subscribers saw different boards after a change")
+	}
+	if n := loader.count(key); n != 2 {
+		t.Fatalf("loaded %d times; want 2", n)
+	}
+
+	// Another board is another feed.
+	friends := key
+	friends.Stats.Scope = ScopeFriends
+	c := feeds.Subscribe(friends, time.UTC)
+	defer feeds.Unsubscribe(c)
+	waitForSnapshot(t, c)
+	if n := loader.count(friends); n != 1 {
+		t.Fatalf("friends board loaded %d times", n)
+	}
+}
+
+func TestLeaderboardFeedStopsAfterLastSubscriber(t *testing.T) {
+	feeds, _, _ := newTestFeeds()
+	key := leaderboardFeedKey{Window: "minute", Stats: statsKey{ScopePublic, allSources}}
+
+	a := feeds.Subscribe(key, time.UTC)
+	b := feeds.Subscribe(key, time.UTC)
+	waitForSnapshot(t, a)
+
+	feeds.Unsubscribe(a)
+	if len(feeds.feeds) != 1 {
+		t.Fatal("feed stopped with a subscriber left")
+	}
+	feeds.Unsubscribe(b)
+	if len(feeds.feeds) != 0 {
+		t.Fatal("feed still running without subscribers")
+	}
+
+	// Subscribing again starts a fresh feed.
+	c := feeds.Subscribe(key, time.UTC)
+	defer feeds.Unsubscribe(c)
+	if c.feed == a.feed {
+		t.Fatal("reused a stopped feed")
+	}
+}
+
+func TestNewLeaderboardFeedKey(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := newLeaderboardFeedKey(leaderboardQuery{Scope: "global", Window: "today"}, la)
+	if today.Zone != "America/Los_Angeles" || today.Stats != (statsKey{ScopePublic, allSources}) {
+		t.Fatalf("today: %+v", today)
+	}
+	// Sliding windows are the same board in every zone.
+	minute := newLeaderboardFeedKey(leaderboardQuery{Scope: "friends", Window: "minute", Verified: true}, la)
+	if minute.Zone != "" || minute.Stats != (statsKey{ScopeFriends, sourceBit(SourceServerDetected)}) {
+		t.Fatalf("minute: %+v", minute)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Live session states. They follow the firmware's State enum: ARMING is armed,
+// COUNTDOWN is countdown, RECORDING and END_HOLD are recording, and the return to IDLE is ended.
+type liveState string
+
+const (
+	LiveIdle      liveState = "idle" // no live session; only ever sent to viewers
+	LiveArmed     liveState = "armed"
+	LiveCountdown liveState = "countdown"
+	LiveRecording liveState = "recording"
+	LiveEnded     liveState = "ended"
+)
+
+var (
+	ErrLiveBusy       = errors.New("a live session is already running for this user")
+	ErrLiveTransition = errors.New("invalid live state transition")
+	ErrLiveNotLive    = errors.New("samples and reps are only accepted while recording")
+	ErrLiveMessage    = errors.New("invalid live message")
+	ErrLiveTooLarge   = errors.New("live session has too many samples, events or reps")
+)
+
+const (
+	// maxLiveSamplesPerMessage keeps one frame small; the firmware samples at 10Hz.
+	maxLiveSamplesPerMessage = 100
+	// liveViewerBuffer is how many messages a viewer may fall behind by before
+	// sample frames are dropped for it.
+	liveViewerBuffer   = 64
+	maxLiveViewers     = 50
+	maxLiveRepsPerLive = 1000
+)
+
+// liveStateRank orders the lifecycle; a session only moves forward.
+var liveStateRank = map[liveState]int{LiveArmed: 1, LiveCountdown: 2, LiveRecording: 3, LiveEnded: 4}
+
+// liveStateForEvent maps a firmware EVENT to the lifecycle. The firmware reports the state
+// it is in when the event is emitted, and the SESSION_STOPPED_* and STOP_CMD_IDLE events
+// are its last words before returning to IDLE.
+func liveStateForEvent(ev rawEvent) (liveState, bool) {
+	switch ev.Name {
+	case "SESSION_STOPPED_CLEAN_SPAN_MM", "SESSION_STOPPED_TIMEOUT_SPAN_MM", "STOP_CMD_IDLE":
+		return LiveEnded, true
+	}
+
+	switch ev.State {
+	case "ARMING":
+		return LiveArmed, true
+	case "COUNTDOWN":
+		return LiveCountdown, true
+	case "RECORDING", "END_HOLD":
+		return LiveRecording, true
+	case "IDLE":
+		return LiveEnded, true
+	}
+	return "", false
+}
+
+// liveDeviceMessage is one JSON message from the device:
+//
+//	{"type":"start","meta":{"scope":"friends","clientSessionId":"..."}}
+//	{"type":"event","event":{"timestamp_ms":1200,"event":"COUNTDOWN_START","state":"COUNTDOWN"}}
+//	{"type":"samples","samples":[{"timestamp_ms":7300,"tof_mm":412.5,...}]}
+//	{"type":"rep","rep":{"tMs":8100,"bottomTofMm":180,"depthMm":230}}   tMs counts from RECORDING_START
+//	{"type":"end","reps":12}
+//
+// Events drive the lifecycle; "end" is for devices that stop without a STOPPED event.
+type liveDeviceMessage struct {
+	Type    string          `json:"type"`
+	Meta    *rawSessionMeta `json:"meta,omitempty"`
+	Event   *rawEvent       `json:"event,omitempty"`
+	Samples []rawSample     `json:"samples,omitempty"`
+	Rep     *repEvent       `json:"rep,omitempty"`
+	Reps    *int            `json:"reps,omitempty"`
+}
+
+// liveUpdate is a message for viewers. Sample frames are droppable: a viewer that falls
+// behind misses some of the trace rather than holding up the device.
+type liveUpdate struct {
+	payload   []byte
+	droppable bool
+}
+
+func newLiveUpdate(v any, droppable bool) liveUpdate {
+	payload, _ := json.Marshal(v)
+	return liveUpdate{payload: payload, droppable: droppable}
+}
+
+// liveSession is what the server knows about a set in progress. While it is registered
+// with the hub it only changes through liveHub.apply, under the hub's lock.
+type liveSession struct {
+	UserID   int64
+	DeviceID int64
+	Meta     rawSessionMeta
+
+	State       liveState
+	ArmedAt     time.Time
+	RecordingAt time.Time
+	EndedAt     time.Time
+
+	Samples    []rawSample
+	Events     []rawEvent
+	Reps       []repEvent
+	DeviceReps *int
+}
+
+func newLiveSession(userID, deviceID int64, now time.Time) *liveSession {
+	return &liveSession{UserID: userID, DeviceID: deviceID, State: LiveArmed, ArmedAt: now}
+}
+
+// apply folds one device message into the session and returns what viewers should see.
+// An error rejects the message but leaves the session usable.
+func (s *liveSession) apply(msg liveDeviceMessage, now time.Time) ([]liveUpdate, error) {
+	if s.State == LiveEnded {
+		return nil, ErrLiveTransition
+	}
+
+	switch msg.Type {
+	case "start":
+		if msg.Meta == nil || s.State != LiveArmed {
+			return nil, ErrLiveMessage
+		}
+		scope, err := normalizeSessionScope(msg.Meta.Scope)
+		if err != nil {
+			return nil, err
+		}
+		key, err := normalizeIdempotencyKey(msg.Meta.ClientSessionID)
+		if err != nil {
+			return nil, err
+		}
+		meta := *msg.Meta
+		meta.Scope = scope
+		meta.ClientSessionID = key
+		meta.sessionAnnotations = normalizeSessionAnnotations(meta.sessionAnnotations)
+		if err := validateSessionAnnotations(meta.sessionAnnotations); err != nil {
+			return nil, err
+		}
+		s.Meta = meta
+		return nil, nil
+
+	case "event":
+		if msg.Event == nil {
+			return nil, ErrLiveMessage
+		}
+		if len(s.Events) >= maxRawEvents {
+			return nil, ErrLiveTooLarge
+		}
+		s.Events = append(s.Events, *msg.Event)
+
+		next, ok := liveStateForEvent(*msg.Event)
+		if !ok || next == s.State {
+			return nil, nil
+		}
+		if err := s.transition(next, now); err != nil {
+			return nil, err
+		}
+		return []liveUpdate{s.stateUpdate()}, nil
+
+	case "samples":
+		if s.State != LiveRecording {
+			return nil, ErrLiveNotLive
+		}
+		if len(msg.Samples) == 0 || len(msg.Samples) > maxLiveSamplesPerMessage {
+			return nil, ErrLiveMessage
+		}
+		if len(s.Samples)+len(msg.Samples) > maxRawSamples {
+			return nil, ErrLiveTooLarge
+		}
+		s.Samples = append(s.Samples, msg.Samples...)
+		return []liveUpdate{newLiveUpdate(map[string]any{
+			"type":    "samples",
+			"samples": msg.Samples,
+		}, true)}, nil
+
+	case "rep":
+		if s.State != LiveRecording {
+			return nil, ErrLiveNotLive
+		}
+		if msg.Rep == nil || msg.Rep.OffsetMS < 0 || msg.Rep.DepthMM < 0 || msg.Rep.BottomTofMM <= 0 {
+			return nil, ErrLiveMessage
+		}
+		if n := len(s.Reps); n > 0 && msg.Rep.OffsetMS < s.Reps[n-1].OffsetMS {
+			return nil, ErrLiveMessage
+		}
+		if len(s.Reps) >= maxLiveRepsPerLive {
+			return nil, ErrLiveTooLarge
+		}
+		// The server scores form when the session is stored.
+		rep := *msg.Rep
+		rep.Index = len(s.Reps)
+		rep.FormScore = nil
+		rep.Quality = nil
+		s.Reps = append(s.Reps, rep)
+		return []liveUpdate{newLiveUpdate(map[string]any{
+			"type": "rep",
+			"rep":  rep,
+			"reps": len(s.Reps),
+		}, false)}, nil
+
+	case "end":
+		if msg.Reps != nil {
+			if *msg.Reps < 0 || *msg.Reps > 1000 {
+				return nil, ErrRawDeviceRepsInvalid
+			}
+			s.DeviceReps = msg.Reps
+		}
+		if err := s.transition(LiveEnded, now); err != nil {
+			return nil, err
+		}
+		return []liveUpdate{s.stateUpdate()}, nil
+	}
+
+	return nil, ErrLiveMessage
+}
+
+// transition moves the session forward, stamping when recording started and ended.
+// Skipping states is fine (a stop during countdown ends the session); going back is not.
+func (s *liveSession) transition(next liveState, now time.Time) error {
+	if liveStateRank[next] <= liveStateRank[s.State] {
+		return ErrLiveTransition
+	}
+
+	s.State = next
+	switch next {
+	case LiveRecording:
+		s.RecordingAt = now
+	case LiveEnded:
+		s.EndedAt = now
+	}
+	return nil
+}
+
+func (s *liveSession) stateUpdate() liveUpdate {
+	return newLiveUpdate(map[string]any{
+		"type":  "state",
+		"state": s.State,
+		"reps":  len(s.Reps),
+	}, false)
+}
+
+// snapshot is what a viewer gets on joining: the state and reps so far, but not the trace.
+func (s *liveSession) snapshot() liveUpdate {
+	if s == nil {
+		return newLiveUpdate(map[string]any{"type": "snapshot", "state": LiveIdle, "reps": 0}, false)
+	}
+
+	var recordingAt *time.Time
+	if !s.RecordingAt.IsZero() {
+		t := s.RecordingAt.UTC()
+		recordingAt = &t
+	}
+	return newLiveUpdate(map[string]any{
+		"type":        "snapshot",
+		"state":       s.State,
+		"reps":        len(s.Reps),
+		"repEvents":   s.Reps,
+		"recordingAt": recordingAt,
+	}, false)
+}
+
+// liveViewer is one subscribed websocket. The hub closes send when it drops the viewer.
+type liveViewer struct {
+	isOwner bool
+	send    chan []byte
+	dropped int
+}
+
+type liveChannel struct {
+	session *liveSession
+	viewers map[*liveViewer]struct{}
+}
+
+// liveHub fans a device's live session out to its viewers. It is in-process:
+// a device and its viewers must be connected to the same server.
+type liveHub struct {
+	mu       sync.Mutex
+	channels map[int64]*liveChannel
+}
+
+var liveSessions = newLiveHub()
+
+func newLiveHub() *liveHub {
+	return &liveHub{channels: map[int64]*liveChannel{}}
+}
+
+// channel returns the user's channel, creating it. The caller holds h.mu.
+func (h *liveHub) channel(userID int64) *liveChannel {
+	ch := h.channels[userID]
+	if ch == nil {
+		ch = &liveChannel{viewers: map[*liveViewer]struct{}{}}
+		h.channels[userID] = ch
+	}
+	return ch
+}
+
+// release forgets an unused channel. The caller holds h.mu.
+func (h *liveHub) release(userID int64, ch *liveChannel) {
+	if ch.session == nil && len(ch.viewers) == 0 {
+		delete(h.channels, userID)
+	}
+}
+
+// start registers a new live session for the user. Only one device may stream at a time.
+func (h *liveHub) start(s *liveSession) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channel(s.UserID)
+	if ch.session != nil {
+		return ErrLiveBusy
+	}
+	ch.session = s
+	h.broadcast(ch, s.stateUpdate())
+	return nil
+}
+
+// apply folds a device message into its session and sends the result to viewers.
+// Holding the hub lock keeps snapshots consistent with the session; sending never
+// blocks on a viewer, so a slow viewer can't hold up the device.
+func (h *liveHub) apply(s *liveSession, msg liveDeviceMessage, now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	updates, err := s.apply(msg, now)
+	if err != nil {
+		return err
+	}
+
+	ch := h.channels[s.UserID]
+	if ch == nil || ch.session != s {
+		return nil
+	}
+	for _, u := range updates {
+		h.broadcast(ch, u)
+	}
+	return nil
+}
+
+// finish detaches the session and tells viewers how it ended.
+func (h *liveHub) finish(s *liveSession, summary liveUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channels[s.UserID]
+	if ch == nil || ch.session != s {
+		return
+	}
+	h.broadcast(ch, summary)
+	ch.session = nil
+	h.release(s.UserID, ch)
+}
+
+// broadcast delivers one update. A viewer whose buffer is full misses sample frames;
+// if it can't even take a state change or rep, it is dropped so it can reconnect
+// and start again from a snapshot. Private sessions only go to the owner.
+// The caller holds h.mu.
+func (h *liveHub) broadcast(ch *liveChannel, u liveUpdate) {
+	private := ch.session != nil && ch.session.Meta.Scope == ScopePrivate
+	for v := range ch.viewers {
+		if private && !v.isOwner {
+			continue
+		}
+		select {
+		case v.send <- u.payload:
+		default:
+			if u.droppable {
+				v.dropped++
+				continue
+			}
+			delete(ch.viewers, v)
+			close(v.send)
+		}
+	}
+}
+
+// subscribe adds a viewer to the user's channel and queues the current snapshot for it.
+func (h *liveHub) subscribe(userID int64, isOwner bool) (*liveViewer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channel(userID)
+	if len(ch.viewers) >= maxLiveViewers {
+		h.release(userID, ch)
+		return nil, ErrLiveBusy
+	}
+
+	v := &liveViewer{isOwner: isOwner, send: make(chan []byte, liveViewerBuffer)}
+	ch.viewers[v] = struct{}{}
+
+	snapshot := ch.session
+	if snapshot != nil && snapshot.Meta.Scope == ScopePrivate && !isOwner {
+		snapshot = nil
+	}
+	v.send <- snapshot.snapshot().payload
+	return v, nil
+}
+
+// unsubscribe removes a viewer that disconnected. It is a no-op if the hub already dropped it.
+func (h *liveHub) unsubscribe(userID int64, v *liveViewer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channels[userID]
+	if ch == nil {
+		return
+	}
+	if _, ok := ch.viewers[v]; ok {
+		delete(ch.viewers, v)
+		close(v.send)
+	}
+	h.release(userID, ch)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func liveEvent(name, state string) liveDeviceMessage {
+	return liveDeviceMessage{Type: "event", Event: &rawEvent{Name: name, State: state}}
+}
+
+func TestLiveSessionLifecycle(t *testing.T) {
+	now := time.Date(2026, 3, 14, 7, 0, 0, 0, time.UTC)
+	s := newLiveSession(1, 2, now)
+
+	steps := []struct {
+		msg  liveDeviceMessage
+		want liveState
+		err  error
+	}{
+		{liveEvent("ARMING_START", "ARMING"), LiveArmed, nil},
+		{liveDeviceMessage{Type: "samples", Samples: []rawSample{{DeviceMS: 1}}}, LiveArmed, ErrLiveNotLive},
+		{liveEvent("COUNTDOWN_START", "COUNTDOWN"), LiveCountdown, nil},
+		{liveEvent("RECORDING_START", "RECORDING"), LiveRecording, nil},
+		{liveDeviceMessage{Type: "samples", Samples: []rawSample{{DeviceMS: 100, TofMM: 400}}}, LiveRecording, nil},
+		{liveDeviceMessage{Type: "rep", Rep: &repEvent{OffsetMS: 900, BottomTofMM: 180, DepthMM: 220}}, LiveRecording, nil},
+		{liveDeviceMessage{Type: "rep", Rep: &repEvent{OffsetMS: 800, BottomTofMM: 180, DepthMM: 220}}, LiveRecording, ErrLiveMessage},
+		{liveEvent("ARMING_START", "ARMING"), LiveRecording, ErrLiveTransition},
+		{liveEvent("END_HOLD_START", "END_HOLD"), LiveRecording, nil},
+		{liveEvent("SESSION_STOPPED_CLEAN_SPAN_MM", "END_HOLD"), LiveEnded, nil},
+		{liveDeviceMessage{Type: "end"}, LiveEnded, ErrLiveTransition},
+	}
+
+	for i, step := range steps {
+		now = now.Add(time.Second)
+		if _, err := s.apply(step.msg, now); err != step.err {
+			t.Fatalf("step %d: err = %v; want %v", i, err, step.err)
+		}
+		if s.State != step.want {
+			t.Fatalf("step %d: state = %s; want %s", i, s.State, step.want)
+		}
+	}
+
+	if len(s.Samples) != 1 || len(s.Reps) != 1 {
+		t.Fatalf("kept %d samples and %d reps; want 1 and 1", len(s.Samples), len(s.Reps))
+	}
+	if s.RecordingAt.IsZero() || !s.EndedAt.After(s.RecordingAt) {
+		t.Fatalf("recording %v, ended %v", s.RecordingAt, s.EndedAt)
+	}
+}
+
+func TestLiveSessionStopDuringCountdown(t *testing.T) {
+	now := time.Now().UTC()
+	s := newLiveSession(1, 2, now)
+
+	if _, err := s.apply(liveEvent("COUNTDOWN_START", "COUNTDOWN"), now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.apply(liveEvent("STOP_CMD_IDLE", "IDLE"), now); err != nil {
+		t.Fatal(err)
+	}
+	if s.State != LiveEnded || !s.RecordingAt.IsZero() {
+		t.Fatalf("state %s, recordingAt %v", s.State, s.RecordingAt)
+	}
+}
+
+func TestLiveHubBackPressure(t *testing.T) {
+	hub := newLiveHub()
+	now := time.Now().UTC()
+
+	s := newLiveSession(7, 1, now)
+	if err := hub.start(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.start(newLiveSession(7, 2, now)); err != ErrLiveBusy {
+		t.Fatalf("second device: %v; want ErrLiveBusy", err)
+	}
+
+	slow, err := hub.subscribe(7, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap map[string]any
+	if err := json.Unmarshal(<-slow.send, &snap); err != nil || snap["type"] != "snapshot" || snap["state"] != string(LiveArmed) {
+		t.Fatalf("snapshot = %v, %v", snap, err)
+	}
+
+	if err := hub.apply(s, liveEvent("RECORDING_START", "RECORDING"), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the slow viewer's buffer with sample frames; the rest are dropped, not queued.
+	frame := liveDeviceMessage{Type: "samples", Samples: []rawSample{{DeviceMS: 1, TofMM: 400}}}
+	for i := 0; i < liveViewerBuffer+10; i++ {
+		if err := hub.apply(s, frame, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if slow.dropped == 0 {
+		t.Fatal("expected dropped sample frames for a full viewer")
+	}
+
+	// A rep can't be dropped, so the viewer is disconnected instead.
+	rep := liveDeviceMessage{Type: "rep", Rep: &repEvent{OffsetMS: 10, BottomTofMM: 180, DepthMM: 220}}
+	if err := hub.apply(s, rep, now); err != nil {
+		t.Fatal(err)
+	}
+	for range slow.send {
+	}
+
+	// A fresh viewer catches up from the snapshot.
+	fresh, err := hub.subscribe(7, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(<-fresh.send, &snap); err != nil || snap["reps"] != float64(1) {
+		t.Fatalf("snapshot = %v, %v", snap, err)
+	}
+
+	hub.finish(s, newLiveUpdate(map[string]any{"type": "summary"}, false))
+	if err := json.Unmarshal(<-fresh.send, &snap); err != nil || snap["type"] != "summary" {
+		t.Fatalf("summary = %v, %v", snap, err)
+	}
+	hub.unsubscribe(7, fresh)
+	if len(hub.channels) != 0 {
+		t.Fatalf("channels left behind: %d", len(hub.channels))
+	}
+}
+
+func TestLiveHubPrivateSession(t *testing.T) {
+	hub := newLiveHub()
+	now := time.Now().UTC()
+
+	s := newLiveSession(3, 1, now)
+	s.Meta.Scope = ScopePrivate
+	if err := hub.start(s); err != nil {
+		t.Fatal(err)
+	}
+
+	owner, _ := hub.subscribe(3, true)
+	friend, _ := hub.subscribe(3, false)
+
+	var owned, seen map[string]any
+	_ = json.Unmarshal(<-owner.send, &owned)
+	_ = json.Unmarshal(<-friend.send, &seen)
+	if owned["state"] != string(LiveArmed) || seen["state"] != string(LiveIdle) {
+		t.Fatalf("owner saw %v, friend saw %v", owned["state"], seen["state"])
+	}
+
+	if err := hub.apply(s, liveEvent("COUNTDOWN_START", "COUNTDOWN"), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(owner.send) != 1 || len(friend.send) != 0 {
+		t.Fatalf("owner queued %d, friend queued %d", len(owner.send), len(friend.send))
+	}
+}
+
+func TestLiveBaseline(t *testing.T) {
+	v := 412.5
+	events := []rawEvent{{Name: "START_CMD"}, {Name: "BASELINE_LOCKED_MM", Value: &v}}
+	if got := liveBaseline(events); got == nil || *got != v {
+		t.Fatalf("baseline = %v", got)
+	}
+	if got := liveBaseline(events[:1]); got != nil {
+		t.Fatalf("baseline without lock = %v", *got)
+	}
+}
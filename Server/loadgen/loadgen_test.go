@@ -0,0 +1,213 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"PUSH-UP-ANALYZER/firmware"
+	"PUSH-UP-ANALYZER/processing/classifier"
+)
+
+func loadTestRecordings(t *testing.T) []Recording {
+	t.Helper()
+	// The exported model is optional; without it reps are counted ungated.
+	model, _ := classifier.LoadFile("../../data/data_processing/processed/model.json")
+	recs, err := LoadRecordings("../../data", model)
+	if err != nil {
+		t.Skipf("no recordings: %v", err)
+	}
+	return recs
+}
+
+func TestLoadRecordings(t *testing.T) {
+	for _, rec := range loadTestRecordings(t) {
+		if len(rec.Samples) < 100 || rec.Duration() < 10*time.Second {
+			t.Errorf("%s: %d samples over %v", rec.Name, len(rec.Samples), rec.Duration())
+		}
+		if rec.Events[0].Name != firmware.EventStartCmd {
+			t.Errorf("%s: first event %s", rec.Name, rec.Events[0].Name)
+		}
+		t.Logf("%s: %d samples, %v, %d reps", rec.Name, len(rec.Samples), rec.Duration(), rec.Reps)
+		if rec.Reps == 0 {
+			t.Errorf("%s: no reps counted", rec.Name)
+		}
+	}
+}
+
+func TestRecordingSession(t *testing.T) {
+	rec := loadTestRecordings(t)[0]
+	end := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	s := rec.Session("id-1", end)
+	if s.ID != "id-1" || !s.Samples[len(s.Samples)-1].HostTime.Equal(end) {
+		t.Fatalf("last sample at %v; want %v", s.Samples[len(s.Samples)-1].HostTime, end)
+	}
+	if got := end.Sub(s.Samples[0].HostTime); got != rec.Duration() {
+		t.Fatalf("session spans %v; want %v", got, rec.Duration())
+	}
+	// The recording itself is untouched.
+	if rec.Samples[0].HostTime.Equal(s.Samples[0].HostTime) {
+		t.Fatal("Session modified the recording")
+	}
+}
+
+func TestStatsSummary(t *testing.T) {
+	s := NewStats()
+	for i := 1; i <= 100; i++ {
+		status := http.StatusCreated
+		if i%10 == 0 {
+			status = http.StatusInternalServerError
+		}
+		s.Record(OpReps, time.Duration(i)*time.Millisecond, status, nil)
+	}
+	s.Record(OpLeaderboard, time.Second, 0, context.DeadlineExceeded)
+
+	sums := s.Summary(10 * time.Second)
+	if len(sums) != 2 || sums[0].Op != OpLeaderboard || sums[1].Op != OpReps {
+		t.Fatalf("summaries = %+v", sums)
+	}
+
+	reps := sums[1]
+	if reps.Count != 100 || reps.Errors != 10 || reps.ErrorRate != 0.1 || reps.PerSecond != 10 {
+		t.Fatalf("reps = %+v", reps)
+	}
+	if reps.P50 != 50*time.Millisecond || reps.P90 != 90*time.Millisecond || reps.P99 != 99*time.Millisecond || reps.Max != 100*time.Millisecond {
+		t.Fatalf("percentiles = %v %v %v %v", reps.P50, reps.P90, reps.P99, reps.Max)
+	}
+	if reps.Statuses[http.StatusCreated] != 90 || reps.Statuses[http.StatusInternalServerError] != 10 {
+		t.Fatalf("statuses = %v", reps.Statuses)
+	}
+	if sums[0].Errors != 1 || sums[0].Statuses[0] != 1 {
+		t.Fatalf("leaderboard = %+v", sums[0])
+	}
+
+	var report strings.Builder
+	if err := WriteReport(&report, sums); err != nil || !strings.Contains(report.String(), "201:90 500:10") {
+		t.Fatalf("report:\n%s", report.String())
+	}
+}
+
+func TestRunUploads(t *testing.T) {
+	recs := loadTestRecordings(t)
+
+	var (
+		mu  sync.Mutex
+		ids = map[string]bool{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Device-Token") == "bad" {
+			http.Error(w, "invalid device token", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			ClientSessionID string `json:"clientSessionId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		ids[r.URL.Path+" "+body.ClientSessionID] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"ok":true,"sessionId":1}`))
+	}))
+	defer srv.Close()
+
+	for _, mode := range []Mode{ModeReps, ModeRaw} {
+		stats := NewStats()
+		cfg := Config{ServerURL: srv.URL, Tokens: []string{"a", "b", "bad"}, Mode: mode, Sessions: 3, RunID: "t"}
+		if err := Run(context.Background(), cfg, recs, stats); err != nil {
+			t.Fatal(err)
+		}
+
+		sums := stats.Summary(time.Second)
+		if len(sums) != 1 || sums[0].Count != 9 || sums[0].Errors != 3 || sums[0].Statuses[http.StatusUnauthorized] != 3 {
+			t.Fatalf("%s: summaries = %+v", mode, sums)
+		}
+	}
+
+	// Two good devices, three sets each, in two modes: every set has its own ID.
+	if len(ids) != 12 {
+		t.Fatalf("server saw %d distinct sets; want 12", len(ids))
+	}
+}
+
+func TestRunLive(t *testing.T) {
+	recs := loadTestRecordings(t)
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		samples := 0
+		for {
+			var msg struct {
+				Type    string            `json:"type"`
+				Samples []json.RawMessage `json:"samples"`
+				Event   *struct {
+					Name string `json:"event"`
+				} `json:"event"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			samples += len(msg.Samples)
+			if msg.Type == "end" || (msg.Event != nil && stopsSet(firmware.EventName(msg.Event.Name))) {
+				id := int64(7)
+				_ = conn.WriteJSON(map[string]any{"type": "summary", "sessionId": id, "samples": samples})
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	stats := NewStats()
+	cfg := Config{ServerURL: srv.URL, Tokens: []string{"a", "b"}, Mode: ModeLive, Sessions: 2, RunID: "t"}
+	if err := Run(context.Background(), cfg, recs, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sum := range stats.Summary(time.Second) {
+		if sum.Count != 4 || sum.Errors != 0 {
+			t.Fatalf("%s: %+v", sum.Op, sum)
+		}
+	}
+}
+
+func TestLiveTimeline(t *testing.T) {
+	rec := loadTestRecordings(t)[0]
+
+	frames := liveTimeline(rec, "id", "friends", true)
+	if frames[0].msg["type"] != "start" {
+		t.Fatalf("first frame %v", frames[0].msg)
+	}
+
+	samples := 0
+	recording := false
+	for _, f := range frames {
+		switch f.msg["type"] {
+		case "event":
+			if f.msg["event"].(liveEvent).Name == string(firmware.EventRecordingStart) {
+				recording = true
+			}
+		case "samples":
+			if !recording {
+				t.Fatal("samples before RECORDING_START")
+			}
+			samples += len(f.msg["samples"].([]liveSample))
+		}
+	}
+	if samples != len(rec.Samples) {
+		t.Fatalf("sent %d samples; want %d", samples, len(rec.Samples))
+	}
+}
@@ -0,0 +1,206 @@
+// Package loadgen replays recorded sessions against a running server as many simulated
+// devices and measures how it holds up. cmd/pressle-load is its command line.
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"PUSH-UP-ANALYZER/bridge"
+	"PUSH-UP-ANALYZER/firmware"
+	"PUSH-UP-ANALYZER/processing/classifier"
+	"PUSH-UP-ANALYZER/processing/prepare"
+	"PUSH-UP-ANALYZER/processing/repdetect"
+	"PUSH-UP-ANALYZER/processing/windows"
+)
+
+// Recording is one data/sessionN.csv with its events.
+type Recording struct {
+	Name    string
+	Samples []firmware.Sample
+	Events  []firmware.Event
+	// Reps is what the server's pipeline counts, which stands in for what a device
+	// would report to /api/reps.
+	Reps int
+}
+
+// LoadRecordings loads every sessionN.csv in dir. model gates rep counting like the
+// server's; without one, peak detection alone overcounts noisy recordings.
+func LoadRecordings(dir string, model *classifier.Model) ([]Recording, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "session*.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []Recording
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".events.csv") {
+			continue
+		}
+		rec, err := LoadRecording(p, model)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("no session*.csv files in %s", dir)
+	}
+	return recs, nil
+}
+
+// LoadRecording loads a sessionN.csv and the sessionN.events.csv beside it. Early
+// recordings have no events file; they get the events the firmware would have sent.
+func LoadRecording(path string, model *classifier.Model) (Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Recording{}, err
+	}
+	raw, err := prepare.ReadSessionCSV(f)
+	f.Close()
+	if err != nil {
+		return Recording{}, err
+	}
+
+	rec := Recording{Name: strings.TrimSuffix(filepath.Base(path), ".csv")}
+	for _, r := range raw {
+		if math.IsNaN(r.DeviceS) || math.IsNaN(r.TofMM) {
+			continue
+		}
+		rec.Samples = append(rec.Samples, firmware.Sample{
+			HostTime: r.HostTime,
+			DeviceMS: int64(math.Round(r.DeviceS * 1000)),
+			TofMM:    r.TofMM,
+			AX:       r.AX, AY: r.AY, AZ: r.AZ,
+			GX: r.GX, GY: r.GY, GZ: r.GZ,
+		})
+	}
+	if len(rec.Samples) == 0 {
+		return Recording{}, errors.New("no samples")
+	}
+	sort.SliceStable(rec.Samples, func(i, j int) bool { return rec.Samples[i].DeviceMS < rec.Samples[j].DeviceMS })
+
+	ef, err := os.Open(strings.TrimSuffix(path, ".csv") + ".events.csv")
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		rec.Events = syntheticEvents(rec.Samples)
+	case err != nil:
+		return Recording{}, err
+	default:
+		rec.Events, err = firmware.ReadEventsCSV(ef)
+		ef.Close()
+		if err != nil {
+			return Recording{}, err
+		}
+	}
+
+	rec.Reps, err = countReps(rec.Samples, rec.Events, model)
+	if err != nil {
+		return Recording{}, err
+	}
+	return rec, nil
+}
+
+// Duration is how long the recording's samples span on the device clock.
+func (r Recording) Duration() time.Duration {
+	first, last := r.Samples[0].DeviceMS, r.Samples[len(r.Samples)-1].DeviceMS
+	return time.Duration(last-first) * time.Millisecond
+}
+
+// Session returns the recording as a bridge session that ended at end, with host times
+// shifted to match, so the server sees a set that just finished.
+func (r Recording) Session(id string, end time.Time) bridge.Session {
+	lastMS := r.Samples[len(r.Samples)-1].DeviceMS
+	at := func(ms int64) time.Time { return end.Add(time.Duration(ms-lastMS) * time.Millisecond) }
+
+	s := bridge.Session{
+		ID:      id,
+		Samples: make([]firmware.Sample, len(r.Samples)),
+		Events:  make([]firmware.Event, len(r.Events)),
+	}
+	for i, smp := range r.Samples {
+		smp.HostTime = at(smp.DeviceMS)
+		s.Samples[i] = smp
+	}
+	for i, ev := range r.Events {
+		ev.HostTime = at(ev.DeviceMS)
+		s.Events[i] = ev
+	}
+	return s
+}
+
+// syntheticEvents is the event sequence of a clean set around the given samples,
+// with the baseline locked at the first sample's distance.
+func syntheticEvents(samples []firmware.Sample) []firmware.Event {
+	first, last := samples[0], samples[len(samples)-1]
+	recStart := first.DeviceMS - firmware.SampleInterval.Milliseconds()
+	countdown := recStart - firmware.CountdownLength.Milliseconds()
+	arming := countdown - firmware.ArmingDuration.Milliseconds()
+	endHold := last.DeviceMS
+
+	ev := func(ms int64, name firmware.EventName, value float64, state firmware.State) firmware.Event {
+		return firmware.Event{DeviceMS: ms, Name: name, Value: value, State: state}
+	}
+	none := math.NaN()
+	return []firmware.Event{
+		ev(arming, firmware.EventStartCmd, none, firmware.StateArming),
+		ev(arming, firmware.EventArmingStart, none, firmware.StateArming),
+		ev(countdown, firmware.EventBaselineLocked, first.TofMM, firmware.StateArming),
+		ev(countdown, firmware.EventCountdownStart, none, firmware.StateCountdown),
+		ev(recStart, firmware.EventRecordingStart, none, firmware.StateRecording),
+		ev(endHold, firmware.EventEndHoldStart, none, firmware.StateEndHold),
+		ev(endHold+firmware.EndHoldDuration.Milliseconds(), firmware.EventSessionStoppedClean, 0, firmware.StateEndHold),
+	}
+}
+
+// countReps runs the rep pipeline the way the server does for raw uploads.
+func countReps(samples []firmware.Sample, events []firmware.Event, model *classifier.Model) (int, error) {
+	raw := make([]prepare.RawSample, len(samples))
+	for i, s := range samples {
+		raw[i] = prepare.RawSample{
+			DeviceS: float64(s.DeviceMS) / 1000,
+			TofMM:   s.TofMM,
+			AX:      s.AX, AY: s.AY, AZ: s.AZ,
+			GX: s.GX, GY: s.GY, GZ: s.GZ,
+		}
+	}
+	evs := make([]prepare.Event, len(events))
+	for i, ev := range events {
+		evs[i] = prepare.Event{DeviceMS: ev.DeviceMS, Name: string(ev.Name), Value: ev.Value, State: string(ev.State)}
+	}
+
+	segments := prepare.Prepare(raw, evs, prepare.DefaultOptions())
+
+	var gates map[int][]repdetect.Window
+	if model != nil {
+		ws := windows.Build(segments, windows.DefaultOptions())
+		probs, err := model.PredictWindows(ws)
+		if err != nil {
+			return 0, err
+		}
+		gates = make(map[int][]repdetect.Window, len(segments))
+		for i, w := range ws {
+			gates[w.SegmentID] = append(gates[w.SegmentID], repdetect.Window{StartS: w.StartS, EndS: w.EndS, Prob: probs[i]})
+		}
+	}
+
+	reps := 0
+	for _, seg := range segments {
+		points := make([]repdetect.Sample, len(seg.Samples))
+		for i, s := range seg.Samples {
+			points[i] = repdetect.Sample{TimeS: s.TimeS, TofMM: s.TofMM}
+		}
+		var segGates []repdetect.Window
+		if gates != nil {
+			segGates = append([]repdetect.Window{}, gates[seg.ID]...)
+		}
+		reps += len(repdetect.Detect(points, segGates, seg.BaselineMM, repdetect.DefaultParams()))
+	}
+	return reps, nil
+}
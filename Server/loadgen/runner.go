@@ -0,0 +1,401 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"PUSH-UP-ANALYZER/bridge"
+	"PUSH-UP-ANALYZER/firmware"
+)
+
+// Mode is how simulated devices send their sets.
+type Mode string
+
+const (
+	// ModeReps posts a finished set's rep count to /api/reps.
+	ModeReps Mode = "reps"
+	// ModeRaw uploads a finished set's samples and events to /api/sessions/raw.
+	ModeRaw Mode = "raw"
+	// ModeLive streams the set over /api/live/device as it happens.
+	ModeLive Mode = "live"
+)
+
+// Operation names in Stats.
+const (
+	OpReps        = "reps"
+	OpRaw         = "raw"
+	OpLiveConnect = "live_connect"
+	OpLiveSet     = "live_set"
+	OpLeaderboard = "leaderboard"
+)
+
+// Config describes a load run.
+type Config struct {
+	// ServerURL is the server's base URL, e.g. http://localhost:8080.
+	ServerURL string
+	// Tokens has one device token per simulated device.
+	Tokens []string
+	Mode   Mode
+	// Speed scales replay time: 1 is real time, 10 is ten times faster and 0 sends
+	// every set as fast as the server answers.
+	Speed float64
+	// Sessions is how many sets each device sends; 0 means until the context is done.
+	Sessions int
+	// Scope is the visibility of stored sessions; empty leaves it to the server.
+	Scope string
+	// RunID keeps clientSessionIds unique across runs, so the server stores every set
+	// instead of replaying an earlier run's response.
+	RunID string
+
+	// Leaderboard, when set, is a logged-in client that polls GET /api/leaderboard
+	// every LeaderboardEvery while the devices run.
+	Leaderboard      *http.Client
+	LeaderboardEvery time.Duration
+	LeaderboardQuery string
+
+	Client *http.Client
+}
+
+// Run replays recs from every device in cfg until each has sent cfg.Sessions sets or
+// ctx is done, recording every request in stats. Device i starts at recording i, so
+// devices don't all send the same set at once.
+func Run(ctx context.Context, cfg Config, recs []Recording, stats *Stats) error {
+	if len(cfg.Tokens) == 0 {
+		return errors.New("no device tokens")
+	}
+	if len(recs) == 0 {
+		return errors.New("no recordings")
+	}
+	switch cfg.Mode {
+	case ModeReps, ModeRaw, ModeLive:
+	default:
+		return fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	defer stopPolling()
+	var polling sync.WaitGroup
+	if cfg.Leaderboard != nil && cfg.LeaderboardEvery > 0 {
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			pollLeaderboard(pollCtx, cfg, stats)
+		}()
+	}
+
+	var devices sync.WaitGroup
+	for i, token := range cfg.Tokens {
+		devices.Add(1)
+		go func() {
+			defer devices.Done()
+			d := device{index: i, token: token, cfg: cfg, stats: stats}
+			for n := 0; cfg.Sessions == 0 || n < cfg.Sessions; n++ {
+				if ctx.Err() != nil {
+					return
+				}
+				d.send(ctx, recs[(i+n)%len(recs)], n)
+			}
+		}()
+	}
+	devices.Wait()
+
+	stopPolling()
+	polling.Wait()
+	return nil
+}
+
+type device struct {
+	index int
+	token string
+	cfg   Config
+	stats *Stats
+}
+
+func (d device) sessionID(n int) string {
+	return fmt.Sprintf("load-%s-%d-%d", d.cfg.RunID, d.index, n)
+}
+
+// send plays one set. Failures are recorded in stats, not returned: a load test keeps going.
+func (d device) send(ctx context.Context, rec Recording, n int) {
+	if d.cfg.Mode == ModeLive {
+		d.sendLive(ctx, rec, n)
+		return
+	}
+
+	// A device uploads once the set is over, so wait out the set first.
+	if err := replayWait(ctx, rec.Duration(), d.cfg.Speed); err != nil {
+		return
+	}
+
+	end := time.Now()
+	switch d.cfg.Mode {
+	case ModeReps:
+		body := map[string]any{
+			"reps":            rec.Reps,
+			"source":          "device",
+			"clientSessionId": d.sessionID(n),
+			"startedAt":       end.Add(-rec.Duration()).UTC(),
+			"endedAt":         end.UTC(),
+		}
+		if d.cfg.Scope != "" {
+			body["scope"] = d.cfg.Scope
+		}
+		start := time.Now()
+		status, err := d.postJSON(ctx, "/api/reps", body)
+		d.stats.Record(OpReps, time.Since(start), status, err)
+
+	case ModeRaw:
+		up := bridge.Uploader{ServerURL: d.cfg.ServerURL, Token: d.token, Scope: d.cfg.Scope, Client: d.cfg.Client}
+		start := time.Now()
+		res, err := up.Upload(ctx, rec.Session(d.sessionID(n), end))
+		status := http.StatusCreated
+		var ue *bridge.UploadError
+		switch {
+		case errors.As(err, &ue):
+			status = ue.StatusCode
+		case err != nil:
+			status = 0
+		case res.Replayed:
+			status = http.StatusOK
+		}
+		d.stats.Record(OpRaw, time.Since(start), status, err)
+	}
+}
+
+func (d device) postJSON(ctx context.Context, path string, body any) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(d.cfg.ServerURL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Token", d.token)
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// liveSample and liveEvent are the JSON shapes of samples and events in live frames.
+type liveSample struct {
+	DeviceMS int64   `json:"timestamp_ms"`
+	TofMM    float64 `json:"tof_mm"`
+	AX       float64 `json:"ax"`
+	AY       float64 `json:"ay"`
+	AZ       float64 `json:"az"`
+	GX       float64 `json:"gx"`
+	GY       float64 `json:"gy"`
+	GZ       float64 `json:"gz"`
+}
+
+type liveEvent struct {
+	DeviceMS int64    `json:"timestamp_ms"`
+	Name     string   `json:"event"`
+	Value    *float64 `json:"value"`
+	State    string   `json:"state"`
+}
+
+// liveFrame is one message in a set's timeline, sent at its device time.
+type liveFrame struct {
+	deviceMS int64
+	msg      map[string]any
+}
+
+// liveTimeline interleaves a recording's events and samples by device time. Without
+// pacing, consecutive samples are batched into one frame as a buffering device would.
+func liveTimeline(rec Recording, id, scope string, batch bool) []liveFrame {
+	type item struct {
+		ms     int64
+		event  *firmware.Event
+		sample *firmware.Sample
+	}
+	items := make([]item, 0, len(rec.Events)+len(rec.Samples))
+	for i := range rec.Events {
+		items = append(items, item{ms: rec.Events[i].DeviceMS, event: &rec.Events[i]})
+	}
+	for i := range rec.Samples {
+		items = append(items, item{ms: rec.Samples[i].DeviceMS, sample: &rec.Samples[i]})
+	}
+	// Stable, with events first, so an event and a sample at the same millisecond keep
+	// the firmware's order: RECORDING_START comes before the first sample.
+	sort.SliceStable(items, func(i, j int) bool { return items[i].ms < items[j].ms })
+
+	meta := map[string]any{"clientSessionId": id}
+	if scope != "" {
+		meta["scope"] = scope
+	}
+	frames := []liveFrame{{deviceMS: items[0].ms, msg: map[string]any{"type": "start", "meta": meta}}}
+
+	var pending []liveSample
+	flush := func(ms int64) {
+		if len(pending) > 0 {
+			frames = append(frames, liveFrame{deviceMS: ms, msg: map[string]any{"type": "samples", "samples": pending}})
+			pending = nil
+		}
+	}
+	for _, it := range items {
+		if it.sample != nil {
+			s := it.sample
+			pending = append(pending, liveSample{s.DeviceMS, s.TofMM, s.AX, s.AY, s.AZ, s.GX, s.GY, s.GZ})
+			if !batch {
+				flush(it.ms)
+			}
+			continue
+		}
+		flush(it.ms)
+		ev := liveEvent{DeviceMS: it.event.DeviceMS, Name: string(it.event.Name), State: string(it.event.State)}
+		if it.event.HasValue() {
+			v := it.event.Value
+			ev.Value = &v
+		}
+		frames = append(frames, liveFrame{deviceMS: it.ms, msg: map[string]any{"type": "event", "event": ev}})
+	}
+	if len(pending) > 0 {
+		flush(pending[len(pending)-1].DeviceMS)
+	}
+	// Recordings cut off before the firmware stopped still need to end.
+	if last := rec.Events[len(rec.Events)-1].Name; !stopsSet(last) {
+		frames = append(frames, liveFrame{deviceMS: frames[len(frames)-1].deviceMS, msg: map[string]any{"type": "end", "reps": rec.Reps}})
+	}
+	return frames
+}
+
+func stopsSet(name firmware.EventName) bool {
+	switch name {
+	case firmware.EventSessionStoppedClean, firmware.EventSessionStoppedTimeout, firmware.EventStopCmdIdle:
+		return true
+	}
+	return false
+}
+
+// liveSetTimeout bounds the wait for the server's summary after the last frame.
+const liveSetTimeout = 30 * time.Second
+
+// sendLive streams one set and waits for its summary. live_set measures from the
+// last frame to the summary, which is how long the server takes to store the set.
+func (d device) sendLive(ctx context.Context, rec Recording, n int) {
+	url := "ws" + strings.TrimPrefix(strings.TrimRight(d.cfg.ServerURL, "/"), "http") + "/api/live/device"
+	header := http.Header{"X-Device-Token": []string{d.token}}
+
+	start := time.Now()
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	d.stats.Record(OpLiveConnect, time.Since(start), status, err)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	frames := liveTimeline(rec, d.sessionID(n), d.cfg.Scope, d.cfg.Speed <= 0)
+	prev := frames[0].deviceMS
+	for _, f := range frames {
+		if err := replayWait(ctx, time.Duration(f.deviceMS-prev)*time.Millisecond, d.cfg.Speed); err != nil {
+			return
+		}
+		prev = f.deviceMS
+		if err := conn.WriteJSON(f.msg); err != nil {
+			d.stats.Record(OpLiveSet, 0, 0, err)
+			return
+		}
+	}
+
+	sent := time.Now()
+	_ = conn.SetReadDeadline(sent.Add(liveSetTimeout))
+	var serverErr error
+	for {
+		var reply struct {
+			Type      string `json:"type"`
+			Error     string `json:"error"`
+			SessionID *int64 `json:"sessionId"`
+		}
+		if err := conn.ReadJSON(&reply); err != nil {
+			d.stats.Record(OpLiveSet, time.Since(sent), 0, err)
+			return
+		}
+		switch reply.Type {
+		case "error":
+			// The server reports bad frames but keeps the set going; count the set as failed.
+			serverErr = errors.New(reply.Error)
+		case "summary":
+			if serverErr == nil && reply.SessionID == nil {
+				serverErr = fmt.Errorf("set not stored: %s", reply.Error)
+			}
+			d.stats.Record(OpLiveSet, time.Since(sent), http.StatusOK, serverErr)
+			return
+		}
+	}
+}
+
+func pollLeaderboard(ctx context.Context, cfg Config, stats *Stats) {
+	url := strings.TrimRight(cfg.ServerURL, "/") + "/api/leaderboard"
+	if cfg.LeaderboardQuery != "" {
+		url += "?" + cfg.LeaderboardQuery
+	}
+
+	tick := time.NewTicker(cfg.LeaderboardEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return
+		}
+		start := time.Now()
+		resp, err := cfg.Leaderboard.Do(req)
+		if ctx.Err() != nil {
+			return
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		stats.Record(OpLeaderboard, time.Since(start), status, err)
+	}
+}
+
+// replayWait sleeps for d of device time at the given speed.
+func replayWait(ctx context.Context, d time.Duration, speed float64) error {
+	if speed <= 0 || d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(time.Duration(math.Round(float64(d) / speed)))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats collects the latency and outcome of every request, by operation.
+// It is safe for concurrent use.
+type Stats struct {
+	mu  sync.Mutex
+	ops map[string]*opStats
+}
+
+type opStats struct {
+	latencies []time.Duration
+	errors    int
+	statuses  map[int]int
+}
+
+func NewStats() *Stats {
+	return &Stats{ops: map[string]*opStats{}}
+}
+
+// Record adds one request. status is the HTTP status, or 0 when there was no response.
+// A request failed if err is set or the status is 0 or 4xx/5xx.
+func (s *Stats) Record(op string, d time.Duration, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.ops[op]
+	if o == nil {
+		o = &opStats{statuses: map[int]int{}}
+		s.ops[op] = o
+	}
+	o.latencies = append(o.latencies, d)
+	o.statuses[status]++
+	if err != nil || status == 0 || status >= 400 {
+		o.errors++
+	}
+}
+
+// OpSummary is the result for one operation.
+type OpSummary struct {
+	Op        string
+	Count     int
+	Errors    int
+	ErrorRate float64
+	// PerSecond is the request rate over the whole run.
+	PerSecond float64
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration
+	Max       time.Duration
+	// Statuses counts responses by HTTP status; 0 means no response.
+	Statuses map[int]int
+}
+
+// Summary summarizes every operation seen so far, sorted by name. elapsed is the length
+// of the run, used for the request rate.
+func (s *Stats) Summary(elapsed time.Duration) []OpSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]OpSummary, 0, len(s.ops))
+	for op, o := range s.ops {
+		lat := append([]time.Duration(nil), o.latencies...)
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+
+		sum := OpSummary{
+			Op:       op,
+			Count:    len(lat),
+			Errors:   o.errors,
+			P50:      percentile(lat, 0.50),
+			P90:      percentile(lat, 0.90),
+			P99:      percentile(lat, 0.99),
+			Max:      percentile(lat, 1),
+			Statuses: make(map[int]int, len(o.statuses)),
+		}
+		for code, n := range o.statuses {
+			sum.Statuses[code] = n
+		}
+		if sum.Count > 0 {
+			sum.ErrorRate = float64(sum.Errors) / float64(sum.Count)
+		}
+		if elapsed > 0 {
+			sum.PerSecond = float64(sum.Count) / elapsed.Seconds()
+		}
+		out = append(out, sum)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Op < out[j].Op })
+	return out
+}
+
+// percentile is the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// WriteReport prints summaries as a table.
+func WriteReport(w io.Writer, sums []OpSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\terror %\treq/s\tp50\tp90\tp99\tmax\tstatuses\t")
+	for _, s := range sums {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.1f\t%v\t%v\t%v\t%v\t%s\t\n",
+			s.Op, s.Count, s.Errors, s.ErrorRate*100, s.PerSecond,
+			roundLatency(s.P50), roundLatency(s.P90), roundLatency(s.P99), roundLatency(s.Max),
+			formatStatuses(s.Statuses))
+	}
+	return tw.Flush()
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
+
+func formatStatuses(statuses map[int]int) string {
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	out := ""
+	for i, code := range codes {
+		if i > 0 {
+			out += " "
+		}
+		if code == 0 {
+			out += fmt.Sprintf("none:%d", statuses[code])
+		} else {
+			out += fmt.Sprintf("%d:%d", code, statuses[code])
+		}
+	}
+	return out
+}
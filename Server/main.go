@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"time"
+	_ "time/tzdata" // users' time zones, whatever the host has installed
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
@@ -63,26 +65,57 @@ func main() {
 
 	// Timeout puts an upper bound on request handling time.
 	// This prevents a request from hanging forever.
-	r.Use(middleware.Timeout(10 * time.Second))
+	// Live and leaderboard streams stay open, so they are registered outside it.
+	timeout := middleware.Timeout(10 * time.Second)
 
 	dbPool = openDB()
 	defer dbPool.Close()
 
+	// With arguments, run an admin command (see admin_commands.go) instead of serving.
+	if len(os.Args) > 1 {
+		if err := runAdminCommand(context.Background(), dbPool, os.Args[1:]); err != nil {
+			dbPool.Close()
+			log.Fatal(err)
+		}
+		return
+	}
+
 	store = NewPostgresAuthStore(dbPool)
 
+	initRepModel()
+
+	// Devices that can't afford HTTP+TLS publish over MQTT instead (MQTT_ADDR).
+	broker, err := startMQTTBroker()
+	if err != nil {
+		log.Fatalf("mqtt: %v", err)
+	}
+	if broker != nil {
+		defer broker.Close()
+	}
+
 	// --- API ROUTES ---
 	// We group all API endpoints under /api
 	r.Route("/api", func(api chi.Router) {
-		// Health endpoint: quick way to confirm server is running.
-		api.Get("/health", handleHealth)
-
-		// Register route groups defined in other files.
-		RegisterAuthRoutes(api)
-		RegisterFriendRoutes(api)
-		RegisterDeviceTokenRoutes(api)
-		RegisterProfileRoutes(api)
-		RegisterLeaderboardRoutes(api)
-		RegisterRepRoutes(api)
+		RegisterLiveRoutes(api)
+		RegisterLeaderboardStreamRoutes(api)
+
+		api.Group(func(api chi.Router) {
+			api.Use(timeout)
+
+			// Health endpoint: quick way to confirm server is running.
+			api.Get("/health", handleHealth)
+
+			// Register route groups defined in other files.
+			RegisterAuthRoutes(api)
+			RegisterFriendRoutes(api)
+			RegisterDeviceTokenRoutes(api)
+			RegisterProfileRoutes(api)
+			RegisterSettingsRoutes(api)
+			RegisterLeaderboardRoutes(api)
+			RegisterRepRoutes(api)
+			RegisterSessionRoutes(api)
+			RegisterAdminRoutes(api)
+		})
 	})
 
 	// --- STATIC FRONTEND FILES ---
@@ -92,31 +125,35 @@ func main() {
 	publicDir := filepath.Join("..", "Frontend")
 	fileServer := http.FileServer(http.Dir(publicDir))
 
-	// Protect ONLY "/" so unauth users get redirected before index.html loads (no "flash").
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, filepath.Join(publicDir, "index.html"))
-		}))
-		protected.ServeHTTP(w, r)
-	})
-
-	r.Get("/friends.html", func(w http.ResponseWriter, r *http.Request) {
-		protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, filepath.Join(publicDir, "friends.html"))
-		}))
-		protected.ServeHTTP(w, r)
+	r.Group(func(r chi.Router) {
+		r.Use(timeout)
+
+		// Protect ONLY "/" so unauth users get redirected before index.html loads (no "flash").
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeFile(w, r, filepath.Join(publicDir, "index.html"))
+			}))
+			protected.ServeHTTP(w, r)
+		})
+
+		r.Get("/friends.html", func(w http.ResponseWriter, r *http.Request) {
+			protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeFile(w, r, filepath.Join(publicDir, "friends.html"))
+			}))
+			protected.ServeHTTP(w, r)
+		})
+
+		r.Get("/profile.html", func(w http.ResponseWriter, r *http.Request) {
+			protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeFile(w, r, filepath.Join(publicDir, "profile.html"))
+			}))
+			protected.ServeHTTP(w, r)
+		})
+
+		// Everything else (login.html, register.html, css, js, etc.) stays publicly accessible.
+		r.Handle("/*", fileServer)
 	})
 
-	r.Get("/profile.html", func(w http.ResponseWriter, r *http.Request) {
-		protected := requireLoginRedirect(sessionMgr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, filepath.Join(publicDir, "profile.html"))
-		}))
-		protected.ServeHTTP(w, r)
-	})
-
-	// Everything else (login.html, register.html, css, js, etc.) stays publicly accessible.
-	r.Handle("/*", fileServer)
-
 	// Start the server on port 3000.
 	addr := ":3000"
 	log.Println("Server listening at http://localhost" + addr)
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS idempotency_key TEXT NULL;
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS request_hash TEXT NULL;
+
+-- NULL keys never collide, so sessions submitted without a key are unaffected.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rep_sessions_user_idempotency_key
+ON rep_sessions(user_id, idempotency_key);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_user_idempotency_key;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS request_hash;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS idempotency_key;
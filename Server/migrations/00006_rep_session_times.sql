@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ NULL;
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS ended_at TIMESTAMPTZ NULL;
+
+-- Existing rows were stamped on arrival, which is the best guess we have.
+UPDATE rep_sessions SET started_at = created_at WHERE started_at IS NULL;
+
+ALTER TABLE rep_sessions ALTER COLUMN started_at SET DEFAULT now();
+ALTER TABLE rep_sessions ALTER COLUMN started_at SET NOT NULL;
+ALTER TABLE rep_sessions ADD CONSTRAINT rep_sessions_ended_after_started
+  CHECK (ended_at IS NULL OR ended_at >= started_at);
+
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_started_at ON rep_sessions(started_at);
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_user_started_at ON rep_sessions(user_id, started_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_user_started_at;
+DROP INDEX IF EXISTS idx_rep_sessions_started_at;
+ALTER TABLE rep_sessions DROP CONSTRAINT IF EXISTS rep_sessions_ended_after_started;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS ended_at;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS started_at;
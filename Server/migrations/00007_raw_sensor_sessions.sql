@@ -0,0 +1,33 @@
+-- +goose Up
+-- reps holds the server's count for raw uploads; device_reps keeps what the device claimed.
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS device_reps INT NULL CHECK (device_reps >= 0);
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS baseline_mm REAL NULL;
+
+CREATE TABLE IF NOT EXISTS session_samples (
+  session_id BIGINT NOT NULL REFERENCES rep_sessions(id) ON DELETE CASCADE,
+  device_ts_ms BIGINT NOT NULL,
+  tof_mm REAL NOT NULL,
+  ax REAL NOT NULL,
+  ay REAL NOT NULL,
+  az REAL NOT NULL,
+  gx REAL NOT NULL,
+  gy REAL NOT NULL,
+  gz REAL NOT NULL,
+  PRIMARY KEY (session_id, device_ts_ms)
+);
+
+CREATE TABLE IF NOT EXISTS session_events (
+  session_id BIGINT NOT NULL REFERENCES rep_sessions(id) ON DELETE CASCADE,
+  seq INT NOT NULL,
+  device_ts_ms BIGINT NOT NULL,
+  event TEXT NOT NULL,
+  value REAL NULL,
+  state TEXT NOT NULL,
+  PRIMARY KEY (session_id, seq)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS session_events;
+DROP TABLE IF EXISTS session_samples;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS baseline_mm;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS device_reps;
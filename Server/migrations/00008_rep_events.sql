@@ -0,0 +1,14 @@
+-- +goose Up
+-- One row per rep. t_offset_ms is measured from the first sample of the recording.
+CREATE TABLE IF NOT EXISTS rep_events (
+  session_id BIGINT NOT NULL REFERENCES rep_sessions(id) ON DELETE CASCADE,
+  rep_index INT NOT NULL CHECK (rep_index >= 0),
+  t_offset_ms INT NOT NULL CHECK (t_offset_ms >= 0),
+  bottom_tof_mm REAL NOT NULL,
+  depth_mm REAL NOT NULL,
+  duration_ms INT NULL CHECK (duration_ms >= 0),
+  PRIMARY KEY (session_id, rep_index)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS rep_events;
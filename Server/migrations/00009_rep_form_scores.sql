@@ -0,0 +1,16 @@
+-- +goose Up
+-- Form scores are in [0, 1]. quality_reps counts reps deep enough for the user's calibrated range;
+-- both stay NULL for sessions without per-rep data.
+ALTER TABLE rep_events ADD COLUMN IF NOT EXISTS top_tof_mm REAL NULL;
+ALTER TABLE rep_events ADD COLUMN IF NOT EXISTS form_score REAL NULL CHECK (form_score BETWEEN 0 AND 1);
+ALTER TABLE rep_events ADD COLUMN IF NOT EXISTS is_quality BOOLEAN NULL;
+
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS form_score REAL NULL CHECK (form_score BETWEEN 0 AND 1);
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS quality_reps INT NULL CHECK (quality_reps >= 0);
+
+-- +goose Down
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS quality_reps;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS form_score;
+ALTER TABLE rep_events DROP COLUMN IF EXISTS is_quality;
+ALTER TABLE rep_events DROP COLUMN IF EXISTS form_score;
+ALTER TABLE rep_events DROP COLUMN IF EXISTS top_tof_mm;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- device_id is the token a device submitted with; it stays NULL for browser submissions
+-- and is cleared if the token is deleted. pace, notes and tags are what we used to keep
+-- by hand in data/session*.meta.txt.
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS device_id BIGINT NULL REFERENCES device_tokens(id) ON DELETE SET NULL;
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS pace TEXT NULL CHECK (pace IN ('slow', 'normal', 'fast'));
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS notes TEXT NULL CHECK (char_length(notes) <= 1000);
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_device_id ON rep_sessions(device_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_device_id;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS tags;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS notes;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS pace;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS device_id;
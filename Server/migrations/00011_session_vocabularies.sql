@@ -0,0 +1,43 @@
+-- +goose Up
+-- source and scope used to be free text. Map what we can recognize and default the rest:
+-- /api/reps was the device endpoint before manual entry existed, so unknown sources become
+-- device, and every old session was public.
+UPDATE rep_sessions rs
+SET source = 'server-detected'
+WHERE EXISTS (SELECT 1 FROM session_samples ss WHERE ss.session_id = rs.id);
+
+UPDATE rep_sessions
+SET source = CASE
+	WHEN lower(trim(source)) IN ('device', 'manual', 'import', 'server-detected') THEN lower(trim(source))
+	WHEN lower(trim(source)) IN ('web', 'app', 'ui', 'form', 'browser') THEN 'manual'
+	WHEN lower(trim(source)) IN ('csv', 'backfill', 'imported') THEN 'import'
+	ELSE 'device'
+END
+WHERE source IS DISTINCT FROM 'server-detected';
+
+UPDATE rep_sessions
+SET scope = CASE
+	WHEN lower(trim(scope)) IN ('friends', 'private') THEN lower(trim(scope))
+	ELSE 'public'
+END;
+
+ALTER TABLE rep_sessions ALTER COLUMN source SET DEFAULT 'manual';
+ALTER TABLE rep_sessions ALTER COLUMN source SET NOT NULL;
+ALTER TABLE rep_sessions ADD CONSTRAINT rep_sessions_source_check
+  CHECK (source IN ('device', 'manual', 'import', 'server-detected'));
+
+ALTER TABLE rep_sessions ALTER COLUMN scope SET DEFAULT 'public';
+ALTER TABLE rep_sessions ALTER COLUMN scope SET NOT NULL;
+ALTER TABLE rep_sessions ADD CONSTRAINT rep_sessions_scope_check
+  CHECK (scope IN ('public', 'friends', 'private'));
+
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_user_source ON rep_sessions(user_id, source);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_user_source;
+ALTER TABLE rep_sessions DROP CONSTRAINT IF EXISTS rep_sessions_scope_check;
+ALTER TABLE rep_sessions ALTER COLUMN scope DROP NOT NULL;
+ALTER TABLE rep_sessions ALTER COLUMN scope DROP DEFAULT;
+ALTER TABLE rep_sessions DROP CONSTRAINT IF EXISTS rep_sessions_source_check;
+ALTER TABLE rep_sessions ALTER COLUMN source DROP NOT NULL;
+ALTER TABLE rep_sessions ALTER COLUMN source DROP DEFAULT;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Sessions the anomaly checks flag are kept off leaderboards until an admin approves or rejects them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS review_status TEXT NOT NULL DEFAULT 'ok'
+  CHECK (review_status IN ('ok', 'flagged', 'approved', 'rejected'));
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS anomaly_score REAL NULL;
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS anomaly_reasons TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS reviewed_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMPTZ NULL;
+
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_flagged ON rep_sessions(created_at) WHERE review_status = 'flagged';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_flagged;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS anomaly_reasons;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS anomaly_score;
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS review_status;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Every create, edit, delete and review of a rep session leaves a row here so leaderboard
+-- disputes can be audited. session_id has no foreign key: revisions outlive deleted sessions.
+CREATE TABLE IF NOT EXISTS session_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  session_id BIGINT NOT NULL,
+  owner_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_user_id BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete', 'review')),
+  before JSONB NULL,
+  after JSONB NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_revisions_session ON session_revisions(session_id, id);
+
+-- Keyset pagination for GET /api/me/sessions.
+CREATE INDEX IF NOT EXISTS idx_rep_sessions_user_started ON rep_sessions(user_id, started_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_rep_sessions_user_started;
+DROP TABLE IF EXISTS session_revisions;
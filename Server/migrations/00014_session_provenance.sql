@@ -0,0 +1,14 @@
+-- +goose Up
+-- How much to trust a session's count, derived from its source so the two can't disagree:
+-- manual (typed in or imported), device-reported (the device's own count),
+-- server-verified (counted by the server from raw sensor data).
+ALTER TABLE rep_sessions ADD COLUMN IF NOT EXISTS provenance TEXT GENERATED ALWAYS AS (
+  CASE source
+    WHEN 'server-detected' THEN 'server-verified'
+    WHEN 'device' THEN 'device-reported'
+    ELSE 'manual'
+  END
+) STORED;
+
+-- +goose Down
+ALTER TABLE rep_sessions DROP COLUMN IF EXISTS provenance;
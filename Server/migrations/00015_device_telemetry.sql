@@ -0,0 +1,17 @@
+-- +goose Up
+-- Status reports devices publish over MQTT (battery, signal, firmware version, ...).
+-- The payload is kept as sent so firmware can add fields without a migration.
+CREATE TABLE IF NOT EXISTS device_telemetry (
+  id BIGSERIAL PRIMARY KEY,
+  device_id BIGINT NOT NULL REFERENCES device_tokens(id) ON DELETE CASCADE,
+  payload JSONB NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_telemetry_device ON device_telemetry(device_id, received_at DESC);
+
+ALTER TABLE device_tokens ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ NULL;
+
+-- +goose Down
+ALTER TABLE device_tokens DROP COLUMN IF EXISTS last_seen_at;
+DROP TABLE IF EXISTS device_telemetry;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- The IANA zone (e.g. America/Los_Angeles) a user's calendar days are counted in, for
+-- streaks and the today/this-week/this-month leaderboard windows. NULL until the user
+-- picks one, and counted as UTC meanwhile.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
@@ -0,0 +1,118 @@
+-- +goose Up
+-- Reps per user per local calendar day (in users.time_zone, UTC when unset), split by
+-- source and scope so leaderboards and profiles can total any filter without rescanning
+-- rep_sessions. Only sessions that count are rolled up: flagged sessions wait for an
+-- admin and rejected ones never count. Kept in step with rep_sessions in the same
+-- transaction; `go run . rebuild-stats` recomputes it.
+CREATE TABLE IF NOT EXISTS user_daily_reps (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day DATE NOT NULL,
+  source TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  reps INT NOT NULL,
+  quality_reps INT NOT NULL,
+  sessions INT NOT NULL CHECK (sessions > 0),
+  PRIMARY KEY (user_id, day, source, scope)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_daily_reps_day ON user_daily_reps(day);
+
+-- Lifetime totals and streaks per user for each filter a leaderboard or profile can ask
+-- for: scope is the most private scope counted (public counts public sessions, friends
+-- also friends-only ones, private every session) and sources is a bitmask over device,
+-- manual, import and server-detected, in that order. Rows only exist for filters with
+-- at least one active day. current_streak is the run of consecutive days ending at
+-- last_active_day; it only counts as a streak while last_active_day is the user's today.
+CREATE TABLE IF NOT EXISTS user_stats (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  scope TEXT NOT NULL,
+  sources SMALLINT NOT NULL CHECK (sources BETWEEN 1 AND 15),
+  lifetime_reps BIGINT NOT NULL DEFAULT 0,
+  lifetime_quality_reps BIGINT NOT NULL DEFAULT 0,
+  lifetime_manual_reps BIGINT NOT NULL DEFAULT 0,
+  lifetime_device_reps BIGINT NOT NULL DEFAULT 0,
+  lifetime_verified_reps BIGINT NOT NULL DEFAULT 0,
+  current_streak INT NOT NULL DEFAULT 0,
+  longest_streak INT NOT NULL DEFAULT 0,
+  last_active_day DATE NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, scope, sources)
+);
+
+INSERT INTO user_daily_reps (user_id, day, source, scope, reps, quality_reps, sessions)
+SELECT
+  rs.user_id,
+  (rs.started_at AT TIME ZONE COALESCE(u.time_zone, 'UTC'))::date,
+  rs.source,
+  rs.scope,
+  SUM(rs.reps),
+  COALESCE(SUM(rs.quality_reps), 0),
+  COUNT(*)
+FROM rep_sessions rs
+JOIN users u ON u.id = rs.user_id
+WHERE rs.review_status NOT IN ('flagged', 'rejected')
+GROUP BY 1, 2, 3, 4
+ON CONFLICT (user_id, day, source, scope) DO NOTHING;
+
+INSERT INTO user_stats (
+  user_id, scope, sources,
+  lifetime_reps, lifetime_quality_reps, lifetime_manual_reps, lifetime_device_reps, lifetime_verified_reps,
+  current_streak, longest_streak, last_active_day
+)
+WITH keyed_days AS (
+  SELECT
+    udr.user_id,
+    k.scope,
+    m.sources::smallint AS sources,
+    udr.day,
+    SUM(udr.reps) AS reps,
+    SUM(udr.quality_reps) AS quality_reps,
+    SUM(udr.reps) FILTER (WHERE udr.source IN ('manual', 'import')) AS manual_reps,
+    SUM(udr.reps) FILTER (WHERE udr.source = 'device') AS device_reps,
+    SUM(udr.reps) FILTER (WHERE udr.source = 'server-detected') AS verified_reps
+  FROM user_daily_reps udr
+  JOIN (VALUES ('public', 1), ('friends', 2), ('private', 3)) k(scope, rank)
+    ON k.rank >= array_position(ARRAY['public', 'friends', 'private'], udr.scope)
+  JOIN generate_series(1, 15) m(sources)
+    ON m.sources & (1 << (array_position(ARRAY['device', 'manual', 'import', 'server-detected'], udr.source) - 1)) <> 0
+  GROUP BY 1, 2, 3, 4
+),
+runs AS (
+  SELECT user_id, scope, sources, COUNT(*)::int AS days, MAX(day) AS last_day
+  FROM (
+    SELECT
+      user_id, scope, sources, day,
+      day - (ROW_NUMBER() OVER (PARTITION BY user_id, scope, sources ORDER BY day))::int AS run
+    FROM keyed_days
+  ) numbered
+  GROUP BY user_id, scope, sources, run
+),
+streaks AS (
+  SELECT
+    user_id, scope, sources,
+    MAX(days) AS longest_streak,
+    (ARRAY_AGG(days ORDER BY last_day DESC))[1] AS current_streak,
+    MAX(last_day) AS last_active_day
+  FROM runs
+  GROUP BY user_id, scope, sources
+)
+SELECT
+  kd.user_id,
+  kd.scope,
+  kd.sources,
+  SUM(kd.reps),
+  SUM(kd.quality_reps),
+  COALESCE(SUM(kd.manual_reps), 0),
+  COALESCE(SUM(kd.device_reps), 0),
+  COALESCE(SUM(kd.verified_reps), 0),
+  s.current_streak,
+  s.longest_streak,
+  s.last_active_day
+FROM keyed_days kd
+JOIN streaks s USING (user_id, scope, sources)
+GROUP BY kd.user_id, kd.scope, kd.sources, s.current_streak, s.longest_streak, s.last_active_day
+ON CONFLICT (user_id, scope, sources) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS user_stats;
+DROP TABLE IF EXISTS user_daily_reps;
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Devices for which HTTP+TLS is too heavy publish to the MQTT broker the server embeds.
+// They connect with their device token as the password and their device ID, as returned
+// by POST /api/device-tokens/register, as the client ID. The client ID names their topics:
+//
+//	devices/{deviceID}/reps       one rep session, the same JSON as POST /api/reps
+//	devices/{deviceID}/telemetry  a JSON object of device status, stored as sent
+//
+// Tying the client ID to the token keeps one device from connecting under another's
+// ID, which would take over its session and its topics.
+//
+// Either may be CBOR instead of JSON (see device_codec.go).
+//
+// Reps take the same path as handleReps. Anything that speaks MQTT, mosquitto_pub
+// included, can stand in for a device.
+
+var (
+	ErrTelemetryInvalid = errors.New("telemetry must be a JSON object")
+	ErrMQTTTopic        = errors.New("unknown device topic")
+)
+
+const (
+	mqttTopicReps      = "reps"
+	mqttTopicTelemetry = "telemetry"
+
+	maxTelemetryBytes = 4 << 10
+
+	// mqttDedupeWindow is how long a QoS 1 publish is remembered. A device whose
+	// PUBACK was lost redelivers on reconnect, well within it.
+	mqttDedupeWindow = 10 * time.Minute
+)
+
+// startMQTTBroker starts the device broker on MQTT_ADDR, e.g. ":1883". It returns nil
+// when MQTT_ADDR is unset.
+func startMQTTBroker() (*mqtt.Server, error) {
+	addr := os.Getenv("MQTT_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	caps := mqtt.NewDefaultServerCapabilities()
+	caps.MaximumPacketSize = maxRepBatchBytes
+	broker := mqtt.New(&mqtt.Options{
+		Capabilities: caps,
+		Logger:       slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+
+	if err := broker.AddHook(newMQTTIngestHook(postgresDeviceIngest{}), nil); err != nil {
+		return nil, err
+	}
+	if err := broker.AddListener(listeners.NewTCP(listeners.Config{ID: "devices", Address: addr})); err != nil {
+		return nil, err
+	}
+	if err := broker.Serve(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("MQTT broker listening at %s", addr)
+	return broker, nil
+}
+
+// mqttDevice is who an MQTT connection authenticated as.
+type mqttDevice struct {
+	UserID   int64
+	DeviceID int64
+}
+
+// deviceIngest is what the MQTT hook needs from storage.
+type deviceIngest interface {
+	Authenticate(ctx context.Context, token string) (mqttDevice, error)
+	StoreReps(ctx context.Context, dev mqttDevice, req repRequest, key string) (sessionID int64, replayed bool, err error)
+	StoreTelemetry(ctx context.Context, dev mqttDevice, payload []byte) error
+}
+
+type postgresDeviceIngest struct{}
+
+func (postgresDeviceIngest) Authenticate(ctx context.Context, token string) (mqttDevice, error) {
+	userID, deviceID, err := userIDFromDeviceToken(ctx, token)
+	return mqttDevice{UserID: userID, DeviceID: deviceID}, err
+}
+
+func (postgresDeviceIngest) StoreReps(ctx context.Context, dev mqttDevice, req repRequest, key string) (int64, bool, error) {
+	return storeRepRequest(ctx, dev.UserID, req, key)
+}
+
+func (postgresDeviceIngest) StoreTelemetry(ctx context.Context, dev mqttDevice, payload []byte) error {
+	const q = `
+		WITH seen AS (
+			UPDATE device_tokens
+			SET last_seen_at = now()
+			WHERE id = $1
+		)
+		INSERT INTO device_telemetry (device_id, payload)
+		VALUES ($1, $2::jsonb);
+	`
+
+	_, err := dbPool.Exec(ctx, q, dev.DeviceID, string(payload))
+	return err
+}
+
+// mqttIngestHook authenticates devices, keeps each one to its own topics and routes
+// what they publish into storage.
+type mqttIngestHook struct {
+	mqtt.HookBase
+
+	store  deviceIngest
+	dedupe *publishDedupe
+
+	mu      sync.Mutex
+	devices map[*mqtt.Client]mqttDevice
+}
+
+func newMQTTIngestHook(store deviceIngest) *mqttIngestHook {
+	return &mqttIngestHook{
+		store:   store,
+		dedupe:  newPublishDedupe(mqttDedupeWindow),
+		devices: map[*mqtt.Client]mqttDevice{},
+	}
+}
+
+func (h *mqttIngestHook) ID() string { return "device-ingest" }
+
+func (h *mqttIngestHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mqtt.OnConnectAuthenticate,
+		mqtt.OnACLCheck,
+		mqtt.OnDisconnect,
+		mqtt.OnPublish,
+	}, []byte{b})
+}
+
+// OnConnectAuthenticate accepts a device whose password is a registered device token
+// and whose client ID is that token's device ID.
+func (h *mqttIngestHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	if !validMQTTClientID(pk.Connect.ClientIdentifier) {
+		return false
+	}
+	token := strings.TrimSpace(string(pk.Connect.Password))
+	if token == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dev, err := h.store.Authenticate(ctx, token)
+	if err != nil {
+		if !errors.Is(err, ErrDeviceTokenInvalid) {
+			log.Printf("mqtt: authenticate %s: %v", cl.ID, err)
+		}
+		return false
+	}
+	if pk.Connect.ClientIdentifier != mqttClientID(dev) {
+		log.Printf("mqtt: device %d connected as %q", dev.DeviceID, pk.Connect.ClientIdentifier)
+		return false
+	}
+
+	h.mu.Lock()
+	h.devices[cl] = dev
+	h.mu.Unlock()
+	return true
+}
+
+func (h *mqttIngestHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	h.mu.Lock()
+	delete(h.devices, cl)
+	h.mu.Unlock()
+}
+
+// OnACLCheck lets a device publish to its own reps and telemetry topics and nothing
+// else. Nothing is published to devices, so they can't subscribe.
+func (h *mqttIngestHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+	if !write {
+		return false
+	}
+	h.mu.Lock()
+	dev, authed := h.devices[cl]
+	h.mu.Unlock()
+	id, kind, ok := parseDeviceTopic(topic)
+	return authed && ok && id == mqttClientID(dev) && (kind == mqttTopicReps || kind == mqttTopicTelemetry)
+}
+
+// OnPublish stores what a device sent. A publish the server fails to store is not
+// acknowledged, so a QoS 1 device sends it again; one the server rejects is
+// acknowledged and logged, since sending it again won't help.
+func (h *mqttIngestHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline {
+		return pk, nil
+	}
+
+	h.mu.Lock()
+	dev, ok := h.devices[cl]
+	h.mu.Unlock()
+	if !ok {
+		return pk, packets.ErrRejectPacket
+	}
+
+	var dedupeKey string
+	if pk.FixedHeader.Qos > 0 {
+		dedupeKey = publishDedupeKey(cl.ID, pk)
+		// A redelivery of something already handled: acknowledge it again, store nothing.
+		if pk.FixedHeader.Dup && h.dedupe.Seen(dedupeKey) {
+			return pk, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, kind, _ := parseDeviceTopic(pk.TopicName)
+	err := h.ingest(ctx, dev, kind, pk.Payload)
+	var rejected *deviceMessageError
+	switch {
+	case errors.As(err, &rejected):
+		log.Printf("mqtt: %s %s rejected: %v", cl.ID, kind, rejected.Err)
+	case err != nil:
+		log.Printf("mqtt: %s %s: %v", cl.ID, kind, err)
+		return pk, packets.ErrRejectPacket
+	}
+
+	if dedupeKey != "" {
+		h.dedupe.Remember(dedupeKey)
+	}
+	return pk, nil
+}
+
+// deviceMessageError is a message the device got wrong, as opposed to one the server
+// failed to store.
+type deviceMessageError struct{ Err error }
+
+func (e *deviceMessageError) Error() string { return e.Err.Error() }
+func (e *deviceMessageError) Unwrap() error { return e.Err }
+
+func (h *mqttIngestHook) ingest(ctx context.Context, dev mqttDevice, kind string, payload []byte) error {
+	switch kind {
+	case mqttTopicReps:
+		var req repRequest
+		if err := decodeDevicePayload(payload, &req); err != nil {
+			return &deviceMessageError{err}
+		}
+		req.DeviceID = &dev.DeviceID
+
+		if err := prepareRepRequest(&req, time.Now().UTC()); err != nil {
+			return &deviceMessageError{err}
+		}
+		key, err := normalizeIdempotencyKey(req.ClientSessionID)
+		if err != nil {
+			return &deviceMessageError{err}
+		}
+
+		_, _, err = h.store.StoreReps(ctx, dev, req, key)
+		if errors.Is(err, ErrIdempotencyConflict) {
+			return &deviceMessageError{err}
+		}
+		return err
+
+	case mqttTopicTelemetry:
+		doc, err := telemetryJSON(payload)
+		if err != nil {
+			return &deviceMessageError{err}
+		}
+		return h.store.StoreTelemetry(ctx, dev, doc)
+	}
+
+	return &deviceMessageError{ErrMQTTTopic}
+}
+
+// telemetryJSON accepts a small JSON or CBOR object, whose fields are up to the
+// firmware, and returns it as JSON for storage.
+func telemetryJSON(payload []byte) ([]byte, error) {
+	if len(payload) > maxTelemetryBytes {
+		return nil, fmt.Errorf("telemetry is larger than %d bytes", maxTelemetryBytes)
+	}
+	var obj map[string]any
+	if err := decodeDevicePayload(payload, &obj); err != nil || obj == nil {
+		return nil, ErrTelemetryInvalid
+	}
+	if payload[0] == '{' {
+		return payload, nil
+	}
+	return json.Marshal(obj)
+}
+
+// parseDeviceTopic splits devices/{id}/{kind}.
+func parseDeviceTopic(topic string) (id, kind string, ok bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 || parts[0] != "devices" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// mqttClientID is the only client ID a device may connect with.
+func mqttClientID(dev mqttDevice) string {
+	return strconv.FormatInt(dev.DeviceID, 10)
+}
+
+// validMQTTClientID keeps client IDs to what fits in one topic level and a log line.
+func validMQTTClientID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, ch := range id {
+		if ch < 0x21 || ch > 0x7e || ch == '/' || ch == '+' || ch == '#' {
+			return false
+		}
+	}
+	return true
+}
+
+// publishDedupeKey identifies a QoS 1 publish across redeliveries: the device resends
+// the same packet ID and payload with DUP set. Packet IDs are reused once acknowledged,
+// so the payload is part of the key.
+func publishDedupeKey(clientID string, pk packets.Packet) string {
+	sum := sha256.Sum256(pk.Payload)
+	return clientID + "\x00" + strconv.Itoa(int(pk.PacketID)) + "\x00" + pk.TopicName + "\x00" + hex.EncodeToString(sum[:])
+}
+
+// publishDedupe remembers recently handled publishes.
+type publishDedupe struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newPublishDedupe(window time.Duration) *publishDedupe {
+	return &publishDedupe{window: window, now: time.Now, seen: map[string]time.Time{}}
+}
+
+// Seen reports whether key was remembered within the window.
+func (d *publishDedupe) Seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	at, ok := d.seen[key]
+	return ok && d.now().Sub(at) < d.window
+}
+
+// Remember records key as handled now and forgets keys older than the window.
+func (d *publishDedupe) Remember(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.seen[key] = now
+	if now.Sub(d.lastSweep) < d.window/2 {
+		return
+	}
+	for k, at := range d.seen {
+		if now.Sub(at) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	d.lastSweep = now
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// testDeviceToken authenticates device 3 and otherDeviceToken device 4, both user 7's.
+const (
+	testDeviceToken  = "Dev1ceTokenForMQTTTests"
+	otherDeviceToken = "0therDeviceTokenForMQTT"
+)
+
+// deviceSet is a reps payload with the given fields and the start and end times every
+// device session carries, for a set that ended just now.
+func deviceSet(fields string) string {
+	end := time.Now().UTC().Truncate(time.Second)
+	return fmt.Sprintf(`{%s,"startedAt":%q,"endedAt":%q}`,
+		fields, end.Add(-time.Minute).Format(time.RFC3339), end.Format(time.RFC3339))
+}
+
+type fakeDeviceIngest struct {
+	mu        sync.Mutex
+	reps      []repRequest
+	keys      []string
+	telemetry []string
+	// fail makes the next store fail like a database outage.
+	fail bool
+}
+
+func (f *fakeDeviceIngest) Authenticate(ctx context.Context, token string) (mqttDevice, error) {
+	switch token {
+	case testDeviceToken:
+		return mqttDevice{UserID: 7, DeviceID: 3}, nil
+	case otherDeviceToken:
+		return mqttDevice{UserID: 7, DeviceID: 4}, nil
+	}
+	return mqttDevice{}, ErrDeviceTokenInvalid
+}
+
+func (f *fakeDeviceIngest) StoreReps(ctx context.Context, dev mqttDevice, req repRequest, key string) (int64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		f.fail = false
+		return 0, false, errors.New("database is down")
+	}
+	f.reps = append(f.reps, req)
+	f.keys = append(f.keys, key)
+	return int64(len(f.reps)), false, nil
+}
+
+func (f *fakeDeviceIngest) StoreTelemetry(ctx context.Context, dev mqttDevice, payload []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.telemetry = append(f.telemetry, string(payload))
+	return nil
+}
+
+func (f *fakeDeviceIngest) counts() (reps, telemetry int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.reps), len(f.telemetry)
+}
+
+func newTestBroker(t *testing.T, store deviceIngest) *mqtt.Server {
+	t.Helper()
+	broker := mqtt.New(&mqtt.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := broker.AddHook(newMQTTIngestHook(store), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = broker.Close() })
+	return broker
+}
+
+// testMQTTClient speaks just enough MQTT 3.1.1 to connect and publish.
+type testMQTTClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// dialTestBroker connects and returns the CONNACK return code.
+func dialTestBroker(t *testing.T, broker *mqtt.Server, clientID, password string) (*testMQTTClient, byte) {
+	t.Helper()
+	server, conn := net.Pipe()
+	go func() { _ = broker.EstablishConnection("test", server) }()
+	t.Cleanup(func() { conn.Close() })
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: 4,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			Clean:            true,
+			Keepalive:        30,
+			ClientIdentifier: clientID,
+			UsernameFlag:     true,
+			Username:         []byte(clientID),
+			PasswordFlag:     password != "",
+			Password:         []byte(password),
+		},
+	}
+	c := &testMQTTClient{t: t, conn: conn}
+	c.write(pk.ConnectEncode)
+
+	ack := c.read(4)
+	if ack == nil || ack[0] != packets.Connack<<4 {
+		t.Fatalf("connect: got %v; want CONNACK", ack)
+	}
+	return c, ack[3]
+}
+
+func (c *testMQTTClient) write(encode func(*bytes.Buffer) error) {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		c.t.Fatal(err)
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next n bytes, or nil when none arrive in time or the broker hung up.
+func (c *testMQTTClient) read(n int) []byte {
+	_ = c.conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	b := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		return nil
+	}
+	return b
+}
+
+// publish sends a QoS 1 publish and reports whether the broker acknowledged it.
+func (c *testMQTTClient) publish(topic string, id uint16, dup bool, payload string) bool {
+	c.t.Helper()
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Publish, Qos: 1, Dup: dup},
+		ProtocolVersion: 4,
+		TopicName:       topic,
+		PacketID:        id,
+		Payload:         []byte(payload),
+	}
+	c.write(pk.PublishEncode)
+
+	ack := c.read(4)
+	if ack == nil {
+		return false
+	}
+	if ack[0] != packets.Puback<<4 || uint16(ack[2])<<8|uint16(ack[3]) != id {
+		c.t.Fatalf("publish %d: got %v; want its PUBACK", id, ack)
+	}
+	return true
+}
+
+func TestMQTTConnectNeedsDeviceToken(t *testing.T) {
+	broker := newTestBroker(t, &fakeDeviceIngest{})
+
+	cases := []struct {
+		name     string
+		clientID string
+		password string
+		ok       bool
+	}{
+		{"device token", "3", testDeviceToken, true},
+		{"wrong token", "3", "Wr0ngTokenForMQTTTests", false},
+		{"no password", "3", "", false},
+		{"another device's client ID", "4", testDeviceToken, false},
+		{"client ID of its own choosing", "pressle-1", testDeviceToken, false},
+		{"no client ID", "", testDeviceToken, false},
+		{"client ID with a topic separator", "3/reps", testDeviceToken, false},
+	}
+	for _, tc := range cases {
+		_, code := dialTestBroker(t, broker, tc.clientID, tc.password)
+		if got := code == 0; got != tc.ok {
+			t.Fatalf("%s: CONNACK code %d", tc.name, code)
+		}
+	}
+}
+
+// A device connecting under another's client ID would take over its session; the broker
+// refuses it and the first device carries on.
+func TestMQTTRefusesAnotherDevicesClientID(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	first, code := dialTestBroker(t, broker, "3", testDeviceToken)
+	if code != 0 {
+		t.Fatalf("first device: CONNACK code %d", code)
+	}
+
+	if _, code := dialTestBroker(t, broker, "3", otherDeviceToken); code == 0 {
+		t.Fatal("second device connected with the first device's client ID")
+	}
+
+	if !first.publish("devices/3/reps", 1, false, deviceSet(`"reps":12`)) {
+		t.Fatal("first device was disconnected")
+	}
+	if reps, _ := store.counts(); reps != 1 {
+		t.Fatalf("stored %d reps", reps)
+	}
+}
+
+func TestMQTTRoutesDeviceTopics(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	if !c.publish("devices/3/reps", 1, false, deviceSet(`"reps":12,"clientSessionId":"set-1","scope":"friends"`)) {
+		t.Fatal("reps not acknowledged")
+	}
+	if !c.publish("devices/3/telemetry", 2, false, `{"batteryMv":3900,"rssiDbm":-61}`) {
+		t.Fatal("telemetry not acknowledged")
+	}
+
+	if len(store.reps) != 1 || len(store.telemetry) != 1 {
+		t.Fatalf("stored %d reps and %d telemetry", len(store.reps), len(store.telemetry))
+	}
+	req := store.reps[0]
+	// Prepared like POST /api/reps from a device.
+	if req.Reps != 12 || req.Source != SourceDevice || req.Scope != "friends" || req.DeviceID == nil || *req.DeviceID != 3 {
+		t.Fatalf("stored %+v", req)
+	}
+	if store.keys[0] != "set-1" {
+		t.Fatalf("idempotency key %q", store.keys[0])
+	}
+}
+
+func TestMQTTAcceptsCBOR(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	end := time.Now().UTC().Truncate(time.Second)
+	reps, _ := cbor.Marshal(map[string]any{
+		"reps": 9, "clientSessionId": "set-2",
+		"startedAt": end.Add(-time.Minute).Format(time.RFC3339), "endedAt": end.Format(time.RFC3339),
+	})
+	telemetry, _ := cbor.Marshal(map[string]any{"batteryMv": 3850})
+	if !c.publish("devices/3/reps", 1, false, string(reps)) {
+		t.Fatal("reps not acknowledged")
+	}
+	if !c.publish("devices/3/telemetry", 2, false, string(telemetry)) {
+		t.Fatal("telemetry not acknowledged")
+	}
+
+	if len(store.reps) != 1 || store.reps[0].Reps != 9 || store.keys[0] != "set-2" {
+		t.Fatalf("stored reps %+v", store.reps)
+	}
+	// Telemetry is stored as JSON whatever it arrived as.
+	if len(store.telemetry) != 1 || store.telemetry[0] != `{"batteryMv":3850}` {
+		t.Fatalf("stored telemetry %q", store.telemetry)
+	}
+}
+
+func TestMQTTRejectsInvalidMessages(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	// Bad messages are acknowledged, because sending them again won't help, but not stored.
+	for i, payload := range []string{`{"reps":0}`, `not json`, `{"reps":5,"scope":"everyone"}`, `{"reps":5}`} {
+		if !c.publish("devices/3/reps", uint16(i+1), false, payload) {
+			t.Fatalf("%s: not acknowledged", payload)
+		}
+	}
+	if !c.publish("devices/3/telemetry", 9, false, `[1,2,3]`) {
+		t.Fatal("telemetry not acknowledged")
+	}
+	if reps, telemetry := store.counts(); reps != 0 || telemetry != 0 {
+		t.Fatalf("stored %d reps and %d telemetry", reps, telemetry)
+	}
+}
+
+func TestMQTTDeviceOnlyPublishesToItsTopics(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	// MQTT 3.1.1 has no way to refuse one publish, so the broker hangs up.
+	if c.publish("devices/4/reps", 1, false, `{"reps":12}`) {
+		t.Fatal("publish to another device's topic was acknowledged")
+	}
+	if reps, _ := store.counts(); reps != 0 {
+		t.Fatalf("stored %d reps", reps)
+	}
+}
+
+func TestMQTTDedupesRedeliveries(t *testing.T) {
+	store := &fakeDeviceIngest{}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	set := deviceSet(`"reps":20`)
+	if !c.publish("devices/3/reps", 1, false, set) {
+		t.Fatal("not acknowledged")
+	}
+	// The PUBACK was lost with the connection; the device reconnects and redelivers
+	// with DUP set.
+	c.conn.Close()
+	c, _ = dialTestBroker(t, broker, "3", testDeviceToken)
+	if !c.publish("devices/3/reps", 1, true, set) {
+		t.Fatal("redelivery not acknowledged")
+	}
+	if reps, _ := store.counts(); reps != 1 {
+		t.Fatalf("stored %d sessions; want the redelivery dropped", reps)
+	}
+
+	// Packet IDs are reused once acknowledged: a new set under the same ID is stored.
+	if !c.publish("devices/3/reps", 1, false, set) {
+		t.Fatal("not acknowledged")
+	}
+	if reps, _ := store.counts(); reps != 2 {
+		t.Fatalf("stored %d sessions; want the new publish stored", reps)
+	}
+}
+
+func TestMQTTUnstoredPublishIsRedelivered(t *testing.T) {
+	store := &fakeDeviceIngest{fail: true}
+	broker := newTestBroker(t, store)
+	c, _ := dialTestBroker(t, broker, "3", testDeviceToken)
+
+	if c.publish("devices/3/reps", 4, false, deviceSet(`"reps":8`)) {
+		t.Fatal("a publish the server failed to store was acknowledged")
+	}
+	// Not remembered either, so the redelivery is stored.
+	if !c.publish("devices/3/reps", 4, true, deviceSet(`"reps":8`)) {
+		t.Fatal("redelivery not acknowledged")
+	}
+	if reps, _ := store.counts(); reps != 1 {
+		t.Fatalf("stored %d sessions", reps)
+	}
+}
+
+func TestPublishDedupeForgets(t *testing.T) {
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	d := newPublishDedupe(10 * time.Minute)
+	d.now = func() time.Time { return now }
+
+	d.Remember("a")
+	if !d.Seen("a") || d.Seen("b") {
+		t.Fatal("fresh key")
+	}
+
+	now = now.Add(11 * time.Minute)
+	if d.Seen("a") {
+		t.Fatal("key outlived the window")
+	}
+	d.Remember("b")
+	if _, ok := d.seen["a"]; ok {
+		t.Fatal("expired key was not swept")
+	}
+}
+
+func TestParseDeviceTopic(t *testing.T) {
+	cases := []struct {
+		topic    string
+		id, kind string
+		ok       bool
+	}{
+		{"devices/pressle-1/reps", "pressle-1", "reps", true},
+		{"devices/pressle-1/telemetry", "pressle-1", "telemetry", true},
+		{"devices//reps", "", "", false},
+		{"devices/pressle-1/reps/extra", "", "", false},
+		{"users/pressle-1/reps", "", "", false},
+	}
+	for _, tc := range cases {
+		id, kind, ok := parseDeviceTopic(tc.topic)
+		if id != tc.id || kind != tc.kind || ok != tc.ok {
+			t.Fatalf("%s: got %q %q %v", tc.topic, id, kind, ok)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package classifier runs the pushup/not-pushup window classifier in process.
+//
+// The model is the JSON export written by data/data_processing/export_model.py:
+// the StandardScaler and LogisticRegression from model.joblib, flattened into
+// plain arrays. Predictions match predict_proba(X)[:, 1] from scikit-learn.
+package classifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"PUSH-UP-ANALYZER/processing/windows"
+)
+
+// Format is the only export format this package understands.
+const Format = "standard_scaler+logistic_regression"
+
+var (
+	ErrUnsupportedModel = errors.New("unsupported model export")
+	ErrFeatureMismatch  = errors.New("model features do not match")
+)
+
+// Model is a binary logistic regression over standardized features.
+type Model struct {
+	Format      string    `json:"format"`
+	Version     int       `json:"version"`
+	Features    []string  `json:"features"`
+	Classes     []int     `json:"classes"`
+	ScalerMean  []float64 `json:"scaler_mean"`
+	ScalerScale []float64 `json:"scaler_scale"`
+	Coef        []float64 `json:"coef"`
+	Intercept   float64   `json:"intercept"`
+}
+
+// Load decodes a model export and checks that its arrays line up.
+func Load(r io.Reader) (*Model, error) {
+	var m Model
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode model: %w", err)
+	}
+
+	if m.Format != Format || m.Version != 1 {
+		return nil, fmt.Errorf("%w: %s v%d", ErrUnsupportedModel, m.Format, m.Version)
+	}
+	if len(m.Classes) != 2 || m.Classes[0] != 0 || m.Classes[1] != 1 {
+		return nil, fmt.Errorf("%w: classes %v, want [0 1]", ErrUnsupportedModel, m.Classes)
+	}
+
+	n := len(m.Features)
+	if n == 0 || len(m.ScalerMean) != n || len(m.ScalerScale) != n || len(m.Coef) != n {
+		return nil, fmt.Errorf("%w: %d features, %d means, %d scales, %d coefficients",
+			ErrUnsupportedModel, n, len(m.ScalerMean), len(m.ScalerScale), len(m.Coef))
+	}
+
+	return &m, nil
+}
+
+// LoadFile reads a model export from disk.
+func LoadFile(path string) (*Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// ReadFeatureList reads model_features.json, the column order train_model.py used.
+func ReadFeatureList(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return names, nil
+}
+
+// CheckFeatures reports an error unless names is exactly the model's column order.
+// Call it with model_features.json and with windows.FeatureNames before serving predictions.
+func (m *Model) CheckFeatures(names []string) error {
+	if len(names) != len(m.Features) {
+		return fmt.Errorf("%w: model has %d features, input has %d", ErrFeatureMismatch, len(m.Features), len(names))
+	}
+	for i, name := range names {
+		if name != m.Features[i] {
+			return fmt.Errorf("%w: column %d is %q, model expects %q", ErrFeatureMismatch, i, name, m.Features[i])
+		}
+	}
+	return nil
+}
+
+// Probability returns P(pushup) for one feature vector in the model's column order.
+func (m *Model) Probability(x []float64) (float64, error) {
+	if len(x) != len(m.Coef) {
+		return 0, fmt.Errorf("%w: got %d values, want %d", ErrFeatureMismatch, len(x), len(m.Coef))
+	}
+
+	z := m.Intercept
+	for i, v := range x {
+		scale := m.ScalerScale[i]
+		if scale == 0 {
+			// StandardScaler stores 1 for constant columns; guard hand-edited exports too.
+			scale = 1
+		}
+		z += m.Coef[i] * (v - m.ScalerMean[i]) / scale
+	}
+
+	return sigmoid(z), nil
+}
+
+// PredictWindows returns one probability per window, in order.
+func (m *Model) PredictWindows(ws []windows.Window) ([]float64, error) {
+	probs := make([]float64, len(ws))
+	for i, w := range ws {
+		x, err := w.Vector(m.Features)
+		if err != nil {
+			return nil, err
+		}
+		if probs[i], err = m.Probability(x); err != nil {
+			return nil, err
+		}
+	}
+	return probs, nil
+}
+
+// sigmoid matches scipy's expit, staying finite for large |z|.
+func sigmoid(z float64) float64 {
+	if z >= 0 {
+		return 1 / (1 + math.Exp(-z))
+	}
+	e := math.Exp(z)
+	return e / (1 + e)
+}
@@ -0,0 +1,138 @@
+package classifier
+
+import (
+	"encoding/csv"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"PUSH-UP-ANALYZER/processing/windows"
+)
+
+var processedDir = filepath.Join("..", "..", "..", "data", "data_processing", "processed")
+
+func loadModel(t *testing.T) *Model {
+	t.Helper()
+	m, err := LoadFile(filepath.Join(processedDir, "model.json"))
+	if err != nil {
+		t.Fatalf("load model.json: %v", err)
+	}
+	return m
+}
+
+func readCSV(t *testing.T, name string) [][]string {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join(processedDir, name))
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return records
+}
+
+func TestModel_FeaturesMatch(t *testing.T) {
+	m := loadModel(t)
+
+	names, err := ReadFeatureList(filepath.Join(processedDir, "model_features.json"))
+	if err != nil {
+		t.Fatalf("read model_features.json: %v", err)
+	}
+	if err := m.CheckFeatures(names); err != nil {
+		t.Fatalf("model.json vs model_features.json: %v", err)
+	}
+	if err := m.CheckFeatures(windows.FeatureNames); err != nil {
+		t.Fatalf("model.json vs windows.FeatureNames: %v", err)
+	}
+}
+
+// TestPredict_MatchesPython scores every row of windows.csv and compares with
+// the probabilities rep_detector_hybrid.py exported to window_predictions.csv.
+func TestPredict_MatchesPython(t *testing.T) {
+	m := loadModel(t)
+
+	features := readCSV(t, "windows.csv")
+	preds := readCSV(t, "window_predictions.csv")
+	if len(features) != len(preds) {
+		t.Fatalf("windows.csv has %d rows, window_predictions.csv has %d", len(features), len(preds))
+	}
+
+	col := map[string]int{}
+	for i, name := range features[0] {
+		col[name] = i
+	}
+	probCol := -1
+	for i, name := range preds[0] {
+		if name == "pred_prob" {
+			probCol = i
+		}
+	}
+	if probCol < 0 {
+		t.Fatal("window_predictions.csv has no pred_prob column")
+	}
+
+	ws := make([]windows.Window, 0, len(features)-1)
+	for _, rec := range features[1:] {
+		w := windows.Window{Stats: map[string]float64{}}
+		for _, name := range m.Features {
+			v, err := strconv.ParseFloat(rec[col[name]], 64)
+			if err != nil {
+				t.Fatalf("parse %s: %v", name, err)
+			}
+			w.Stats[name] = v
+		}
+		ws = append(ws, w)
+	}
+
+	probs, err := m.PredictWindows(ws)
+	if err != nil {
+		t.Fatalf("predict: %v", err)
+	}
+
+	for i, p := range probs {
+		rec := preds[i+1]
+		if rec[0] != features[i+1][0] || rec[2] != features[i+1][col["window_start_s"]] {
+			t.Fatalf("row %d: prediction file is not aligned with windows.csv", i+1)
+		}
+
+		want, err := strconv.ParseFloat(rec[probCol], 64)
+		if err != nil {
+			t.Fatalf("parse pred_prob: %v", err)
+		}
+		if math.Abs(p-want) > 1e-9 {
+			t.Fatalf("row %d (%s @ %ss): prob %v, want %v", i+1, rec[0], rec[2], p, want)
+		}
+	}
+}
+
+func TestLoad_Rejects(t *testing.T) {
+	cases := map[string]string{
+		"format":  `{"format":"random_forest","version":1}`,
+		"classes": `{"format":"` + Format + `","version":1,"classes":[1,2],"features":["a"],"scaler_mean":[0],"scaler_scale":[1],"coef":[1]}`,
+		"lengths": `{"format":"` + Format + `","version":1,"classes":[0,1],"features":["a","b"],"scaler_mean":[0],"scaler_scale":[1],"coef":[1]}`,
+	}
+	for name, body := range cases {
+		if _, err := Load(strings.NewReader(body)); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("%s: expected ErrUnsupportedModel, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckFeatures_Order(t *testing.T) {
+	m := &Model{Features: []string{"a", "b"}}
+	if err := m.CheckFeatures([]string{"b", "a"}); !errors.Is(err, ErrFeatureMismatch) {
+		t.Fatalf("expected ErrFeatureMismatch, got %v", err)
+	}
+	if err := m.CheckFeatures([]string{"a", "b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
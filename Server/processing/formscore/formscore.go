@@ -0,0 +1,166 @@
+// Package formscore rates pushup form from per-rep measurements.
+//
+// Each rep gets up to three component scores in [0, 1]:
+//
+//   - depth: how far the rep went relative to the user's calibrated depth
+//   - tempo: how close the rep's duration is to the session's median duration
+//   - lockout: whether the user came back up to the baseline afterwards
+//
+// Components without data (a device that doesn't report durations, a session
+// without a baseline) are left out rather than counted as zero, and the rep
+// score is the weighted mean of what remains.
+package formscore
+
+import (
+	"math"
+
+	"PUSH-UP-ANALYZER/processing/repdetect"
+)
+
+// Rep is what the scorer needs to know about one rep. Use NaN for unknown values.
+type Rep struct {
+	DepthMM   float64
+	DurationS float64
+	// TopTofMM is the highest distance reached after the rep, before the next one starts.
+	TopTofMM float64
+}
+
+// Calibration describes the user's range of motion.
+type Calibration struct {
+	// BaselineMM is the distance at the top of a pushup; NaN disables lockout scoring.
+	BaselineMM float64
+	// TargetDepthMM is a full rep for this user, usually from their history (see TargetDepth).
+	TargetDepthMM float64
+}
+
+// Params tunes the scorer.
+type Params struct {
+	DepthWeight   float64
+	TempoWeight   float64
+	LockoutWeight float64
+
+	// QualityDepthRatio is the fraction of TargetDepthMM a rep must reach to count as a quality rep.
+	QualityDepthRatio float64
+	// MinTargetDepthMM keeps users with only shallow history from calibrating down to half-reps.
+	MinTargetDepthMM float64
+	// LockoutToleranceMM is how far short of the baseline the top may be and still score 1.
+	// The score falls to 0 at twice this distance.
+	LockoutToleranceMM float64
+}
+
+// DefaultParams returns the weights the server uses.
+func DefaultParams() Params {
+	return Params{
+		DepthWeight:        0.5,
+		TempoWeight:        0.25,
+		LockoutWeight:      0.25,
+		QualityDepthRatio:  0.8,
+		MinTargetDepthMM:   150,
+		LockoutToleranceMM: 40,
+	}
+}
+
+// RepScore is the breakdown for one rep. Components that couldn't be scored are NaN.
+type RepScore struct {
+	Depth   float64
+	Tempo   float64
+	Lockout float64
+	Score   float64
+	Quality bool
+}
+
+// Result is a scored session.
+type Result struct {
+	Reps []RepScore
+	// Score is the mean rep score, or NaN for a session without reps.
+	Score       float64
+	QualityReps int
+}
+
+// TargetDepth calibrates a full rep from depths the user has reached before:
+// the 90th percentile, so a few unusually deep reps don't set the bar.
+func TargetDepth(history []float64, p Params) float64 {
+	depths := make([]float64, 0, len(history))
+	for _, d := range history {
+		if !math.IsNaN(d) && d > 0 {
+			depths = append(depths, d)
+		}
+	}
+	if len(depths) == 0 {
+		return p.MinTargetDepthMM
+	}
+	return math.Max(p.MinTargetDepthMM, repdetect.Quantile(depths, 0.9))
+}
+
+// Score rates every rep of a session.
+func Score(reps []Rep, cal Calibration, p Params) Result {
+	res := Result{Reps: make([]RepScore, len(reps)), Score: math.NaN()}
+	if len(reps) == 0 {
+		return res
+	}
+
+	target := math.Max(cal.TargetDepthMM, p.MinTargetDepthMM)
+
+	durations := make([]float64, 0, len(reps))
+	for _, r := range reps {
+		if !math.IsNaN(r.DurationS) && r.DurationS > 0 {
+			durations = append(durations, r.DurationS)
+		}
+	}
+	medianDuration := math.NaN()
+	// Tempo consistency needs something to compare against.
+	if len(durations) >= 2 {
+		medianDuration = repdetect.Quantile(durations, 0.5)
+	}
+
+	total := 0.0
+	for i, r := range reps {
+		s := RepScore{Depth: math.NaN(), Tempo: math.NaN(), Lockout: math.NaN()}
+
+		if !math.IsNaN(r.DepthMM) {
+			s.Depth = clamp01(r.DepthMM / target)
+			s.Quality = r.DepthMM >= p.QualityDepthRatio*target
+		}
+		if !math.IsNaN(medianDuration) && !math.IsNaN(r.DurationS) && r.DurationS > 0 {
+			s.Tempo = clamp01(1 - math.Abs(r.DurationS-medianDuration)/medianDuration)
+		}
+		if !math.IsNaN(cal.BaselineMM) && !math.IsNaN(r.TopTofMM) && p.LockoutToleranceMM > 0 {
+			short := cal.BaselineMM - r.TopTofMM
+			s.Lockout = clamp01(2 - short/p.LockoutToleranceMM)
+		}
+
+		s.Score = weightedMean(
+			[]float64{s.Depth, s.Tempo, s.Lockout},
+			[]float64{p.DepthWeight, p.TempoWeight, p.LockoutWeight},
+		)
+
+		if s.Quality {
+			res.QualityReps++
+		}
+		total += s.Score
+		res.Reps[i] = s
+	}
+
+	res.Score = total / float64(len(reps))
+	return res
+}
+
+// weightedMean ignores NaN values and their weights. All NaN scores 0.
+func weightedMean(values, weights []float64) float64 {
+	sum, weight := 0.0, 0.0
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v * weights[i]
+		weight += weights[i]
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,54 @@
+package formscore
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	nan := math.NaN()
+	reps := []Rep{
+		{DepthMM: 250, DurationS: 1.0, TopTofMM: 400},
+		{DepthMM: 240, DurationS: 1.0, TopTofMM: 395},
+		{DepthMM: 100, DurationS: 2.0, TopTofMM: 300}, // half rep, slow, no lockout
+		{DepthMM: 250, DurationS: nan, TopTofMM: nan}, // device without timing
+	}
+
+	res := Score(reps, Calibration{BaselineMM: 400, TargetDepthMM: 250}, DefaultParams())
+
+	if res.QualityReps != 3 {
+		t.Fatalf("expected 3 quality reps, got %d", res.QualityReps)
+	}
+	if res.Reps[0].Score != 1 {
+		t.Fatalf("expected a perfect first rep, got %+v", res.Reps[0])
+	}
+	if r := res.Reps[2]; r.Quality || r.Lockout != 0 || r.Tempo != 0 || r.Score >= 0.5 {
+		t.Fatalf("expected the half rep to score poorly, got %+v", r)
+	}
+	if r := res.Reps[3]; !math.IsNaN(r.Tempo) || !math.IsNaN(r.Lockout) || r.Score != 1 {
+		t.Fatalf("expected missing components to be skipped, got %+v", r)
+	}
+	if res.Score <= 0.5 || res.Score >= 1 {
+		t.Fatalf("unexpected session score %v", res.Score)
+	}
+}
+
+func TestScore_Empty(t *testing.T) {
+	if res := Score(nil, Calibration{BaselineMM: 400, TargetDepthMM: 250}, DefaultParams()); !math.IsNaN(res.Score) {
+		t.Fatalf("expected NaN session score, got %v", res.Score)
+	}
+}
+
+func TestTargetDepth(t *testing.T) {
+	p := DefaultParams()
+
+	if got := TargetDepth(nil, p); got != p.MinTargetDepthMM {
+		t.Fatalf("no history: got %v", got)
+	}
+	if got := TargetDepth([]float64{90, 100, 110}, p); got != p.MinTargetDepthMM {
+		t.Fatalf("shallow history should not lower the bar, got %v", got)
+	}
+	if got := TargetDepth([]float64{200, 220, 240, 260, 280, 300, 320, 340, 360, 380, 400}, p); got != 380 {
+		t.Fatalf("expected the 90th percentile, got %v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package prepare
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// hostTimeLayout is how plot_live.py writes host_ts (datetime.isoformat without a zone).
+const hostTimeLayout = "2006-01-02T15:04:05.999999999"
+
+// ReadSessionCSV reads a data/sessionN.csv file. Values that don't parse become NaN,
+// like pandas' to_numeric(errors="coerce"); rows without device_ts_s are dropped later.
+func ReadSessionCSV(r io.Reader) ([]RawSample, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("session CSV is empty")
+	}
+
+	idx, err := columnIndex(records[0], "host_ts", "device_ts_s", "tof_mm", "ax", "ay", "az", "gx", "gy", "gz")
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]RawSample, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		samples = append(samples, RawSample{
+			HostTime: parseHostTime(rec[idx["host_ts"]]),
+			DeviceS:  parseFloat(rec[idx["device_ts_s"]]),
+			TofMM:    parseFloat(rec[idx["tof_mm"]]),
+			AX:       parseFloat(rec[idx["ax"]]),
+			AY:       parseFloat(rec[idx["ay"]]),
+			AZ:       parseFloat(rec[idx["az"]]),
+			GX:       parseFloat(rec[idx["gx"]]),
+			GY:       parseFloat(rec[idx["gy"]]),
+			GZ:       parseFloat(rec[idx["gz"]]),
+		})
+	}
+	return samples, nil
+}
+
+// ReadEventsCSV reads a data/sessionN.events.csv file.
+func ReadEventsCSV(r io.Reader) ([]Event, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("events CSV is empty")
+	}
+
+	idx, err := columnIndex(records[0], "host_ts", "device_ts_ms", "event", "value", "state")
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		ms, err := strconv.ParseInt(rec[idx["device_ts_ms"]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("events row %d: invalid device_ts_ms", i+1)
+		}
+		events = append(events, Event{
+			HostTime: parseHostTime(rec[idx["host_ts"]]),
+			DeviceMS: ms,
+			Name:     rec[idx["event"]],
+			Value:    parseFloat(rec[idx["value"]]),
+			State:    rec[idx["state"]],
+		})
+	}
+	return events, nil
+}
+
+func columnIndex(header []string, want ...string) (map[string]int, error) {
+	idx := make(map[string]int, len(header))
+	for i, col := range header {
+		idx[col] = i
+	}
+	for _, col := range want {
+		if _, ok := idx[col]; !ok {
+			return nil, fmt.Errorf("missing column %q", col)
+		}
+	}
+	return idx, nil
+}
+
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+func parseHostTime(s string) time.Time {
+	t, err := time.Parse(hostTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
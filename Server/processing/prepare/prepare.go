@@ -0,0 +1,364 @@
+// Package prepare is the Go port of data/data_processing/prepare_samples.py.
+//
+// It trims a session to the recording, splits it where the device clock jumps
+// by more than MaxGapS, resamples each segment to a fixed rate and adds the
+// magnitude and diff features the windowing step expects.
+package prepare
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"PUSH-UP-ANALYZER/processing/repdetect"
+)
+
+// RawSample is one row of a session CSV (host_ts,device_ts_s,tof_mm,ax,ay,az,gx,gy,gz).
+// HostTime is zero when the sample didn't pass through a host logger.
+// Unparseable sensor values are NaN and get interpolated like pandas does.
+type RawSample struct {
+	HostTime time.Time
+	DeviceS  float64
+	TofMM    float64
+	AX       float64
+	AY       float64
+	AZ       float64
+	GX       float64
+	GY       float64
+	GZ       float64
+}
+
+// Event is one row of a session events CSV. Value is NaN when the event has none.
+type Event struct {
+	HostTime time.Time
+	DeviceMS int64
+	Name     string
+	Value    float64
+	State    string
+}
+
+// Sample is one prepared row, matching the columns of samples.csv.
+type Sample struct {
+	TimeS    float64
+	HostTime time.Time
+	DeviceS  float64
+	TofMM    float64
+	AX       float64
+	AY       float64
+	AZ       float64
+	GX       float64
+	GY       float64
+	GZ       float64
+
+	AMag     float64
+	GMag     float64
+	TofDiff  float64
+	AMagDiff float64
+	GMagDiff float64
+}
+
+// Segment is a run of samples without a gap longer than Options.MaxGapS.
+type Segment struct {
+	ID      int
+	Samples []Sample
+
+	// BaselineMM is BASELINE_LOCKED_MM when the firmware sent one,
+	// otherwise the 90th percentile of the segment's tof_mm.
+	BaselineMM     float64
+	BaselineSource string // "baseline_locked" or "p90"
+}
+
+const (
+	BaselineLocked = "baseline_locked"
+	BaselineP90    = "p90"
+)
+
+// Options mirrors the command-line flags of prepare_samples.py.
+type Options struct {
+	// SampleHz is the resample rate. Zero disables resampling.
+	SampleHz float64
+	// MaxGapS splits segments on device timestamp gaps larger than this. Zero disables splitting.
+	MaxGapS float64
+}
+
+// DefaultOptions returns the defaults used to produce samples.csv.
+func DefaultOptions() Options {
+	return Options{SampleHz: 10, MaxGapS: 1.0}
+}
+
+// Prepare turns one session's raw samples and events into resampled segments.
+func Prepare(raw []RawSample, events []Event, opt Options) []Segment {
+	rows := trimToRecording(raw, events)
+	rows = sortAndDedupe(rows)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// Split on device clock gaps. t_s stays relative to the first sample of the session.
+	var segments []Segment
+	t0 := rows[0].DeviceS
+	start := 0
+	for i := 1; i <= len(rows); i++ {
+		if i < len(rows) && !(opt.MaxGapS > 0 && rows[i].DeviceS-rows[i-1].DeviceS > opt.MaxGapS) {
+			continue
+		}
+
+		seg := Segment{ID: len(segments)}
+		if opt.SampleHz > 0 {
+			seg.Samples = resample(rows[start:i], t0, opt.SampleHz)
+		} else {
+			seg.Samples = make([]Sample, 0, i-start)
+			for _, r := range rows[start:i] {
+				seg.Samples = append(seg.Samples, fromRaw(r, r.DeviceS-t0))
+			}
+		}
+		addFeatures(seg.Samples)
+		segments = append(segments, seg)
+		start = i
+	}
+
+	baseline, locked := LockedBaseline(events)
+	for i := range segments {
+		if locked {
+			segments[i].BaselineMM = baseline
+			segments[i].BaselineSource = BaselineLocked
+			continue
+		}
+		tof := make([]float64, len(segments[i].Samples))
+		for j, s := range segments[i].Samples {
+			tof[j] = s.TofMM
+		}
+		segments[i].BaselineMM = repdetect.Quantile(tof, 0.9)
+		segments[i].BaselineSource = BaselineP90
+	}
+
+	return segments
+}
+
+// LockedBaseline returns the last BASELINE_LOCKED_MM value, if any.
+func LockedBaseline(events []Event) (float64, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Name == "BASELINE_LOCKED_MM" && !math.IsNaN(events[i].Value) {
+			return events[i].Value, true
+		}
+	}
+	return 0, false
+}
+
+// trimToRecording drops samples logged before the first RECORDING_START.
+// Host timestamps are compared when both sides have them, like the Python script;
+// otherwise the device clock is used.
+func trimToRecording(raw []RawSample, events []Event) []RawSample {
+	var start *Event
+	for i := range events {
+		if events[i].Name == "RECORDING_START" {
+			start = &events[i]
+			break
+		}
+	}
+	if start == nil {
+		return raw
+	}
+
+	out := make([]RawSample, 0, len(raw))
+	for _, r := range raw {
+		if !start.HostTime.IsZero() && !r.HostTime.IsZero() {
+			if r.HostTime.Before(start.HostTime) {
+				continue
+			}
+		} else if r.DeviceS*1000 < float64(start.DeviceMS) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// sortAndDedupe drops rows without a device timestamp, sorts by it and keeps the first of any repeats.
+func sortAndDedupe(raw []RawSample) []RawSample {
+	rows := make([]RawSample, 0, len(raw))
+	for _, r := range raw {
+		if !math.IsNaN(r.DeviceS) {
+			rows = append(rows, r)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].DeviceS < rows[j].DeviceS })
+
+	out := rows[:0]
+	for i, r := range rows {
+		if i > 0 && r.DeviceS == out[len(out)-1].DeviceS {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// resample reproduces _resample_segment: the new grid is merged with the original
+// timestamps and gaps are filled by linear interpolation over row position, which is
+// what pandas' interpolate(method="linear") does regardless of the index values.
+func resample(rows []RawSample, t0, hz float64) []Sample {
+	tMin := rows[0].DeviceS - t0
+	tMax := rows[len(rows)-1].DeviceS - t0
+	if tMax <= tMin {
+		out := make([]Sample, len(rows))
+		for i, r := range rows {
+			out[i] = fromRaw(r, r.DeviceS-t0)
+		}
+		return out
+	}
+
+	step := 1.0 / hz
+	n := int(math.Ceil((tMax + 1e-9 - tMin) / step))
+	grid := make([]float64, n)
+	for i := range grid {
+		grid[i] = tMin + float64(i)*step
+	}
+
+	// Union of original and grid times, sorted, exact duplicates merged.
+	type point struct {
+		t      float64
+		raw    *RawSample
+		onGrid bool
+	}
+	points := make([]point, 0, len(rows)+n)
+	for i := range rows {
+		points = append(points, point{t: rows[i].DeviceS - t0, raw: &rows[i]})
+	}
+	for _, t := range grid {
+		points = append(points, point{t: t, onGrid: true})
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].t < points[j].t })
+
+	merged := points[:0]
+	for _, p := range points {
+		if len(merged) > 0 && merged[len(merged)-1].t == p.t {
+			last := &merged[len(merged)-1]
+			last.onGrid = last.onGrid || p.onGrid
+			if last.raw == nil {
+				last.raw = p.raw
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+
+	// Interpolate each numeric column over the merged positions.
+	const numCols = 8
+	cols := make([][]float64, numCols)
+	for c := range cols {
+		cols[c] = make([]float64, len(merged))
+		for i, p := range merged {
+			if p.raw == nil {
+				cols[c][i] = math.NaN()
+				continue
+			}
+			cols[c][i] = rawColumn(*p.raw, c)
+		}
+		interpolateByPosition(cols[c])
+	}
+
+	hostStart := rows[0].HostTime
+	out := make([]Sample, 0, n)
+	for i, p := range merged {
+		if !p.onGrid {
+			continue
+		}
+		s := Sample{
+			TimeS:   p.t,
+			DeviceS: cols[0][i],
+			TofMM:   cols[1][i],
+			AX:      cols[2][i],
+			AY:      cols[3][i],
+			AZ:      cols[4][i],
+			GX:      cols[5][i],
+			GY:      cols[6][i],
+			GZ:      cols[7][i],
+		}
+		if !hostStart.IsZero() {
+			s.HostTime = hostStart.Add(time.Duration(math.Round((p.t - tMin) * 1e9)))
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func rawColumn(r RawSample, c int) float64 {
+	switch c {
+	case 0:
+		return r.DeviceS
+	case 1:
+		return r.TofMM
+	case 2:
+		return r.AX
+	case 3:
+		return r.AY
+	case 4:
+		return r.AZ
+	case 5:
+		return r.GX
+	case 6:
+		return r.GY
+	default:
+		return r.GZ
+	}
+}
+
+// interpolateByPosition fills NaNs linearly between the nearest valid neighbors,
+// treating rows as equally spaced. Leading and trailing NaNs take the nearest valid value.
+func interpolateByPosition(v []float64) {
+	prev := -1
+	for i := 0; i <= len(v); i++ {
+		if i < len(v) && math.IsNaN(v[i]) {
+			continue
+		}
+		switch {
+		case prev == -1 && i < len(v):
+			for k := 0; k < i; k++ {
+				v[k] = v[i]
+			}
+		case prev >= 0 && i == len(v):
+			for k := prev + 1; k < i; k++ {
+				v[k] = v[prev]
+			}
+		case prev >= 0:
+			span := float64(i - prev)
+			for k := prev + 1; k < i; k++ {
+				v[k] = v[prev] + (v[i]-v[prev])*float64(k-prev)/span
+			}
+		}
+		prev = i
+	}
+}
+
+func fromRaw(r RawSample, t float64) Sample {
+	return Sample{
+		TimeS:    t,
+		HostTime: r.HostTime,
+		DeviceS:  r.DeviceS,
+		TofMM:    r.TofMM,
+		AX:       r.AX,
+		AY:       r.AY,
+		AZ:       r.AZ,
+		GX:       r.GX,
+		GY:       r.GY,
+		GZ:       r.GZ,
+	}
+}
+
+// addFeatures is _add_features for one segment: vector magnitudes and first differences.
+func addFeatures(samples []Sample) {
+	for i := range samples {
+		s := &samples[i]
+		s.AMag = math.Sqrt(s.AX*s.AX + s.AY*s.AY + s.AZ*s.AZ)
+		s.GMag = math.Sqrt(s.GX*s.GX + s.GY*s.GY + s.GZ*s.GZ)
+		if i == 0 {
+			continue
+		}
+		prev := samples[i-1]
+		s.TofDiff = s.TofMM - prev.TofMM
+		s.AMagDiff = s.AMag - prev.AMag
+		s.GMagDiff = s.GMag - prev.GMag
+	}
+}
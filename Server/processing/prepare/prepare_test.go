@@ -0,0 +1,156 @@
+package prepare
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+var dataDir = filepath.Join("..", "..", "..", "data")
+
+func loadSession(t *testing.T, id string) ([]RawSample, []Event) {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join(dataDir, id+".csv"))
+	if err != nil {
+		t.Fatalf("open %s: %v", id, err)
+	}
+	defer f.Close()
+
+	raw, err := ReadSessionCSV(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", id, err)
+	}
+
+	ef, err := os.Open(filepath.Join(dataDir, id+".events.csv"))
+	if os.IsNotExist(err) {
+		return raw, nil
+	}
+	if err != nil {
+		t.Fatalf("open %s events: %v", id, err)
+	}
+	defer ef.Close()
+
+	events, err := ReadEventsCSV(ef)
+	if err != nil {
+		t.Fatalf("read %s events: %v", id, err)
+	}
+	return raw, events
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+// TestPrepare_MatchesSamplesCSV checks every prepared row and column against
+// the committed output of prepare_samples.py.
+func TestPrepare_MatchesSamplesCSV(t *testing.T) {
+	f, err := os.Open(filepath.Join(dataDir, "data_processing", "processed", "samples.csv"))
+	if err != nil {
+		t.Fatalf("open samples.csv: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read samples.csv: %v", err)
+	}
+	col := map[string]int{}
+	for i, name := range records[0] {
+		col[name] = i
+	}
+
+	bySession := map[string][][]string{}
+	for _, rec := range records[1:] {
+		bySession[rec[col["session_id"]]] = append(bySession[rec[col["session_id"]]], rec)
+	}
+
+	for _, id := range []string{"session1", "session2", "session3", "session4"} {
+		raw, events := loadSession(t, id)
+		segments := Prepare(raw, events, DefaultOptions())
+
+		var got []struct {
+			seg int
+			s   Sample
+		}
+		for _, seg := range segments {
+			for _, s := range seg.Samples {
+				got = append(got, struct {
+					seg int
+					s   Sample
+				}{seg.ID, s})
+			}
+		}
+
+		want := bySession[id]
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d rows, want %d", id, len(got), len(want))
+		}
+
+		for i, rec := range want {
+			g := got[i]
+			if strconv.Itoa(g.seg) != rec[col["segment_id"]] {
+				t.Fatalf("%s row %d: segment %d, want %s", id, i, g.seg, rec[col["segment_id"]])
+			}
+			if host := g.s.HostTime.Format("2006-01-02T15:04:05.000000"); host != rec[col["host_ts"]] {
+				t.Fatalf("%s row %d: host_ts %s, want %s", id, i, host, rec[col["host_ts"]])
+			}
+
+			fields := map[string]float64{
+				"t_s":         g.s.TimeS,
+				"device_ts_s": g.s.DeviceS,
+				"tof_mm":      g.s.TofMM,
+				"ax":          g.s.AX,
+				"ay":          g.s.AY,
+				"az":          g.s.AZ,
+				"gx":          g.s.GX,
+				"gy":          g.s.GY,
+				"gz":          g.s.GZ,
+				"a_mag":       g.s.AMag,
+				"g_mag":       g.s.GMag,
+				"tof_mm_diff": g.s.TofDiff,
+				"a_mag_diff":  g.s.AMagDiff,
+				"g_mag_diff":  g.s.GMagDiff,
+			}
+			for name, v := range fields {
+				w, err := strconv.ParseFloat(rec[col[name]], 64)
+				if err != nil {
+					t.Fatalf("%s row %d: parse %s: %v", id, i, name, err)
+				}
+				if !approxEqual(v, w) {
+					t.Fatalf("%s row %d: %s = %v, want %v", id, i, name, v, w)
+				}
+			}
+		}
+	}
+}
+
+func TestPrepare_BaselineFallback(t *testing.T) {
+	raw, events := loadSession(t, "session2")
+	segments := Prepare(raw, events, DefaultOptions())
+	if segments[0].BaselineSource != BaselineLocked || segments[0].BaselineMM != 427.08 {
+		t.Fatalf("session2: expected locked baseline, got %v (%s)", segments[0].BaselineMM, segments[0].BaselineSource)
+	}
+
+	raw, events = loadSession(t, "session1")
+	segments = Prepare(raw, events, DefaultOptions())
+	if len(segments) != 2 {
+		t.Fatalf("session1: expected a gap split into 2 segments, got %d", len(segments))
+	}
+	if segments[0].BaselineSource != BaselineP90 || segments[0].BaselineMM != 441 {
+		t.Fatalf("session1: expected p90 baseline 441, got %v (%s)", segments[0].BaselineMM, segments[0].BaselineSource)
+	}
+}
+
+func TestInterpolateByPosition(t *testing.T) {
+	v := []float64{math.NaN(), 1, math.NaN(), math.NaN(), 4, math.NaN()}
+	interpolateByPosition(v)
+	want := []float64{1, 1, 2, 3, 4, 4}
+	if fmt.Sprint(v) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", v, want)
+	}
+}
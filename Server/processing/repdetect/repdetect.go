@@ -0,0 +1,280 @@
+// Package repdetect is the Go port of data/data_processing/rep_detector_hybrid.py.
+//
+// A rep is a local minimum of the smoothed tof_mm signal that sits at least
+// MinDepthMM below the baseline, at least MinIntervalS after the previous rep,
+// and inside a window the classifier marked as a pushup.
+package repdetect
+
+import (
+	"math"
+	"sort"
+)
+
+// Sample is one prepared sample: seconds since the segment started and the ToF distance.
+type Sample struct {
+	TimeS float64
+	TofMM float64
+}
+
+// Window is a classifier window with its pushup probability.
+type Window struct {
+	StartS float64
+	EndS   float64
+	Prob   float64
+}
+
+// Event is one detected rep, matching the t_s, tof_mm and depth_mm columns of rep_events_hybrid.csv.
+type Event struct {
+	TimeS   float64 `json:"tS"`
+	TofMM   float64 `json:"tofMm"`
+	DepthMM float64 `json:"depthMm"`
+}
+
+// Params mirrors the command-line flags of rep_detector_hybrid.py.
+type Params struct {
+	// Threshold is the minimum window probability that counts as a pushup.
+	Threshold float64
+	// MinDepthMM is how far below baseline a minimum must be.
+	MinDepthMM float64
+	// MinIntervalS is the minimum time between two reps.
+	MinIntervalS float64
+	// SmoothWindowS is the width of the centered moving average applied to tof_mm.
+	SmoothWindowS float64
+}
+
+// DefaultParams returns the defaults used to produce rep_events_hybrid.csv.
+func DefaultParams() Params {
+	return Params{
+		Threshold:     0.5,
+		MinDepthMM:    80,
+		MinIntervalS:  0.6,
+		SmoothWindowS: 0.3,
+	}
+}
+
+// Detect finds reps in one segment. Samples must be sorted by time.
+//
+// windows gates detection to classifier-positive regions. A nil slice means no
+// classifier is available and every sample is considered active; an empty,
+// non-nil slice means the classifier saw no pushups and no reps are returned.
+func Detect(samples []Sample, windows []Window, baselineMM float64, p Params) []Event {
+	var active []bool
+	if windows != nil {
+		active = ActiveMask(samples, windows, p.Threshold)
+	}
+	return FindMinima(samples, active, baselineMM, p)
+}
+
+// ActiveMask marks samples that fall in [StartS, EndS) of any window with Prob >= threshold.
+func ActiveMask(samples []Sample, windows []Window, threshold float64) []bool {
+	mask := make([]bool, len(samples))
+	for _, w := range windows {
+		if w.Prob < threshold {
+			continue
+		}
+		for i, s := range samples {
+			if s.TimeS >= w.StartS && s.TimeS < w.EndS {
+				mask[i] = true
+			}
+		}
+	}
+	return mask
+}
+
+// FindMinima is _find_local_minima. A nil active mask treats every sample as active.
+func FindMinima(samples []Sample, active []bool, baselineMM float64, p Params) []Event {
+	smooth := smoothTof(samples, p)
+
+	events := make([]Event, 0)
+	lastRep := -1e9
+
+	for i := 1; i < len(smooth)-1; i++ {
+		if active != nil && !active[i] {
+			continue
+		}
+
+		left, center, right := smooth[i-1], smooth[i], smooth[i+1]
+		if center > left || center > right {
+			continue
+		}
+		if center == left && center == right {
+			continue
+		}
+
+		depth := baselineMM - center
+		if depth < p.MinDepthMM {
+			continue
+		}
+
+		t := samples[i].TimeS
+		if t-lastRep < p.MinIntervalS {
+			continue
+		}
+
+		events = append(events, Event{TimeS: t, TofMM: center, DepthMM: depth})
+		lastRep = t
+	}
+
+	return events
+}
+
+// Durations estimates how long each rep took, in seconds. Events must come from
+// Detect on the same samples. The rep runs from where the smoothed distance
+// drops MinDepthMM/2 below the baseline until it climbs back above that line,
+// never reaching past the neighbouring reps' bottoms. The Python detector only
+// reports the bottom, so this has no golden counterpart.
+func Durations(samples []Sample, events []Event, baselineMM float64, p Params) []float64 {
+	smooth := smoothTof(samples, p)
+	level := baselineMM - p.MinDepthMM/2
+
+	bottoms := make([]int, len(events))
+	for k, ev := range events {
+		bottoms[k] = sort.Search(len(samples), func(i int) bool { return samples[i].TimeS >= ev.TimeS })
+	}
+
+	out := make([]float64, len(events))
+	for k, b := range bottoms {
+		if b >= len(samples) {
+			continue
+		}
+
+		lo, hi := 0, len(samples)-1
+		if k > 0 {
+			lo = bottoms[k-1]
+		}
+		if k+1 < len(bottoms) {
+			hi = min(bottoms[k+1], hi)
+		}
+
+		start := b
+		for start > lo && smooth[start] < level {
+			start--
+		}
+		end := b
+		for end < hi && smooth[end] < level {
+			end++
+		}
+
+		out[k] = samples[end].TimeS - samples[start].TimeS
+	}
+	return out
+}
+
+// Tops returns, for each rep, the highest smoothed distance reached between its
+// bottom and the next rep's bottom (or the end of the segment). Form scoring
+// compares it with the baseline to tell whether the user locked out.
+func Tops(samples []Sample, events []Event, p Params) []float64 {
+	smooth := smoothTof(samples, p)
+
+	out := make([]float64, len(events))
+	for k, ev := range events {
+		b := sort.Search(len(samples), func(i int) bool { return samples[i].TimeS >= ev.TimeS })
+		end := len(samples)
+		if k+1 < len(events) {
+			end = sort.Search(len(samples), func(i int) bool { return samples[i].TimeS >= events[k+1].TimeS })
+		}
+
+		out[k] = math.NaN()
+		for i := b; i < end; i++ {
+			if math.IsNaN(out[k]) || smooth[i] > out[k] {
+				out[k] = smooth[i]
+			}
+		}
+	}
+	return out
+}
+
+// smoothTof applies the detector's moving average: SmoothWindowS wide, at least
+// three samples and always an odd count.
+func smoothTof(samples []Sample, p Params) []float64 {
+	hz := EstimateHz(samples)
+	window := int(math.Max(3, math.RoundToEven(p.SmoothWindowS*hz)))
+	if window%2 == 0 {
+		window++
+	}
+
+	tof := make([]float64, len(samples))
+	for i, s := range samples {
+		tof[i] = s.TofMM
+	}
+	return Smooth(tof, window)
+}
+
+// EstimateHz is the inverse of the median positive time step, defaulting to 10Hz.
+func EstimateHz(samples []Sample) float64 {
+	if len(samples) < 2 {
+		return 10
+	}
+
+	dts := make([]float64, 0, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		if dt := samples[i].TimeS - samples[i-1].TimeS; dt > 0 {
+			dts = append(dts, dt)
+		}
+	}
+	if len(dts) == 0 {
+		return 10
+	}
+
+	sort.Float64s(dts)
+	var median float64
+	if n := len(dts); n%2 == 1 {
+		median = dts[n/2]
+	} else {
+		median = (dts[n/2-1] + dts[n/2]) / 2
+	}
+	if median <= 0 {
+		return 10
+	}
+	return 1 / median
+}
+
+// Smooth is a centered rolling mean that shrinks at the edges (pandas min_periods=1).
+func Smooth(values []float64, window int) []float64 {
+	if window <= 1 {
+		return append([]float64(nil), values...)
+	}
+
+	// pandas centers even windows one sample to the right; callers pass odd widths.
+	before := (window - 1) / 2
+	after := window / 2
+
+	out := make([]float64, len(values))
+	for i := range values {
+		lo := max(0, i-before)
+		hi := min(len(values), i+after+1)
+
+		sum := 0.0
+		for _, v := range values[lo:hi] {
+			sum += v
+		}
+		out[i] = sum / float64(hi-lo)
+	}
+	return out
+}
+
+// PercentileBaseline is the 90th percentile of tof_mm, which the hybrid detector uses as baseline.
+func PercentileBaseline(samples []Sample) float64 {
+	tof := make([]float64, len(samples))
+	for i, s := range samples {
+		tof[i] = s.TofMM
+	}
+	return Quantile(tof, 0.9)
+}
+
+// Quantile matches pandas' default linear interpolation.
+func Quantile(values []float64, q float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	pos := q * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(pos-float64(lo))
+}
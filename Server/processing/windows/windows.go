@@ -0,0 +1,229 @@
+// Package windows is the Go port of data/data_processing/build_windows.py.
+//
+// It slides a fixed-length window over each prepared segment and summarizes
+// every sensor channel with _mean/_std/_min/_max/_range statistics. The
+// feature names and their order are the contract with the trained model
+// (processed/model_features.json).
+package windows
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"PUSH-UP-ANALYZER/processing/prepare"
+)
+
+// Channels are the per-sample columns summarized in each window, in build_windows.py order.
+var Channels = []string{
+	"tof_mm",
+	"ax",
+	"ay",
+	"az",
+	"gx",
+	"gy",
+	"gz",
+	"a_mag",
+	"g_mag",
+	"tof_mm_diff",
+	"a_mag_diff",
+	"g_mag_diff",
+}
+
+var statSuffixes = []string{"_mean", "_std", "_min", "_max", "_range"}
+
+// FeatureNames is every channel/statistic pair sorted by name, which is how
+// train_model.py ordered the columns it wrote to model_features.json.
+var FeatureNames = func() []string {
+	names := make([]string, 0, len(Channels)*len(statSuffixes))
+	for _, ch := range Channels {
+		for _, suffix := range statSuffixes {
+			names = append(names, ch+suffix)
+		}
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// Options mirrors the command-line flags of build_windows.py.
+type Options struct {
+	WindowS          float64
+	StepS            float64
+	MinSamples       int
+	LabelThresholdMM float64
+}
+
+// DefaultOptions returns the defaults used to produce windows.csv.
+func DefaultOptions() Options {
+	return Options{
+		WindowS:          2.0,
+		StepS:            0.5,
+		MinSamples:       10,
+		LabelThresholdMM: 80,
+	}
+}
+
+// Window is one row of windows.csv.
+type Window struct {
+	SegmentID      int
+	StartS         float64
+	EndS           float64
+	BaselineMM     float64
+	BaselineSource string
+	DepthMM        float64
+	LabelPushup    bool
+
+	// Stats holds every feature keyed by name (e.g. "tof_mm_mean").
+	Stats map[string]float64
+}
+
+// Vector returns the window's features in the given order, usually FeatureNames
+// or the list loaded from model_features.json.
+func (w Window) Vector(names []string) ([]float64, error) {
+	out := make([]float64, len(names))
+	for i, name := range names {
+		v, ok := w.Stats[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown feature %q", name)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// Build windows every segment. Segments shorter than one window produce nothing.
+func Build(segments []prepare.Segment, opt Options) []Window {
+	out := make([]Window, 0)
+	for _, seg := range segments {
+		out = append(out, buildSegment(seg, opt)...)
+	}
+	return out
+}
+
+func buildSegment(seg prepare.Segment, opt Options) []Window {
+	samples := append([]prepare.Sample(nil), seg.Samples...)
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].TimeS < samples[j].TimeS })
+
+	tMin := samples[0].TimeS
+	tMax := samples[len(samples)-1].TimeS
+	if tMax-tMin < opt.WindowS {
+		return nil
+	}
+
+	var out []Window
+	// start accumulates like the Python loop so window edges match bit for bit.
+	for start := tMin; start+opt.WindowS <= tMax+1e-9; start += opt.StepS {
+		end := start + opt.WindowS
+
+		var in []prepare.Sample
+		for _, s := range samples {
+			if s.TimeS >= start && s.TimeS < end {
+				in = append(in, s)
+			}
+		}
+		if len(in) < opt.MinSamples {
+			continue
+		}
+
+		stats := windowStats(in)
+		depth := seg.BaselineMM - stats["tof_mm_min"]
+		out = append(out, Window{
+			SegmentID:      seg.ID,
+			StartS:         start,
+			EndS:           end,
+			BaselineMM:     seg.BaselineMM,
+			BaselineSource: seg.BaselineSource,
+			DepthMM:        depth,
+			LabelPushup:    depth >= opt.LabelThresholdMM,
+			Stats:          stats,
+		})
+	}
+	return out
+}
+
+func channelValue(s prepare.Sample, ch string) float64 {
+	switch ch {
+	case "tof_mm":
+		return s.TofMM
+	case "ax":
+		return s.AX
+	case "ay":
+		return s.AY
+	case "az":
+		return s.AZ
+	case "gx":
+		return s.GX
+	case "gy":
+		return s.GY
+	case "gz":
+		return s.GZ
+	case "a_mag":
+		return s.AMag
+	case "g_mag":
+		return s.GMag
+	case "tof_mm_diff":
+		return s.TofDiff
+	case "a_mag_diff":
+		return s.AMagDiff
+	case "g_mag_diff":
+		return s.GMagDiff
+	}
+	panic("windows: unknown channel " + ch)
+}
+
+// windowStats is _window_stats: population std (ddof=0), like pandas std(ddof=0).
+func windowStats(in []prepare.Sample) map[string]float64 {
+	stats := make(map[string]float64, len(FeatureNames))
+	values := make([]float64, len(in))
+
+	for _, ch := range Channels {
+		for i, s := range in {
+			values[i] = channelValue(s, ch)
+		}
+
+		mean := sum(values) / float64(len(values))
+		lo, hi := values[0], values[0]
+		sq := make([]float64, len(values))
+		for i, v := range values {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+			sq[i] = (v - mean) * (v - mean)
+		}
+
+		stats[ch+"_mean"] = mean
+		stats[ch+"_std"] = math.Sqrt(sum(sq) / float64(len(values)))
+		stats[ch+"_min"] = lo
+		stats[ch+"_max"] = hi
+		stats[ch+"_range"] = hi - lo
+	}
+	return stats
+}
+
+// sum follows numpy's pairwise summation for short arrays (eight running
+// partial sums, then the tail), which keeps means within a few ulps of pandas.
+func sum(values []float64) float64 {
+	if len(values) < 8 {
+		total := 0.0
+		for _, v := range values {
+			total += v
+		}
+		return total
+	}
+
+	var r [8]float64
+	copy(r[:], values[:8])
+	i := 8
+	for ; i+8 <= len(values); i += 8 {
+		for j := range r {
+			r[j] += values[i+j]
+		}
+	}
+	total := ((r[0] + r[1]) + (r[2] + r[3])) + ((r[4] + r[5]) + (r[6] + r[7]))
+	for ; i < len(values); i++ {
+		total += values[i]
+	}
+	return total
+}
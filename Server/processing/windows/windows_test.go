@@ -0,0 +1,159 @@
+package windows
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"PUSH-UP-ANALYZER/processing/prepare"
+)
+
+var (
+	dataDir      = filepath.Join("..", "..", "..", "data")
+	processedDir = filepath.Join(dataDir, "data_processing", "processed")
+)
+
+func TestFeatureNames_MatchModelFeatures(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join(processedDir, "model_features.json"))
+	if err != nil {
+		t.Fatalf("read model_features.json: %v", err)
+	}
+
+	var want []string
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatalf("parse model_features.json: %v", err)
+	}
+
+	if !reflect.DeepEqual(FeatureNames, want) {
+		t.Fatalf("feature order differs from model_features.json:\n got %v\nwant %v", FeatureNames, want)
+	}
+}
+
+func prepareSession(t *testing.T, id string) []prepare.Segment {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join(dataDir, id+".csv"))
+	if err != nil {
+		t.Fatalf("open %s: %v", id, err)
+	}
+	defer f.Close()
+
+	raw, err := prepare.ReadSessionCSV(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", id, err)
+	}
+
+	var events []prepare.Event
+	if ef, err := os.Open(filepath.Join(dataDir, id+".events.csv")); err == nil {
+		defer ef.Close()
+		if events, err = prepare.ReadEventsCSV(ef); err != nil {
+			t.Fatalf("read %s events: %v", id, err)
+		}
+	}
+
+	return prepare.Prepare(raw, events, prepare.DefaultOptions())
+}
+
+// TestBuild_MatchesWindowsCSV runs the Go pipeline from the raw session files
+// and checks every column of every row against windows.csv.
+func TestBuild_MatchesWindowsCSV(t *testing.T) {
+	f, err := os.Open(filepath.Join(processedDir, "windows.csv"))
+	if err != nil {
+		t.Fatalf("open windows.csv: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read windows.csv: %v", err)
+	}
+	header := records[0]
+
+	bySession := map[string][][]string{}
+	for _, rec := range records[1:] {
+		bySession[rec[0]] = append(bySession[rec[0]], rec)
+	}
+
+	for _, id := range []string{"session1", "session2", "session3", "session4"} {
+		got := Build(prepareSession(t, id), DefaultOptions())
+		want := bySession[id]
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d windows, want %d", id, len(got), len(want))
+		}
+
+		for i, rec := range want {
+			w := got[i]
+			for c, name := range header {
+				var value float64
+				switch name {
+				case "session_id":
+					continue
+				case "baseline_source":
+					if w.BaselineSource != rec[c] {
+						t.Fatalf("%s window %d: baseline_source %s, want %s", id, i, w.BaselineSource, rec[c])
+					}
+					continue
+				case "segment_id":
+					value = float64(w.SegmentID)
+				case "window_start_s":
+					value = w.StartS
+				case "window_end_s":
+					value = w.EndS
+				case "baseline_mm":
+					value = w.BaselineMM
+				case "depth_mm":
+					value = w.DepthMM
+				case "label_pushup":
+					if w.LabelPushup {
+						value = 1
+					}
+				default:
+					var ok bool
+					if value, ok = w.Stats[name]; !ok {
+						t.Fatalf("%s window %d: missing column %s", id, i, name)
+					}
+				}
+
+				expected, err := strconv.ParseFloat(rec[c], 64)
+				if err != nil {
+					t.Fatalf("%s window %d: parse %s: %v", id, i, name, err)
+				}
+				if math.Abs(value-expected) > 1e-9*math.Max(1, math.Abs(expected)) {
+					t.Fatalf("%s window %d: %s = %v, want %v", id, i, name, value, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestWindowVector(t *testing.T) {
+	w := Window{Stats: map[string]float64{"ax_mean": 1, "ax_std": 2}}
+
+	v, err := w.Vector([]string{"ax_std", "ax_mean"})
+	if err != nil || v[0] != 2 || v[1] != 1 {
+		t.Fatalf("unexpected vector %v (%v)", v, err)
+	}
+
+	if _, err := w.Vector([]string{"tof_mm_median"}); err == nil {
+		t.Fatal("expected unknown feature to fail")
+	}
+}
+
+func TestBuild_CustomWindow(t *testing.T) {
+	seg := prepare.Segment{BaselineMM: 400}
+	for i := 0; i <= 40; i++ {
+		seg.Samples = append(seg.Samples, prepare.Sample{TimeS: float64(i) * 0.1, TofMM: 400})
+	}
+
+	opt := DefaultOptions()
+	opt.WindowS = 1.0
+	opt.StepS = 1.0
+	if got := Build([]prepare.Segment{seg}, opt); len(got) != 4 {
+		t.Fatalf("expected 4 one-second windows, got %d", len(got))
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"PUSH-UP-ANALYZER/processing/classifier"
+	"PUSH-UP-ANALYZER/processing/prepare"
+	"PUSH-UP-ANALYZER/processing/repdetect"
+	"PUSH-UP-ANALYZER/processing/windows"
+)
+
+var (
+	ErrRawSessionEmpty      = errors.New("raw session has no samples")
+	ErrRawSessionTooLarge   = errors.New("raw session has too many samples or events")
+	ErrRawDeviceRepsInvalid = errors.New("invalid device-reported reps")
+)
+
+// ErrRawNoReps refuses a raw session the server found no reps in: it would show up as a
+// server-verified session of zero reps.
+var ErrRawNoReps = &validationError{
+	Field:   "samples",
+	Code:    "no_reps_detected",
+	Message: "no reps were detected in the samples",
+}
+
+const (
+	// maxRawSamples allows an hour of 10Hz data, far beyond the firmware's 60s cap.
+	maxRawSamples   = 36000
+	maxRawEvents    = 1000
+	maxRawBodyBytes = 8 << 20
+)
+
+// rawSample is one firmware sample row: timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz.
+type rawSample struct {
+	DeviceMS int64   `json:"timestamp_ms"`
+	TofMM    float64 `json:"tof_mm"`
+	AX       float64 `json:"ax"`
+	AY       float64 `json:"ay"`
+	AZ       float64 `json:"az"`
+	GX       float64 `json:"gx"`
+	GY       float64 `json:"gy"`
+	GZ       float64 `json:"gz"`
+}
+
+// rawEvent is one firmware EVENT line. Value is nil for events without one.
+type rawEvent struct {
+	DeviceMS int64    `json:"timestamp_ms"`
+	Name     string   `json:"event"`
+	Value    *float64 `json:"value"`
+	State    string   `json:"state"`
+}
+
+// rawSessionMeta is what the device says about the session, separate from the sensor data.
+type rawSessionMeta struct {
+	DeviceReps      *int       `json:"reps"`
+	Scope           string     `json:"scope"`
+	Source          string     `json:"source"`
+	ClientSessionID string     `json:"clientSessionId"`
+	StartedAt       *time.Time `json:"startedAt"`
+	sessionAnnotations
+}
+
+type rawSessionUpload struct {
+	rawSessionMeta
+	Samples []rawSample `json:"samples"`
+	Events  []rawEvent  `json:"events"`
+}
+
+// parseRawCSV reads the firmware's serial output: EVENT lines, the CSV header,
+// RECORDING/STOPPED markers and sample rows. Banner text from setup() is ignored.
+func parseRawCSV(r io.Reader) (rawSessionUpload, error) {
+	var up rawSessionUpload
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "RECORDING" || line == "STOPPED" || strings.HasPrefix(line, "timestamp_ms,") {
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		if parts[0] == "EVENT" {
+			ev, err := parseRawEventFields(parts)
+			if err != nil {
+				return rawSessionUpload{}, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			up.Events = append(up.Events, ev)
+			continue
+		}
+
+		if len(parts) != 8 {
+			// Free-form status text such as "Ranging started".
+			continue
+		}
+
+		s, err := parseRawSampleFields(parts)
+		if err != nil {
+			return rawSessionUpload{}, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		up.Samples = append(up.Samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return rawSessionUpload{}, err
+	}
+
+	return up, nil
+}
+
+// parseRawEventFields accepts EVENT,ts,name,state and EVENT,ts,name,value,state.
+func parseRawEventFields(parts []string) (rawEvent, error) {
+	if len(parts) != 4 && len(parts) != 5 {
+		return rawEvent{}, errors.New("malformed EVENT line")
+	}
+
+	ms, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return rawEvent{}, errors.New("invalid EVENT timestamp")
+	}
+
+	ev := rawEvent{DeviceMS: ms, Name: parts[2], State: parts[len(parts)-1]}
+	if len(parts) == 5 {
+		v, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil {
+			return rawEvent{}, errors.New("invalid EVENT value")
+		}
+		ev.Value = &v
+	}
+
+	return ev, nil
+}
+
+func parseRawSampleFields(parts []string) (rawSample, error) {
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return rawSample{}, errors.New("invalid sample timestamp")
+	}
+
+	var vals [7]float64
+	for i := range vals {
+		vals[i], err = strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return rawSample{}, errors.New("invalid sample value")
+		}
+	}
+
+	return rawSample{
+		DeviceMS: ms,
+		TofMM:    vals[0],
+		AX:       vals[1],
+		AY:       vals[2],
+		AZ:       vals[3],
+		GX:       vals[4],
+		GY:       vals[5],
+		GZ:       vals[6],
+	}, nil
+}
+
+// parseRawNDJSON reads one object per line, each tagged with "type": meta, sample or event.
+func parseRawNDJSON(r io.Reader) (rawSessionUpload, error) {
+	var up rawSessionUpload
+
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var line struct {
+			Type string `json:"type"`
+			rawSessionMeta
+			rawSample
+			Name  string   `json:"event"`
+			Value *float64 `json:"value"`
+			State string   `json:"state"`
+		}
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rawSessionUpload{}, fmt.Errorf("record %d: invalid JSON", n)
+		}
+
+		switch line.Type {
+		case "meta":
+			up.rawSessionMeta = line.rawSessionMeta
+		case "sample":
+			up.Samples = append(up.Samples, line.rawSample)
+		case "event":
+			up.Events = append(up.Events, rawEvent{
+				DeviceMS: line.DeviceMS,
+				Name:     line.Name,
+				Value:    line.Value,
+				State:    line.State,
+			})
+		default:
+			return rawSessionUpload{}, fmt.Errorf("record %d: unknown type %q", n, line.Type)
+		}
+	}
+
+	return up, nil
+}
+
+// rawSessionMetaFromQuery reads metadata for CSV uploads, which have no room for it in the body.
+func rawSessionMetaFromQuery(q url.Values) (rawSessionMeta, error) {
+	meta := rawSessionMeta{
+		Scope:           q.Get("scope"),
+		Source:          q.Get("source"),
+		ClientSessionID: q.Get("clientSessionId"),
+	}
+
+	if v := q.Get("tags"); v != "" {
+		meta.Tags = strings.Split(v, ",")
+	}
+	meta.Pace = q.Get("pace")
+	meta.Notes = q.Get("notes")
+
+	if v := q.Get("reps"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return rawSessionMeta{}, ErrRawDeviceRepsInvalid
+		}
+		meta.DeviceReps = &n
+	}
+
+	if v := q.Get("startedAt"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return rawSessionMeta{}, errors.New("startedAt must be RFC3339")
+		}
+		meta.StartedAt = &t
+	}
+
+	return meta, nil
+}
+
+// normalizeRawSession validates sizes, vocabularies and annotations and sorts samples, dropping
+// repeated timestamps the same way prepare_samples.py does (keep the first).
+func normalizeRawSession(up *rawSessionUpload) error {
+	// The server counts these reps, whatever the device calls itself.
+	if source := strings.ToLower(strings.TrimSpace(up.Source)); source != "" && !isSessionSource(source) {
+		return ErrSourceInvalid
+	}
+	up.Source = SourceServerDetected
+
+	scope, err := normalizeSessionScope(up.Scope)
+	if err != nil {
+		return err
+	}
+	up.Scope = scope
+
+	up.sessionAnnotations = normalizeSessionAnnotations(up.sessionAnnotations)
+	if err := validateSessionAnnotations(up.sessionAnnotations); err != nil {
+		return err
+	}
+
+	if len(up.Samples) == 0 {
+		return ErrRawSessionEmpty
+	}
+	if len(up.Samples) > maxRawSamples || len(up.Events) > maxRawEvents {
+		return ErrRawSessionTooLarge
+	}
+	if up.DeviceReps != nil && (*up.DeviceReps < 0 || *up.DeviceReps > 1000) {
+		return ErrRawDeviceRepsInvalid
+	}
+
+	sort.SliceStable(up.Samples, func(i, j int) bool {
+		return up.Samples[i].DeviceMS < up.Samples[j].DeviceMS
+	})
+
+	j := 0
+	for i, s := range up.Samples {
+		if i > 0 && s.DeviceMS == up.Samples[j-1].DeviceMS {
+			continue
+		}
+		up.Samples[j] = s
+		j++
+	}
+	up.Samples = up.Samples[:j]
+
+	return nil
+}
+
+// detectRawReps prepares the raw stream like the Python pipeline (trim to the
+// recording, split on gaps, resample to 10Hz) and runs the hybrid detector on
+// each segment. With a model, peaks only count inside windows the classifier
+// marks as pushups, as in rep_detector_hybrid.py; without one every sample is active.
+// Rep offsets are from the first sample of the recording.
+// The returned baseline is the first segment's: the locked baseline when the
+// firmware sent one, otherwise the segment's 90th percentile.
+func detectRawReps(up rawSessionUpload, model *classifier.Model) ([]repEvent, float64, error) {
+	raw := make([]prepare.RawSample, len(up.Samples))
+	for i, s := range up.Samples {
+		raw[i] = prepare.RawSample{
+			DeviceS: float64(s.DeviceMS) / 1000,
+			TofMM:   s.TofMM,
+			AX:      s.AX,
+			AY:      s.AY,
+			AZ:      s.AZ,
+			GX:      s.GX,
+			GY:      s.GY,
+			GZ:      s.GZ,
+		}
+	}
+
+	events := make([]prepare.Event, len(up.Events))
+	for i, ev := range up.Events {
+		events[i] = prepare.Event{DeviceMS: ev.DeviceMS, Name: ev.Name, Value: math.NaN(), State: ev.State}
+		if ev.Value != nil {
+			events[i].Value = *ev.Value
+		}
+	}
+
+	segments := prepare.Prepare(raw, events, prepare.DefaultOptions())
+	if len(segments) == 0 {
+		return nil, 0, nil
+	}
+
+	gates, err := classifyRawWindows(segments, model)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reps := make([]repEvent, 0)
+	for _, seg := range segments {
+		points := make([]repdetect.Sample, len(seg.Samples))
+		for i, s := range seg.Samples {
+			points[i] = repdetect.Sample{TimeS: s.TimeS, TofMM: s.TofMM}
+		}
+
+		var segGates []repdetect.Window
+		if gates != nil {
+			// A segment too short for any window gets an empty, non-nil gate: no reps.
+			segGates = append([]repdetect.Window{}, gates[seg.ID]...)
+		}
+		params := repdetect.DefaultParams()
+		detected := repdetect.Detect(points, segGates, seg.BaselineMM, params)
+		reps = repEventsFromDetection(reps, detected,
+			repdetect.Durations(points, detected, seg.BaselineMM, params),
+			repdetect.Tops(points, detected, params))
+	}
+
+	return reps, segments[0].BaselineMM, nil
+}
+
+// classifyRawWindows scores the feature windows of every segment, keyed by segment ID.
+// It returns nil when no model is loaded.
+func classifyRawWindows(segments []prepare.Segment, model *classifier.Model) (map[int][]repdetect.Window, error) {
+	if model == nil {
+		return nil, nil
+	}
+
+	ws := windows.Build(segments, windows.DefaultOptions())
+	probs, err := model.PredictWindows(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	gates := make(map[int][]repdetect.Window, len(segments))
+	for i, w := range ws {
+		gates[w.SegmentID] = append(gates[w.SegmentID], repdetect.Window{StartS: w.StartS, EndS: w.EndS, Prob: probs[i]})
+	}
+	return gates, nil
+}
+
+// storeRawSession inserts the session row, its detected reps, and its samples and events in one transaction.
+// It returns ErrRawNoReps when nothing was detected.
+// A replayed idempotency key returns the original session without storing the samples again.
+func storeRawSession(ctx context.Context, userID int64, deviceID *int64, up rawSessionUpload, key string, reps []repEvent, baselineMM float64) (int64, bool, error) {
+	if len(reps) == 0 {
+		return 0, false, ErrRawNoReps
+	}
+
+	req := repRequest{
+		Reps:               len(reps),
+		RepEvents:          reps,
+		Scope:              up.Scope,
+		Source:             up.Source,
+		ClientSessionID:    up.ClientSessionID,
+		StartedAt:          up.StartedAt,
+		sessionAnnotations: up.sessionAnnotations,
+		DeviceID:           deviceID,
+		DeviceReps:         up.DeviceReps,
+	}
+	if baselineMM > 0 {
+		req.BaselineMM = &baselineMM
+	}
+	if up.StartedAt != nil {
+		span := time.Duration(up.Samples[len(up.Samples)-1].DeviceMS-up.Samples[0].DeviceMS) * time.Millisecond
+		ended := up.StartedAt.Add(span)
+		req.EndedAt = &ended
+	}
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	sessionID, replayed, err := insertRepSession(ctx, tx, userID, req, key)
+	if err != nil {
+		return 0, false, err
+	}
+	if replayed {
+		return sessionID, true, tx.Commit(ctx)
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"session_samples"},
+		[]string{"session_id", "device_ts_ms", "tof_mm", "ax", "ay", "az", "gx", "gy", "gz"},
+		pgx.CopyFromSlice(len(up.Samples), func(i int) ([]any, error) {
+			s := up.Samples[i]
+			return []any{sessionID, s.DeviceMS, s.TofMM, s.AX, s.AY, s.AZ, s.GX, s.GY, s.GZ}, nil
+		}),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"session_events"},
+		[]string{"session_id", "seq", "device_ts_ms", "event", "value", "state"},
+		pgx.CopyFromSlice(len(up.Events), func(i int) ([]any, error) {
+			ev := up.Events[i]
+			return []any{sessionID, i, ev.DeviceMS, ev.Name, ev.Value, ev.State}, nil
+		}),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return sessionID, false, tx.Commit(ctx)
+}
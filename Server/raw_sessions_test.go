@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const firmwareStream = `Pressle sensor logger
+Type: start / stop
+EVENT,145181,START_CMD,ARMING
+EVENT,145182,ARMING_START,ARMING
+EVENT,147195,BASELINE_LOCKED_MM,412.60,ARMING
+EVENT,147196,COUNTDOWN_START,COUNTDOWN
+EVENT,152295,RECORDING_START,RECORDING
+timestamp_ms,tof_mm,ax,ay,az,gx,gy,gz
+RECORDING
+152396,410.00,-0.2432,-0.0702,-1.0282,4.2114,15.2588,-5.5542
+152495,300.00,-0.2822,0.2039,-1.2094,3.6011,11.7187,-6.6528
+152595,117.00,-0.2394,0.0574,-1.4575,2.8076,-7.9956,-3.1738
+152595,117.00,-0.2394,0.0574,-1.4575,2.8076,-7.9956,-3.1738
+152695,390.00,-0.2070,-0.0425,-1.1967,-6.4697,-21.7285,6.3477
+152795,120.00,-0.2070,-0.0425,-1.1967,-6.4697,-21.7285,6.3477
+152895,405.00,-0.2070,-0.0425,-1.1967,-6.4697,-21.7285,6.3477
+EVENT,167948,STOP_CMD,RECORDING
+EVENT,168000,END_HOLD_START,END_HOLD
+EVENT,170095,SESSION_STOPPED_CLEAN_SPAN_MM,23.25,END_HOLD
+STOPPED
+`
+
+func TestParseRawCSV(t *testing.T) {
+	up, err := parseRawCSV(strings.NewReader(firmwareStream))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if len(up.Events) != 8 {
+		t.Fatalf("expected 8 events, got %d", len(up.Events))
+	}
+	if up.Events[0].Name != "START_CMD" || up.Events[0].Value != nil || up.Events[0].State != "ARMING" {
+		t.Fatalf("unexpected first event: %+v", up.Events[0])
+	}
+	if up.Events[2].Value == nil || *up.Events[2].Value != 412.60 {
+		t.Fatalf("expected baseline value, got %+v", up.Events[2])
+	}
+
+	if err := normalizeRawSession(&up); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if len(up.Samples) != 6 {
+		t.Fatalf("expected duplicate timestamp to be dropped, got %d samples", len(up.Samples))
+	}
+
+	reps, baseline, err := detectRawReps(up, nil)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if baseline != 412.60 {
+		t.Fatalf("expected locked baseline, got %v", baseline)
+	}
+	if len(reps) != 1 {
+		t.Fatalf("expected 1 rep, got %+v", reps)
+	}
+}
+
+func TestParseRawCSV_BadSample(t *testing.T) {
+	_, err := parseRawCSV(strings.NewReader("152396,abc,0,0,0,0,0,0\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected line number in error, got %v", err)
+	}
+}
+
+func TestParseRawNDJSON(t *testing.T) {
+	body := `{"type":"meta","reps":3,"clientSessionId":"abc-123"}
+{"type":"event","timestamp_ms":100,"event":"BASELINE_LOCKED_MM","value":400,"state":"ARMING"}
+{"type":"sample","timestamp_ms":200,"tof_mm":399,"ax":0.1,"ay":0,"az":-1,"gx":0,"gy":0,"gz":0}
+`
+	up, err := parseRawNDJSON(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if up.DeviceReps == nil || *up.DeviceReps != 3 || up.ClientSessionID != "abc-123" {
+		t.Fatalf("unexpected meta: %+v", up.rawSessionMeta)
+	}
+	if len(up.Events) != 1 || len(up.Samples) != 1 || up.Samples[0].AX != 0.1 {
+		t.Fatalf("unexpected records: %+v", up)
+	}
+
+	if _, err := parseRawNDJSON(strings.NewReader(`{"type":"nope"}`)); err == nil {
+		t.Fatal("expected unknown record type to fail")
+	}
+}
+
+func TestRawSessionMetaFromQuery(t *testing.T) {
+	meta, err := rawSessionMetaFromQuery(url.Values{
+		"reps":      {"20"},
+		"startedAt": {"2026-03-23T20:52:56Z"},
+		"pace":      {"slow"},
+		"tags":      {"plank,morning"},
+	})
+	if err != nil {
+		t.Fatalf("meta: %v", err)
+	}
+	if meta.DeviceReps == nil || *meta.DeviceReps != 20 || meta.StartedAt == nil || meta.Pace != "slow" || len(meta.Tags) != 2 {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+
+	if _, err := rawSessionMetaFromQuery(url.Values{"reps": {"many"}}); err != ErrRawDeviceRepsInvalid {
+		t.Fatalf("expected ErrRawDeviceRepsInvalid, got %v", err)
+	}
+}
+
+// TestDetectRawReps_Classifier runs a recorded session through the upload path with
+// the exported model and expects the hybrid detector's count from rep_events_hybrid.csv.
+func TestDetectRawReps_Classifier(t *testing.T) {
+	model, err := loadRepModel()
+	if err != nil {
+		t.Fatalf("load model: %v", err)
+	}
+
+	var up rawSessionUpload
+	for _, name := range []string{"session2.csv", "session2.events.csv"} {
+		f, err := os.Open(filepath.Join("..", "data", name))
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+
+		for _, rec := range records[1:] {
+			if strings.HasSuffix(name, ".events.csv") {
+				// host_ts,device_ts_ms,event,value,state; value is empty for most events.
+				parts := []string{"EVENT", rec[1], rec[2], rec[3], rec[4]}
+				if rec[3] == "" {
+					parts = []string{"EVENT", rec[1], rec[2], rec[4]}
+				}
+				ev, err := parseRawEventFields(parts)
+				if err != nil {
+					t.Fatalf("event %v: %v", rec, err)
+				}
+				up.Events = append(up.Events, ev)
+				continue
+			}
+
+			deviceS, err := strconv.ParseFloat(rec[1], 64)
+			if err != nil {
+				t.Fatalf("device_ts_s %q: %v", rec[1], err)
+			}
+			rec[1] = strconv.FormatInt(int64(math.Round(deviceS*1000)), 10)
+			s, err := parseRawSampleFields(rec[1:])
+			if err != nil {
+				t.Fatalf("sample %v: %v", rec, err)
+			}
+			up.Samples = append(up.Samples, s)
+		}
+	}
+	if err := normalizeRawSession(&up); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	gated, _, err := detectRawReps(up, model)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if len(gated) != 21 {
+		t.Fatalf("expected 21 reps with the classifier gate, got %d", len(gated))
+	}
+}
+
+// A session the server found no reps in is refused before anything is stored.
+func TestStoreRawSessionNeedsReps(t *testing.T) {
+	up, err := parseRawCSV(strings.NewReader(firmwareStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = storeRawSession(context.Background(), 7, nil, up, "", nil, 0)
+	if !errors.Is(err, ErrRawNoReps) {
+		t.Fatalf("expected ErrRawNoReps, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	writeRequestErrorStatus(w, http.StatusUnprocessableEntity, err)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"code":"no_reps_detected"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
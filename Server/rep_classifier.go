@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"PUSH-UP-ANALYZER/processing/classifier"
+	"PUSH-UP-ANALYZER/processing/windows"
+)
+
+// repModel gates server-side rep detection. It stays nil when no export is found, in
+// which case raw uploads are refused and live sets keep the device's own count: a
+// server-verified count always went through the classifier.
+var repModel *classifier.Model
+
+// defaultModelDir is where the Python pipeline writes model.json and model_features.json.
+var defaultModelDir = filepath.Join("..", "data", "data_processing", "processed")
+
+// loadRepModel reads REP_MODEL_PATH (default processed/model.json) and checks it against
+// REP_MODEL_FEATURES_PATH and the features the Go windowing produces.
+func loadRepModel() (*classifier.Model, error) {
+	modelPath := os.Getenv("REP_MODEL_PATH")
+	if modelPath == "" {
+		modelPath = filepath.Join(defaultModelDir, "model.json")
+	}
+	featuresPath := os.Getenv("REP_MODEL_FEATURES_PATH")
+	if featuresPath == "" {
+		featuresPath = filepath.Join(filepath.Dir(modelPath), "model_features.json")
+	}
+
+	model, err := classifier.LoadFile(modelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := classifier.ReadFeatureList(featuresPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.CheckFeatures(names); err != nil {
+		return nil, fmt.Errorf("%s: %w", featuresPath, err)
+	}
+	if err := model.CheckFeatures(windows.FeatureNames); err != nil {
+		return nil, fmt.Errorf("server windowing: %w", err)
+	}
+
+	return model, nil
+}
+
+// initRepModel loads the classifier at startup. A missing or stale export is logged,
+// not fatal, so the rest of the API keeps working while the model is being retrained.
+func initRepModel() {
+	model, err := loadRepModel()
+	if err != nil {
+		log.Printf("rep classifier disabled: %v", err)
+		return
+	}
+	repModel = model
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"PUSH-UP-ANALYZER/processing/repdetect"
+)
+
+var (
+	ErrRepEventsCount   = errors.New("repEvents must have one entry per rep")
+	ErrRepEventsInvalid = errors.New("invalid rep event")
+)
+
+// maxRepDuration rejects rep durations no pushup could take.
+const maxRepDuration = time.Minute
+
+// repEvent is one rep inside a session. Devices may send these with a rep submission;
+// raw uploads get them from server-side detection. Index is the rep's position in the
+// session and is assigned by the server, as are FormScore and Quality.
+type repEvent struct {
+	Index       int      `json:"index"`
+	OffsetMS    int64    `json:"tMs"`
+	BottomTofMM float64  `json:"bottomTofMm"`
+	DepthMM     float64  `json:"depthMm"`
+	DurationMS  *int64   `json:"durationMs"`
+	TopTofMM    *float64 `json:"topTofMm"`
+	FormScore   *float64 `json:"formScore"`
+	Quality     *bool    `json:"quality"`
+}
+
+// validateRepEvents checks device-reported rep events against the session they belong to.
+func validateRepEvents(req repRequest) error {
+	if len(req.RepEvents) == 0 {
+		return nil
+	}
+	if len(req.RepEvents) != req.Reps {
+		return ErrRepEventsCount
+	}
+
+	var spanMS int64 = -1
+	if req.StartedAt != nil && req.EndedAt != nil {
+		spanMS = req.EndedAt.Sub(*req.StartedAt).Milliseconds()
+	}
+
+	for i, ev := range req.RepEvents {
+		if ev.OffsetMS < 0 || (spanMS >= 0 && ev.OffsetMS > spanMS) {
+			return ErrRepEventsInvalid
+		}
+		if i > 0 && ev.OffsetMS < req.RepEvents[i-1].OffsetMS {
+			return ErrRepEventsInvalid
+		}
+		if ev.DepthMM < 0 || ev.BottomTofMM < 0 || math.IsNaN(ev.DepthMM) || math.IsNaN(ev.BottomTofMM) {
+			return ErrRepEventsInvalid
+		}
+		if ev.DurationMS != nil && (*ev.DurationMS < 0 || *ev.DurationMS > maxRepDuration.Milliseconds()) {
+			return ErrRepEventsInvalid
+		}
+		if ev.TopTofMM != nil && (*ev.TopTofMM < 0 || math.IsNaN(*ev.TopTofMM)) {
+			return ErrRepEventsInvalid
+		}
+	}
+
+	return nil
+}
+
+// repEventsFromDetection converts one segment's detector output, appending after existing events.
+func repEventsFromDetection(existing []repEvent, detected []repdetect.Event, durationsS, topsMM []float64) []repEvent {
+	for i, ev := range detected {
+		re := repEvent{
+			Index:       len(existing),
+			OffsetMS:    int64(math.Round(ev.TimeS * 1000)),
+			BottomTofMM: ev.TofMM,
+			DepthMM:     ev.DepthMM,
+		}
+		if i < len(durationsS) {
+			ms := int64(math.Round(durationsS[i] * 1000))
+			re.DurationMS = &ms
+		}
+		if i < len(topsMM) && !math.IsNaN(topsMM[i]) {
+			top := topsMM[i]
+			re.TopTofMM = &top
+		}
+		existing = append(existing, re)
+	}
+	return existing
+}
+
+// insertRepEvents stores a session's reps in order, numbering them from zero.
+// Callers run it in the same transaction as the session insert.
+func insertRepEvents(ctx context.Context, db dbQuerier, sessionID int64, events []repEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	_, err := db.CopyFrom(ctx,
+		pgx.Identifier{"rep_events"},
+		[]string{"session_id", "rep_index", "t_offset_ms", "bottom_tof_mm", "depth_mm", "duration_ms", "top_tof_mm", "form_score", "is_quality"},
+		pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+			ev := events[i]
+			return []any{sessionID, i, ev.OffsetMS, ev.BottomTofMM, ev.DepthMM, ev.DurationMS, ev.TopTofMM, ev.FormScore, ev.Quality}, nil
+		}),
+	)
+	return err
+}
+
+// loadRepEvents returns a session's reps in order.
+func loadRepEvents(ctx context.Context, db dbQuerier, sessionID int64) ([]repEvent, error) {
+	const q = `
+		SELECT rep_index, t_offset_ms, bottom_tof_mm, depth_mm, duration_ms, top_tof_mm, form_score, is_quality
+		FROM rep_events
+		WHERE session_id = $1
+		ORDER BY rep_index;
+	`
+
+	rows, err := db.Query(ctx, q, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]repEvent, 0)
+	for rows.Next() {
+		var ev repEvent
+		if err := rows.Scan(&ev.Index, &ev.OffsetMS, &ev.BottomTofMM, &ev.DepthMM, &ev.DurationMS, &ev.TopTofMM, &ev.FormScore, &ev.Quality); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"PUSH-UP-ANALYZER/processing/repdetect"
+)
+
+func TestValidateRepEvents(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Second)
+	dur := int64(900)
+
+	ok := repRequest{
+		Reps:      2,
+		StartedAt: &start,
+		EndedAt:   &end,
+		RepEvents: []repEvent{
+			{OffsetMS: 1200, BottomTofMM: 180, DepthMM: 230, DurationMS: &dur},
+			{OffsetMS: 2500, BottomTofMM: 190, DepthMM: 220},
+		},
+	}
+	if err := validateRepEvents(ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tooLong := int64(2 * time.Minute / time.Millisecond)
+	cases := map[string]func(req *repRequest) error{
+		"count": func(req *repRequest) error {
+			req.Reps = 3
+			return ErrRepEventsCount
+		},
+		"unordered": func(req *repRequest) error {
+			req.RepEvents[1].OffsetMS = 100
+			return ErrRepEventsInvalid
+		},
+		"past end": func(req *repRequest) error {
+			req.RepEvents[1].OffsetMS = 11000
+			return ErrRepEventsInvalid
+		},
+		"negative depth": func(req *repRequest) error {
+			req.RepEvents[0].DepthMM = -5
+			return ErrRepEventsInvalid
+		},
+		"duration": func(req *repRequest) error {
+			req.RepEvents[0].DurationMS = &tooLong
+			return ErrRepEventsInvalid
+		},
+	}
+	for name, mutate := range cases {
+		req := ok
+		req.RepEvents = append([]repEvent(nil), ok.RepEvents...)
+		want := mutate(&req)
+		if err := validateRepEvents(req); err != want {
+			t.Errorf("%s: expected %v, got %v", name, want, err)
+		}
+	}
+}
+
+func TestRepEventsFromDetection(t *testing.T) {
+	first := repEventsFromDetection(nil, []repdetect.Event{{TimeS: 1.25, TofMM: 150, DepthMM: 260}}, []float64{0.8}, []float64{405})
+	all := repEventsFromDetection(first, []repdetect.Event{{TimeS: 14.1, TofMM: 170, DepthMM: 240}}, nil, nil)
+
+	if len(all) != 2 || all[1].Index != 1 || all[1].OffsetMS != 14100 || all[1].DurationMS != nil {
+		t.Fatalf("unexpected events: %+v", all)
+	}
+	if all[0].OffsetMS != 1250 || all[0].DurationMS == nil || *all[0].DurationMS != 800 || all[0].TopTofMM == nil {
+		t.Fatalf("unexpected first event: %+v", all[0])
+	}
+}
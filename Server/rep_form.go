@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"PUSH-UP-ANALYZER/processing/formscore"
+)
+
+// formHistoryReps is how many of the user's most recent reps calibrate their full depth.
+const formHistoryReps = 500
+
+// scoreRepEvents rates a new session's reps against the user's calibrated depth and
+// writes each rep's FormScore and Quality. The calibration uses the user's earlier
+// reps plus this session's, so a first session is judged against itself.
+func scoreRepEvents(ctx context.Context, db dbQuerier, userID int64, baselineMM *float64, events []repEvent) (formscore.Result, error) {
+	const historyQ = `
+		SELECT re.depth_mm
+		FROM rep_events re
+		JOIN rep_sessions rs
+		  ON rs.id = re.session_id
+		WHERE rs.user_id = $1
+		ORDER BY rs.started_at DESC, re.rep_index
+		LIMIT $2;
+	`
+
+	rows, err := db.Query(ctx, historyQ, userID, formHistoryReps)
+	if err != nil {
+		return formscore.Result{}, err
+	}
+	defer rows.Close()
+
+	depths := make([]float64, 0, formHistoryReps+len(events))
+	for rows.Next() {
+		var depth float64
+		if err := rows.Scan(&depth); err != nil {
+			return formscore.Result{}, err
+		}
+		depths = append(depths, depth)
+	}
+	if err := rows.Err(); err != nil {
+		return formscore.Result{}, err
+	}
+
+	reps := make([]formscore.Rep, len(events))
+	for i, ev := range events {
+		depths = append(depths, ev.DepthMM)
+		reps[i] = formscore.Rep{DepthMM: ev.DepthMM, DurationS: math.NaN(), TopTofMM: math.NaN()}
+		if ev.DurationMS != nil {
+			reps[i].DurationS = float64(*ev.DurationMS) / 1000
+		}
+		if ev.TopTofMM != nil {
+			reps[i].TopTofMM = *ev.TopTofMM
+		}
+	}
+
+	params := formscore.DefaultParams()
+	cal := formscore.Calibration{BaselineMM: math.NaN(), TargetDepthMM: formscore.TargetDepth(depths, params)}
+	if baselineMM != nil {
+		cal.BaselineMM = *baselineMM
+	}
+
+	res := formscore.Score(reps, cal, params)
+	for i := range events {
+		score := res.Reps[i].Score
+		quality := res.Reps[i].Quality
+		events[i].FormScore = &score
+		events[i].Quality = &quality
+	}
+
+	return res, nil
+}
+
+// insertScoredRepEvents scores a new session's reps, stores them, and records the
+// session's form score and quality rep count.
+func insertScoredRepEvents(ctx context.Context, db dbQuerier, userID, sessionID int64, req repRequest) error {
+	if len(req.RepEvents) == 0 {
+		return nil
+	}
+
+	// Scoring fills in fields; keep the caller's slice as it was submitted.
+	events := append([]repEvent(nil), req.RepEvents...)
+	res, err := scoreRepEvents(ctx, db, userID, req.BaselineMM, events)
+	if err != nil {
+		return err
+	}
+
+	if err := insertRepEvents(ctx, db, sessionID, events); err != nil {
+		return err
+	}
+
+	const updateQ = `
+		UPDATE rep_sessions
+		SET form_score = $2, quality_reps = $3
+		WHERE id = $1;
+	`
+	_, err = db.Exec(ctx, updateQ, sessionID, res.Score, res.QualityReps)
+	return err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrIdempotencyKeyInvalid  = errors.New("idempotency key invalid")
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key does not match client session id")
+	ErrIdempotencyConflict    = errors.New("idempotency key reused with a different request")
+)
+
+const maxIdempotencyKeyLen = 255
+
+// idempotencyKeyFromRequest picks the retry key for a rep submission.
+// Devices may send an Idempotency-Key header, a clientSessionId in the body, or both.
+// When both are present they must agree, otherwise we can't tell which one the client meant.
+func idempotencyKeyFromRequest(r *http.Request, req repRequest) (string, error) {
+	header := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	body := strings.TrimSpace(req.ClientSessionID)
+
+	key := header
+	if key == "" {
+		key = body
+	} else if body != "" && body != header {
+		return "", ErrIdempotencyKeyMismatch
+	}
+
+	return normalizeIdempotencyKey(key)
+}
+
+// normalizeIdempotencyKey trims a key and rejects values we don't want to store.
+// An empty key is allowed and means the submission isn't deduplicated.
+func normalizeIdempotencyKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", nil
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return "", ErrIdempotencyKeyInvalid
+	}
+	for _, ch := range key {
+		// Printable ASCII only: keys end up in logs and headers.
+		if ch < 0x21 || ch > 0x7e {
+			return "", ErrIdempotencyKeyInvalid
+		}
+	}
+
+	return key, nil
+}
+
+// repRequestFingerprint hashes the parts of a submission that decide what gets stored:
+// reps, source, scope, startedAt, endedAt, repEvents, baselineMm, pace, notes and tags.
+// The client session ID and device fields are left out. A retry with the same key must
+// produce the same fingerprint to be treated as a replay.
+func repRequestFingerprint(req repRequest) string {
+	canonical, _ := json.Marshal(struct {
+		Reps       int        `json:"reps"`
+		Source     string     `json:"source"`
+		Scope      string     `json:"scope"`
+		StartedAt  *time.Time `json:"startedAt"`
+		EndedAt    *time.Time `json:"endedAt"`
+		RepEvents  []repEvent `json:"repEvents,omitempty"`
+		BaselineMM *float64   `json:"baselineMm,omitempty"`
+		Pace       string     `json:"pace,omitempty"`
+		Notes      string     `json:"notes,omitempty"`
+		Tags       []string   `json:"tags,omitempty"`
+	}{
+		req.Reps, req.Source, req.Scope, utcTime(req.StartedAt), utcTime(req.EndedAt),
+		req.RepEvents, req.BaselineMM, req.Pace, req.Notes, req.Tags,
+	})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// insertRepSession stores one rep session, honoring the idempotency key when one is given.
+// replayed is true when a previous submission with the same key and body already exists.
+// Sessions without a device timestamp are stamped with the database clock.
+// A new session's per-rep events are scored and stored, the session goes through
+// the anomaly checks and the revision log, and the user's stats are updated, so db
+// should be a transaction.
+func insertRepSession(ctx context.Context, db dbQuerier, userID int64, req repRequest, key string) (sessionID int64, replayed bool, err error) {
+	fingerprint := repRequestFingerprint(req)
+
+	const insertQ = `
+		INSERT INTO rep_sessions (
+			user_id, reps, scope, source, idempotency_key, request_hash, started_at, ended_at, baseline_mm,
+			device_id, pace, notes, tags, device_reps
+		)
+		VALUES (
+			$1, $2, $3, $4, NULLIF($5, ''), $6, COALESCE($7, now()), $8, $9,
+			$10, NULLIF($11, ''), NULLIF($12, ''), COALESCE($13::text[], '{}'), $14
+		)
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING
+		RETURNING id, started_at;
+	`
+
+	var startedAt time.Time
+	err = db.QueryRow(ctx, insertQ,
+		userID, req.Reps, req.Scope, req.Source, key, fingerprint, req.StartedAt, req.EndedAt, req.BaselineMM,
+		req.DeviceID, req.Pace, req.Notes, req.Tags, req.DeviceReps,
+	).Scan(&sessionID, &startedAt)
+	if err == nil {
+		if err := insertScoredRepEvents(ctx, db, userID, sessionID, req); err != nil {
+			return 0, false, err
+		}
+		if _, err := checkSessionAnomalies(ctx, db, userID, sessionID, req); err != nil {
+			return 0, false, err
+		}
+		after, err := sessionSnapshot(ctx, db, sessionID)
+		if err != nil {
+			return 0, false, err
+		}
+		if err := recordSessionRevision(ctx, db, sessionID, userID, userID, RevisionCreate, nil, after); err != nil {
+			return 0, false, err
+		}
+		if err := refreshUserStats(ctx, db, userID, startedAt); err != nil {
+			return 0, false, err
+		}
+		return sessionID, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) || key == "" {
+		return 0, false, err
+	}
+
+	const existingQ = `
+		SELECT id, COALESCE(request_hash, '')
+		FROM rep_sessions
+		WHERE user_id = $1
+		  AND idempotency_key = $2;
+	`
+
+	var existingHash string
+	if err := db.QueryRow(ctx, existingQ, userID, key).Scan(&sessionID, &existingHash); err != nil {
+		return 0, false, err
+	}
+	if existingHash != fingerprint {
+		return 0, false, ErrIdempotencyConflict
+	}
+
+	return sessionID, true, nil
+}
+
+// utcTime normalizes an optional timestamp so equal instants hash the same.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyKeyFromRequest(t *testing.T) {
+	r := &http.Request{Header: http.Header{}}
+
+	key, err := idempotencyKeyFromRequest(r, repRequest{})
+	if err != nil || key != "" {
+		t.Fatalf("expected no key, got %q (%v)", key, err)
+	}
+
+	key, err = idempotencyKeyFromRequest(r, repRequest{ClientSessionID: "0b6f6c9e-5a1f-4c1d-9d9a-0f0e0d0c0b0a"})
+	if err != nil || key != "0b6f6c9e-5a1f-4c1d-9d9a-0f0e0d0c0b0a" {
+		t.Fatalf("expected body key, got %q (%v)", key, err)
+	}
+
+	r.Header.Set("Idempotency-Key", "retry-1")
+	key, err = idempotencyKeyFromRequest(r, repRequest{})
+	if err != nil || key != "retry-1" {
+		t.Fatalf("expected header key, got %q (%v)", key, err)
+	}
+
+	if _, err := idempotencyKeyFromRequest(r, repRequest{ClientSessionID: "retry-2"}); err != ErrIdempotencyKeyMismatch {
+		t.Fatalf("expected ErrIdempotencyKeyMismatch, got %v", err)
+	}
+}
+
+func TestIdempotencyKeyFromRequest_Invalid(t *testing.T) {
+	r := &http.Request{Header: http.Header{}}
+
+	if _, err := idempotencyKeyFromRequest(r, repRequest{ClientSessionID: "has space"}); err != ErrIdempotencyKeyInvalid {
+		t.Fatalf("expected ErrIdempotencyKeyInvalid for space, got %v", err)
+	}
+
+	long := strings.Repeat("a", maxIdempotencyKeyLen+1)
+	if _, err := idempotencyKeyFromRequest(r, repRequest{ClientSessionID: long}); err != ErrIdempotencyKeyInvalid {
+		t.Fatalf("expected ErrIdempotencyKeyInvalid for long key, got %v", err)
+	}
+}
+
+func TestRepRequestFingerprint(t *testing.T) {
+	a := repRequestFingerprint(repRequest{Reps: 20, Source: "device", Scope: "global", ClientSessionID: "a"})
+	b := repRequestFingerprint(repRequest{Reps: 20, Source: "device", Scope: "global", ClientSessionID: "b"})
+	if a != b {
+		t.Fatal("fingerprint should ignore the client session id")
+	}
+
+	c := repRequestFingerprint(repRequest{Reps: 21, Source: "device", Scope: "global"})
+	if a == c {
+		t.Fatal("fingerprint should change when reps change")
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPaceInvalid  = errors.New("pace must be slow, normal or fast")
+	ErrNotesTooLong = errors.New("notes are too long")
+	ErrTagsInvalid  = errors.New("tags must be up to 10 short words")
+)
+
+const (
+	maxSessionNotesLen = 1000
+	maxSessionTags     = 10
+	maxSessionTagLen   = 32
+)
+
+var sessionPaces = map[string]bool{"slow": true, "normal": true, "fast": true}
+
+// sessionAnnotations are the hand-written details of a session, set on submission
+// or later with PATCH /api/sessions/{id}.
+type sessionAnnotations struct {
+	Pace  string   `json:"pace"`
+	Notes string   `json:"notes"`
+	Tags  []string `json:"tags"`
+}
+
+// validateSessionAnnotations checks annotations after normalizeSessionAnnotations.
+func validateSessionAnnotations(a sessionAnnotations) error {
+	if a.Pace != "" && !sessionPaces[a.Pace] {
+		return ErrPaceInvalid
+	}
+	if len([]rune(a.Notes)) > maxSessionNotesLen {
+		return ErrNotesTooLong
+	}
+	if len(a.Tags) > maxSessionTags {
+		return ErrTagsInvalid
+	}
+	for _, tag := range a.Tags {
+		if tag == "" || len(tag) > maxSessionTagLen {
+			return ErrTagsInvalid
+		}
+		for _, ch := range tag {
+			if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '-' && ch != '_' {
+				return ErrTagsInvalid
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeSessionAnnotations trims user input so "Slow " and "slow" are the same pace.
+func normalizeSessionAnnotations(a sessionAnnotations) sessionAnnotations {
+	return sessionAnnotations{
+		Pace:  strings.ToLower(strings.TrimSpace(a.Pace)),
+		Notes: strings.TrimSpace(a.Notes),
+		Tags:  normalizeTags(a.Tags),
+	}
+}
+
+// normalizeTags lowercases and trims tags and drops blanks and duplicates, keeping order.
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// repSessionDetail is the full view of one session.
+type repSessionDetail struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Reps        int        `json:"reps"`
+	Scope       string     `json:"scope"`
+	Source      string     `json:"source"`
+	Provenance  string     `json:"provenance"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     *time.Time `json:"endedAt"`
+	DurationS   *float64   `json:"durationS"`
+	DeviceID    *int64     `json:"deviceId"`
+	DeviceReps  *int       `json:"deviceReps"`
+	BaselineMM  *float64   `json:"baselineMm"`
+	FormScore   *float64   `json:"formScore"`
+	QualityReps *int       `json:"qualityReps"`
+	Pace        *string    `json:"pace"`
+	Notes       *string    `json:"notes"`
+	Tags        []string   `json:"tags"`
+	// ReviewStatus is only shown to the owner.
+	ReviewStatus *string   `json:"reviewStatus,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	IsOwner      bool      `json:"isOwner"`
+
+	userID int64
+}
+
+// repSessionColumns are the columns scanRepSession reads, from rep_sessions rs joined to users u.
+const repSessionColumns = `
+	rs.id,
+	rs.user_id,
+	u.username,
+	rs.reps,
+	rs.scope,
+	rs.source,
+	rs.provenance,
+	rs.started_at,
+	rs.ended_at,
+	rs.device_id,
+	rs.device_reps,
+	rs.baseline_mm,
+	rs.form_score,
+	rs.quality_reps,
+	rs.pace,
+	rs.notes,
+	rs.tags,
+	rs.review_status,
+	rs.created_at
+`
+
+// scanRepSession reads one row of repSessionColumns and hides what only the owner may see.
+func scanRepSession(row pgx.Row, viewerID int64) (repSessionDetail, error) {
+	var s repSessionDetail
+	err := row.Scan(
+		&s.ID,
+		&s.userID,
+		&s.Username,
+		&s.Reps,
+		&s.Scope,
+		&s.Source,
+		&s.Provenance,
+		&s.StartedAt,
+		&s.EndedAt,
+		&s.DeviceID,
+		&s.DeviceReps,
+		&s.BaselineMM,
+		&s.FormScore,
+		&s.QualityReps,
+		&s.Pace,
+		&s.Notes,
+		&s.Tags,
+		&s.ReviewStatus,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return repSessionDetail{}, err
+	}
+
+	s.IsOwner = s.userID == viewerID
+	s.StartedAt = s.StartedAt.UTC()
+	s.CreatedAt = s.CreatedAt.UTC()
+	if s.EndedAt != nil {
+		ended := s.EndedAt.UTC()
+		s.EndedAt = &ended
+		d := ended.Sub(s.StartedAt).Seconds()
+		s.DurationS = &d
+	}
+	if !s.IsOwner {
+		s.Notes = nil
+		s.DeviceID = nil
+		s.ReviewStatus = nil
+	}
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+
+	return s, nil
+}
+
+// loadRepSession reads a session the viewer may see: their own or a friend's.
+// Notes are private to the owner. It returns pgx.ErrNoRows for anything else.
+func loadRepSession(ctx context.Context, db dbQuerier, sessionID, viewerID int64) (repSessionDetail, error) {
+	q := `
+		SELECT` + repSessionColumns + `
+		FROM rep_sessions rs
+		JOIN users u
+		  ON u.id = rs.user_id
+		WHERE rs.id = $1
+		  AND (
+			rs.user_id = $2
+			OR EXISTS (
+				SELECT 1
+				FROM friendships f
+				WHERE f.user_id = $2
+				  AND f.friend_user_id = rs.user_id
+			)
+		  );
+	`
+
+	return scanRepSession(db.QueryRow(ctx, q, sessionID, viewerID), viewerID)
+}
+
+var ErrSessionCursorInvalid = errors.New("invalid cursor")
+
+const (
+	defaultSessionPageSize = 20
+	maxSessionPageSize     = 100
+)
+
+// sessionCursor is the position after the last session of a page, newest first.
+// On the wire it is "<started_at in unix microseconds>.<id>"; Postgres stores microseconds,
+// so the round trip is exact.
+type sessionCursor struct {
+	StartedAt time.Time
+	ID        int64
+}
+
+func (c sessionCursor) String() string {
+	return strconv.FormatInt(c.StartedAt.UnixMicro(), 10) + "." + strconv.FormatInt(c.ID, 10)
+}
+
+func parseSessionCursor(raw string) (sessionCursor, error) {
+	micros, id, ok := strings.Cut(raw, ".")
+	if !ok {
+		return sessionCursor{}, ErrSessionCursorInvalid
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return sessionCursor{}, ErrSessionCursorInvalid
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return sessionCursor{}, ErrSessionCursorInvalid
+	}
+	return sessionCursor{StartedAt: time.UnixMicro(us).UTC(), ID: n}, nil
+}
+
+// sessionListFilter selects a page of a user's sessions. From is inclusive and To exclusive,
+// both on started_at; nil means unbounded.
+type sessionListFilter struct {
+	From  *time.Time
+	To    *time.Time
+	After *sessionCursor
+	Limit int
+}
+
+// listUserSessions returns one page of the user's own sessions, newest first,
+// and the cursor of the next page when there is one.
+func listUserSessions(ctx context.Context, db dbQuerier, userID int64, f sessionListFilter) ([]repSessionDetail, *sessionCursor, error) {
+	q := `
+		SELECT` + repSessionColumns + `
+		FROM rep_sessions rs
+		JOIN users u
+		  ON u.id = rs.user_id
+		WHERE rs.user_id = $1
+		  AND ($2::timestamptz IS NULL OR rs.started_at >= $2)
+		  AND ($3::timestamptz IS NULL OR rs.started_at < $3)
+		  AND ($4::timestamptz IS NULL OR (rs.started_at, rs.id) < ($4, $5))
+		ORDER BY rs.started_at DESC, rs.id DESC
+		LIMIT $6;
+	`
+
+	var afterTime *time.Time
+	var afterID int64
+	if f.After != nil {
+		afterTime = &f.After.StartedAt
+		afterID = f.After.ID
+	}
+
+	// One extra row tells us whether there is another page.
+	rows, err := db.Query(ctx, q, userID, f.From, f.To, afterTime, afterID, f.Limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]repSessionDetail, 0, f.Limit)
+	for rows.Next() {
+		s, err := scanRepSession(rows, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(sessions) <= f.Limit {
+		return sessions, nil, nil
+	}
+	sessions = sessions[:f.Limit]
+	last := sessions[len(sessions)-1]
+	return sessions, &sessionCursor{StartedAt: last.StartedAt, ID: last.ID}, nil
+}
+
+var (
+	ErrSessionDeviceCounted = errors.New("session was counted by a device; pass force=true to change it")
+	ErrSessionRejected      = errors.New("session was rejected by a moderator and can't be changed")
+)
+
+// sessionPatch is the body of PATCH /api/sessions/{id}. Omitted fields are left alone;
+// an empty pace or notes clears it.
+type sessionPatch struct {
+	Reps      *int       `json:"reps"`
+	Scope     *string    `json:"scope"`
+	StartedAt *time.Time `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	Pace      *string    `json:"pace"`
+	Notes     *string    `json:"notes"`
+	Tags      *[]string  `json:"tags"`
+}
+
+// changesCount reports whether the patch touches what the leaderboards count.
+func (p sessionPatch) changesCount() bool {
+	return p.Reps != nil || p.StartedAt != nil || p.EndedAt != nil
+}
+
+// isSessionTimeError reports whether err came from validateSessionTimes.
+func isSessionTimeError(err error) bool {
+	for _, target := range []error{
+		ErrSessionEndWithoutStart, ErrSessionTooOld, ErrSessionInFuture, ErrSessionEndBeforeStart, ErrSessionTooLong,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRepSession applies a patch to one of the user's sessions and logs the revision.
+// It returns pgx.ErrNoRows when the session doesn't exist or isn't theirs.
+//
+// The rep count and times of a device-counted session only change with force, and doing so
+// turns it into a manual session. Changing the count drops the per-rep events and form score,
+// which no longer describe the session. Count changes go through the anomaly checks again
+// and update the user's stats, so db should be a transaction.
+func updateRepSession(ctx context.Context, db dbQuerier, sessionID, userID int64, p sessionPatch, force bool, now time.Time) error {
+	const currentQ = `
+		SELECT reps, source, review_status, started_at, ended_at, device_reps, to_jsonb(rs)
+		FROM rep_sessions rs
+		WHERE id = $1
+		  AND user_id = $2
+		FOR UPDATE;
+	`
+
+	var (
+		cur          repRequest
+		reviewStatus string
+		startedAt    time.Time
+		before       []byte
+	)
+	err := db.QueryRow(ctx, currentQ, sessionID, userID).
+		Scan(&cur.Reps, &cur.Source, &reviewStatus, &startedAt, &cur.EndedAt, &cur.DeviceReps, &before)
+	if err != nil {
+		return err
+	}
+	cur.StartedAt = &startedAt
+
+	deviceCounted := isDeviceCountedSource(cur.Source)
+	repsChanged := p.Reps != nil && *p.Reps != cur.Reps
+	if p.changesCount() {
+		if reviewStatus == "rejected" {
+			return ErrSessionRejected
+		}
+		if deviceCounted && !force {
+			return ErrSessionDeviceCounted
+		}
+		if p.StartedAt != nil {
+			cur.StartedAt = p.StartedAt
+		}
+		if p.EndedAt != nil {
+			cur.EndedAt = p.EndedAt
+		}
+		if p.StartedAt != nil || p.EndedAt != nil {
+			if err := validateSessionTimes(cur.StartedAt, cur.EndedAt, now); err != nil {
+				return err
+			}
+		}
+		if p.Reps != nil {
+			cur.Reps = *p.Reps
+		}
+		if deviceCounted {
+			cur.Source = SourceManual
+		}
+	}
+
+	const updateQ = `
+		UPDATE rep_sessions
+		SET
+			reps = $3,
+			source = $4,
+			started_at = $5,
+			ended_at = $6,
+			scope = COALESCE($7, scope),
+			form_score = CASE WHEN $8::boolean THEN NULL ELSE form_score END,
+			quality_reps = CASE WHEN $8::boolean THEN NULL ELSE quality_reps END,
+			pace = CASE WHEN $9::boolean THEN NULLIF($10, '') ELSE pace END,
+			notes = CASE WHEN $11::boolean THEN NULLIF($12, '') ELSE notes END,
+			tags = CASE WHEN $13::boolean THEN $14::text[] ELSE tags END
+		WHERE id = $1
+		  AND user_id = $2;
+	`
+
+	var pace, notes string
+	if p.Pace != nil {
+		pace = *p.Pace
+	}
+	if p.Notes != nil {
+		notes = *p.Notes
+	}
+	tags := []string{}
+	if p.Tags != nil {
+		tags = *p.Tags
+	}
+
+	_, err = db.Exec(ctx, updateQ, sessionID, userID,
+		cur.Reps, cur.Source, cur.StartedAt, cur.EndedAt, p.Scope,
+		repsChanged,
+		p.Pace != nil, pace,
+		p.Notes != nil, notes,
+		p.Tags != nil, tags,
+	)
+	if err != nil {
+		return err
+	}
+
+	if repsChanged {
+		if _, err := db.Exec(ctx, `DELETE FROM rep_events WHERE session_id = $1;`, sessionID); err != nil {
+			return err
+		}
+	}
+	if p.changesCount() {
+		if !repsChanged {
+			if cur.RepEvents, err = loadRepEvents(ctx, db, sessionID); err != nil {
+				return err
+			}
+		}
+		if _, err := checkSessionAnomalies(ctx, db, userID, sessionID, cur); err != nil {
+			return err
+		}
+	}
+	// The rollup is split by scope, so a session changing scope moves too.
+	if p.changesCount() || p.Scope != nil {
+		if err := refreshUserStats(ctx, db, userID, startedAt, *cur.StartedAt); err != nil {
+			return err
+		}
+	}
+
+	after, err := sessionSnapshot(ctx, db, sessionID)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	return recordSessionRevision(ctx, db, sessionID, userID, userID, RevisionUpdate, before, after)
+}
+
+// deleteRepSession removes one of the user's sessions, logs its last state and updates
+// the user's stats, so db should be a transaction.
+// It returns pgx.ErrNoRows when the session doesn't exist or isn't theirs,
+// and ErrSessionDeviceCounted for a device-counted session without force.
+func deleteRepSession(ctx context.Context, db dbQuerier, sessionID, userID int64, force bool) error {
+	const currentQ = `
+		SELECT source, started_at, to_jsonb(rs)
+		FROM rep_sessions rs
+		WHERE id = $1
+		  AND user_id = $2
+		FOR UPDATE;
+	`
+
+	var source string
+	var startedAt time.Time
+	var before []byte
+	if err := db.QueryRow(ctx, currentQ, sessionID, userID).Scan(&source, &startedAt, &before); err != nil {
+		return err
+	}
+	if isDeviceCountedSource(source) && !force {
+		return ErrSessionDeviceCounted
+	}
+
+	if _, err := db.Exec(ctx, `DELETE FROM rep_sessions WHERE id = $1;`, sessionID); err != nil {
+		return err
+	}
+	if err := refreshUserStats(ctx, db, userID, startedAt); err != nil {
+		return err
+	}
+
+	return recordSessionRevision(ctx, db, sessionID, userID, userID, RevisionDelete, before, nil)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSessionAnnotations(t *testing.T) {
+	got := normalizeSessionAnnotations(sessionAnnotations{
+		Pace:  " Slow ",
+		Notes: "  held top plank before beginning\n",
+		Tags:  []string{"Plank", " morning", "plank", ""},
+	})
+
+	want := sessionAnnotations{
+		Pace:  "slow",
+		Notes: "held top plank before beginning",
+		Tags:  []string{"plank", "morning"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if err := validateSessionAnnotations(got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateSessionAnnotations(t *testing.T) {
+	manyTags := make([]string, maxSessionTags+1)
+	for i := range manyTags {
+		manyTags[i] = "t" + strings.Repeat("x", i)
+	}
+
+	cases := []struct {
+		name string
+		in   sessionAnnotations
+		want error
+	}{
+		{"empty", sessionAnnotations{}, nil},
+		{"pace", sessionAnnotations{Pace: "sprint"}, ErrPaceInvalid},
+		{"notes", sessionAnnotations{Notes: strings.Repeat("a", maxSessionNotesLen+1)}, ErrNotesTooLong},
+		{"tag chars", sessionAnnotations{Tags: []string{"two words"}}, ErrTagsInvalid},
+		{"tag count", sessionAnnotations{Tags: manyTags}, ErrTagsInvalid},
+	}
+	for _, tc := range cases {
+		if err := validateSessionAnnotations(tc.in); err != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestSessionCursorRoundTrip(t *testing.T) {
+	c := sessionCursor{StartedAt: time.Date(2026, 3, 14, 7, 30, 5, 123456000, time.UTC), ID: 42}
+
+	got, err := parseSessionCursor(c.String())
+	if err != nil {
+		t.Fatalf("parse %q: %v", c.String(), err)
+	}
+	if !got.StartedAt.Equal(c.StartedAt) || got.ID != c.ID {
+		t.Fatalf("got %+v, want %+v", got, c)
+	}
+
+	for _, bad := range []string{"", "42", "abc.1", "1700000000000000.x", "1700000000000000.0"} {
+		if _, err := parseSessionCursor(bad); err != ErrSessionCursorInvalid {
+			t.Errorf("parseSessionCursor(%q) = %v; want ErrSessionCursorInvalid", bad, err)
+		}
+	}
+}
+
+func TestParseDateBound(t *testing.T) {
+	from, err := parseDateBound("2026-03-14", false, time.UTC)
+	if err != nil || !from.Equal(time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("from date: %v, %v", from, err)
+	}
+
+	// A bare upper date includes the whole day.
+	to, err := parseDateBound("2026-03-14", true, time.UTC)
+	if err != nil || !to.Equal(time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("to date: %v, %v", to, err)
+	}
+
+	ts, err := parseDateBound("2026-03-14T10:00:00+02:00", true, time.UTC)
+	if err != nil || !ts.Equal(time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("timestamp: %v, %v", ts, err)
+	}
+
+	// Dates are the viewer's local days: the day the clocks go forward in New York
+	// is 23 hours long.
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err = parseDateBound("2026-03-08", false, ny)
+	if err != nil || !from.Equal(time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC)) {
+		t.Fatalf("local from date: %v, %v", from, err)
+	}
+	to, err = parseDateBound("2026-03-08", true, ny)
+	if err != nil || !to.Equal(time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC)) {
+		t.Fatalf("local to date: %v, %v", to, err)
+	}
+
+	if b, err := parseDateBound("", true, time.UTC); b != nil || err != nil {
+		t.Fatalf("empty: %v, %v", b, err)
+	}
+	if _, err := parseDateBound("14/03/2026", false, time.UTC); err == nil {
+		t.Fatal("expected an error for a non-ISO date")
+	}
+}
+
+func TestSessionPatchChangesCount(t *testing.T) {
+	reps := 12
+	notes := "felt strong"
+	if (sessionPatch{Notes: &notes}).changesCount() {
+		t.Fatal("an annotation-only patch must not count as a count change")
+	}
+	if !(sessionPatch{Reps: &reps}).changesCount() {
+		t.Fatal("a reps patch changes the count")
+	}
+	if !isDeviceCountedSource(SourceServerDetected) || !isDeviceCountedSource(SourceDevice) || isDeviceCountedSource(SourceManual) {
+		t.Fatal("only device and server-detected sessions are device-counted")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Session sources say where a rep count came from.
+const (
+	SourceDevice         = "device"          // counted on the device and submitted with its token
+	SourceManual         = "manual"          // typed in by the user
+	SourceImport         = "import"          // backfilled from another app or a file
+	SourceServerDetected = "server-detected" // counted by the server from raw sensor data
+)
+
+// Session scopes say who can see a session.
+const (
+	ScopePublic  = "public"  // everyone: global and friends leaderboards, any profile viewer
+	ScopeFriends = "friends" // the owner and their friends; not on the global leaderboard
+	ScopePrivate = "private" // only the owner; on no leaderboard
+)
+
+var (
+	sessionSources = []string{SourceDevice, SourceManual, SourceImport, SourceServerDetected}
+	sessionScopes  = []string{ScopePublic, ScopeFriends, ScopePrivate}
+)
+
+// validationError is a rejected field, returned to clients as JSON so they can
+// tell which value was wrong and what would have been accepted.
+type validationError struct {
+	Field   string   `json:"field"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+func (e *validationError) Error() string { return e.Message }
+
+var (
+	ErrSourceInvalid = &validationError{
+		Field:   "source",
+		Code:    "invalid_source",
+		Message: "source must be one of device, manual, import, server-detected",
+		Allowed: sessionSources,
+	}
+	ErrSourceNotAllowed = &validationError{
+		Field:   "source",
+		Code:    "source_not_allowed",
+		Message: "device requires a device token and server-detected requires a raw upload",
+	}
+	ErrScopeInvalid = &validationError{
+		Field:   "scope",
+		Code:    "invalid_scope",
+		Message: "scope must be one of public, friends, private",
+		Allowed: sessionScopes,
+	}
+)
+
+// normalizeSessionSource resolves the submitted source for a /api/reps submission.
+// An empty source defaults to device for token submissions and manual otherwise.
+func normalizeSessionSource(source string, fromDevice bool) (string, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	switch source {
+	case "":
+		if fromDevice {
+			return SourceDevice, nil
+		}
+		return SourceManual, nil
+	case SourceDevice:
+		if !fromDevice {
+			return "", ErrSourceNotAllowed
+		}
+		return source, nil
+	case SourceManual, SourceImport:
+		return source, nil
+	case SourceServerDetected:
+		return "", ErrSourceNotAllowed
+	default:
+		return "", ErrSourceInvalid
+	}
+}
+
+// normalizeSessionScope defaults to public, which is how sessions behaved before scopes meant anything.
+func normalizeSessionScope(scope string) (string, error) {
+	scope = strings.ToLower(strings.TrimSpace(scope))
+	if scope == "" {
+		return ScopePublic, nil
+	}
+	for _, s := range sessionScopes {
+		if scope == s {
+			return scope, nil
+		}
+	}
+	return "", ErrScopeInvalid
+}
+
+func isSessionSource(source string) bool {
+	for _, s := range sessionSources {
+		if source == s {
+			return true
+		}
+	}
+	return false
+}
+
+// provenanceTotals breaks a rep total down by provenance, the rep_sessions column
+// derived from the source (see migration 00014).
+type provenanceTotals struct {
+	Manual         int64 `json:"manual"`
+	DeviceReported int64 `json:"deviceReported"`
+	ServerVerified int64 `json:"serverVerified"`
+}
+
+var ErrVerifiedInvalid = &validationError{
+	Field:   "verified",
+	Code:    "invalid_verified",
+	Message: "verified must be true or false",
+	Allowed: []string{"true", "false"},
+}
+
+// parseVerifiedFilter reads ?verified=. true limits totals to server-verified sessions.
+func parseVerifiedFilter(raw string) (bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false, nil
+	}
+	verified, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, ErrVerifiedInvalid
+	}
+	return verified, nil
+}
+
+// isDeviceCountedSource reports whether a session's count came from a device, its own or
+// the server's count of its sensor data, rather than a person. Such sessions can only be
+// edited or deleted with ?force=true.
+func isDeviceCountedSource(source string) bool {
+	return source == SourceDevice || source == SourceServerDetected
+}
+
+// parseSourceFilter reads a comma-separated ?source= filter. nil means no filter.
+func parseSourceFilter(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if !isSessionSource(part) {
+			return nil, ErrSourceInvalid
+		}
+		out = append(out, part)
+	}
+	return out, nil
+}
+
+// writeRequestError sends a validationError as JSON and anything else as plain text, both with 400.
+func writeRequestError(w http.ResponseWriter, err error) {
+	writeRequestErrorStatus(w, http.StatusBadRequest, err)
+}
+
+// writeRequestErrorStatus is writeRequestError with another status, such as 422 for a
+// well-formed request the server can't act on.
+func writeRequestErrorStatus(w http.ResponseWriter, status int, err error) {
+	var ve *validationError
+	if !errors.As(err, &ve) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": ve})
+}
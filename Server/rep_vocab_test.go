@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSessionSource(t *testing.T) {
+	cases := []struct {
+		source     string
+		fromDevice bool
+		want       string
+		err        error
+	}{
+		{"", true, SourceDevice, nil},
+		{"", false, SourceManual, nil},
+		{" Manual ", true, SourceManual, nil},
+		{"import", false, SourceImport, nil},
+		{"device", false, "", ErrSourceNotAllowed},
+		{"server-detected", true, "", ErrSourceNotAllowed},
+		{"esp32", true, "", ErrSourceInvalid},
+	}
+	for _, tc := range cases {
+		got, err := normalizeSessionSource(tc.source, tc.fromDevice)
+		if got != tc.want || err != tc.err {
+			t.Errorf("normalizeSessionSource(%q, %v) = %q, %v; want %q, %v", tc.source, tc.fromDevice, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestNormalizeSessionScope(t *testing.T) {
+	if got, err := normalizeSessionScope(""); got != ScopePublic || err != nil {
+		t.Fatalf("empty scope: %q, %v", got, err)
+	}
+	if got, err := normalizeSessionScope("Friends"); got != ScopeFriends || err != nil {
+		t.Fatalf("friends scope: %q, %v", got, err)
+	}
+	// The leaderboard's scope=global is a different thing and isn't a session scope.
+	if _, err := normalizeSessionScope("global"); err != ErrScopeInvalid {
+		t.Fatalf("expected ErrScopeInvalid, got %v", err)
+	}
+}
+
+func TestParseSourceFilter(t *testing.T) {
+	got, err := parseSourceFilter("device, server-detected")
+	if err != nil || !reflect.DeepEqual(got, []string{SourceDevice, SourceServerDetected}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if got, err := parseSourceFilter(""); got != nil || err != nil {
+		t.Fatalf("empty filter: %v, %v", got, err)
+	}
+	if _, err := parseSourceFilter("device,web"); err != ErrSourceInvalid {
+		t.Fatalf("expected ErrSourceInvalid, got %v", err)
+	}
+}
+
+func TestWriteRequestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeRequestError(rec, ErrSourceInvalid)
+
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var body struct {
+		Error validationError `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error.Field != "source" || body.Error.Code != "invalid_source" || len(body.Error.Allowed) != 4 {
+		t.Fatalf("unexpected error body: %+v", body.Error)
+	}
+
+	rec = httptest.NewRecorder()
+	writeRequestError(rec, errors.New("invalid reps"))
+	if rec.Code != http.StatusBadRequest || rec.Body.String() != "invalid reps\n" {
+		t.Fatalf("plain errors should stay text, got %q", rec.Body.String())
+	}
+}
+
+func TestRepBatchResultInvalid(t *testing.T) {
+	var res repBatchResult
+	res.invalid(ErrScopeInvalid)
+	if res.Status != "invalid" || res.Field != "scope" || res.Code != "invalid_scope" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestParseVerifiedFilter(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want bool
+		err  error
+	}{
+		{"", false, nil},
+		{"true", true, nil},
+		{" 1 ", true, nil},
+		{"false", false, nil},
+		{"yes", false, ErrVerifiedInvalid},
+	}
+	for _, tc := range cases {
+		got, err := parseVerifiedFilter(tc.raw)
+		if got != tc.want || err != tc.err {
+			t.Errorf("parseVerifiedFilter(%q) = %v, %v; want %v, %v", tc.raw, got, err, tc.want, tc.err)
+		}
+	}
+}
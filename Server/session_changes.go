@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// sessionChange says a user's stored sessions changed, so any board they appear on may have too.
+type sessionChange struct {
+	UserID    int64
+	SessionID int64
+}
+
+// sessionChangeBus carries sessionChanges to whoever is streaming leaderboards.
+// The in-process bus only reaches subscribers on the same server; running several
+// replicas needs an implementation over Postgres LISTEN/NOTIFY with the same methods.
+type sessionChangeBus interface {
+	Publish(change sessionChange)
+	Subscribe() *sessionSubscription
+	Unsubscribe(sub *sessionSubscription)
+}
+
+const sessionSubscriptionBuffer = 64
+
+// sessionSubscription receives changes on C. Publishing never blocks: when C is full the
+// change is dropped and Lagged is set, and the subscriber should assume anything changed.
+type sessionSubscription struct {
+	C      chan sessionChange
+	Lagged atomic.Bool
+}
+
+// sessionChanges is the bus the handlers publish to after committing.
+var sessionChanges sessionChangeBus = newLocalSessionBus()
+
+// notifySessionChange publishes a committed change. Call it only after the transaction
+// commits, or subscribers may reload before the change is visible.
+func notifySessionChange(userID, sessionID int64) {
+	sessionChanges.Publish(sessionChange{UserID: userID, SessionID: sessionID})
+}
+
+type localSessionBus struct {
+	mu   sync.Mutex
+	subs map[*sessionSubscription]struct{}
+}
+
+func newLocalSessionBus() *localSessionBus {
+	return &localSessionBus{subs: map[*sessionSubscription]struct{}{}}
+}
+
+func (b *localSessionBus) Publish(change sessionChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.C <- change:
+		default:
+			sub.Lagged.Store(true)
+		}
+	}
+}
+
+func (b *localSessionBus) Subscribe() *sessionSubscription {
+	sub := &sessionSubscription{C: make(chan sessionChange, sessionSubscriptionBuffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *localSessionBus) Unsubscribe(sub *sessionSubscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
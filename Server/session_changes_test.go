@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestLocalSessionBus(t *testing.T) {
+	bus := newLocalSessionBus()
+	a := bus.Subscribe()
+	b := bus.Subscribe()
+
+	bus.Publish(sessionChange{UserID: 1, SessionID: 10})
+	if got := <-a.C; got.UserID != 1 || got.SessionID != 10 {
+		t.Fatalf("a got %+v", got)
+	}
+	if got := <-b.C; got.UserID != 1 {
+		t.Fatalf("b got %+v", got)
+	}
+
+	bus.Unsubscribe(b)
+	bus.Publish(sessionChange{UserID: 2})
+	if len(b.C) != 0 {
+		t.Fatal("unsubscribed subscriber still receives changes")
+	}
+	<-a.C
+
+	// A subscriber that stops reading never blocks the publisher; it is marked lagged instead.
+	for i := 0; i < sessionSubscriptionBuffer+5; i++ {
+		bus.Publish(sessionChange{UserID: int64(i)})
+	}
+	if len(a.C) != sessionSubscriptionBuffer || !a.Lagged.Load() {
+		t.Fatalf("buffered %d, lagged %v", len(a.C), a.Lagged.Load())
+	}
+}
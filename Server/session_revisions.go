@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Revision actions stored in session_revisions.action.
+const (
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+	RevisionReview = "review"
+)
+
+// sessionRevision is one audited change to a rep session. Before and After are the whole
+// rep_sessions row as JSON; Before is null for a create and After is null for a delete.
+type sessionRevision struct {
+	ID        int64           `json:"id"`
+	SessionID int64           `json:"sessionId"`
+	ActorID   *int64          `json:"actorId"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// sessionSnapshot returns the session row as JSON for the revision log.
+func sessionSnapshot(ctx context.Context, db dbQuerier, sessionID int64) ([]byte, error) {
+	const q = `
+		SELECT to_jsonb(rs)
+		FROM rep_sessions rs
+		WHERE rs.id = $1;
+	`
+
+	var snapshot []byte
+	err := db.QueryRow(ctx, q, sessionID).Scan(&snapshot)
+	return snapshot, err
+}
+
+// recordSessionRevision appends to the revision log. It should run in the same transaction
+// as the change so the log can't disagree with the table.
+func recordSessionRevision(ctx context.Context, db dbQuerier, sessionID, ownerID, actorID int64, action string, before, after []byte) error {
+	const q = `
+		INSERT INTO session_revisions (session_id, owner_user_id, actor_user_id, action, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	_, err := db.Exec(ctx, q, sessionID, ownerID, actorID, action, nullJSON(before), nullJSON(after))
+	return err
+}
+
+// loadSessionRevisions lists a session's revisions, oldest first. The owner and admins can see them,
+// even after the session is deleted; anyone else gets an empty list.
+func loadSessionRevisions(ctx context.Context, db dbQuerier, sessionID, viewerID int64) ([]sessionRevision, error) {
+	const q = `
+		SELECT sr.id, sr.session_id, sr.actor_user_id, sr.action, sr.before, sr.after, sr.created_at
+		FROM session_revisions sr
+		WHERE sr.session_id = $1
+		  AND (
+			sr.owner_user_id = $2
+			OR EXISTS (SELECT 1 FROM users u WHERE u.id = $2 AND u.is_admin)
+		  )
+		ORDER BY sr.id ASC;
+	`
+
+	rows, err := db.Query(ctx, q, sessionID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]sessionRevision, 0)
+	for rows.Next() {
+		var rev sessionRevision
+		var before, after []byte
+		if err := rows.Scan(&rev.ID, &rev.SessionID, &rev.ActorID, &rev.Action, &before, &after, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		rev.Before = nullJSON(before)
+		rev.After = nullJSON(after)
+		rev.CreatedAt = rev.CreatedAt.UTC()
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// nullJSON maps a missing snapshot to SQL/JSON null instead of an empty document.
+func nullJSON(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	return json.RawMessage(b)
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// user_daily_reps rolls the sessions that count (neither flagged nor rejected) up into
+// reps per user per local calendar day, split by source and scope. user_stats holds each
+// user's lifetime totals and streaks once per filter a leaderboard or profile can ask
+// for. Both change in the transaction that changes rep_sessions: the changed days are
+// recounted and the stats moved forward from them, so leaderboards and profiles read
+// them instead of rescanning every session.
+
+// sourceMask is a set of session sources, one bit per entry of sessionSources in order.
+type sourceMask int16
+
+// allSources is every source in sessionSources.
+const allSources sourceMask = 1<<4 - 1
+
+func sourceBit(source string) sourceMask {
+	i := slices.Index(sessionSources, source)
+	if i < 0 {
+		return 0
+	}
+	return 1 << i
+}
+
+// sourceMaskOf is the sources a ?source= and ?verified= filter counts. It is empty when
+// the filters exclude each other.
+func sourceMaskOf(sources []string, verifiedOnly bool) sourceMask {
+	mask := allSources
+	if sources != nil {
+		mask = 0
+		for _, s := range sources {
+			mask |= sourceBit(s)
+		}
+	}
+	if verifiedOnly {
+		mask &= sourceBit(SourceServerDetected)
+	}
+	return mask
+}
+
+// sources lists the mask's sources in vocabulary order.
+func (m sourceMask) sources() []string {
+	out := make([]string, 0, len(sessionSources))
+	for _, s := range sessionSources {
+		if m&sourceBit(s) != 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// statsKey picks the sessions a user_stats row counts: those in Scope or a more public
+// scope, from Sources.
+type statsKey struct {
+	Scope   string
+	Sources sourceMask
+}
+
+// visibleScopes are the session scopes a key counts, most public first.
+func (k statsKey) visibleScopes() []string {
+	return sessionScopes[:slices.Index(sessionScopes, k.Scope)+1]
+}
+
+func (k statsKey) counts(r dailyReps) bool {
+	return slices.Contains(k.visibleScopes(), r.Scope) && k.Sources&sourceBit(r.Source) != 0
+}
+
+// allStatsKeys is every key user_stats may hold a row for.
+func allStatsKeys() []statsKey {
+	keys := make([]statsKey, 0, len(sessionScopes)*int(allSources))
+	for _, scope := range sessionScopes {
+		for m := sourceMask(1); m <= allSources; m++ {
+			keys = append(keys, statsKey{Scope: scope, Sources: m})
+		}
+	}
+	return keys
+}
+
+// dailyReps is one user_daily_reps row.
+type dailyReps struct {
+	Day         time.Time
+	Source      string
+	Scope       string
+	Reps        int
+	QualityReps int
+}
+
+// userStats is one row of user_stats. CurrentStreak is the run of consecutive days
+// ending at LastActiveDay; readers only count it while that day is the user's today.
+type userStats struct {
+	CurrentStreak int
+	LongestStreak int
+	LastActiveDay *time.Time
+
+	LifetimeReps        int64
+	LifetimeQualityReps int64
+	LifetimeProvenance  provenanceTotals
+}
+
+// streakOn is the current streak as of today, the user's local date at midnight UTC.
+func (s userStats) streakOn(today time.Time) int {
+	if s.LastActiveDay == nil || !s.LastActiveDay.Equal(today) {
+		return 0
+	}
+	return s.CurrentStreak
+}
+
+// add counts a rollup row into the lifetime totals, or out of them with sign -1.
+func (s *userStats) add(r dailyReps, sign int64) {
+	reps := sign * int64(r.Reps)
+	s.LifetimeReps += reps
+	s.LifetimeQualityReps += sign * int64(r.QualityReps)
+	switch r.Source {
+	case SourceServerDetected:
+		s.LifetimeProvenance.ServerVerified += reps
+	case SourceDevice:
+		s.LifetimeProvenance.DeviceReported += reps
+	default:
+		s.LifetimeProvenance.Manual += reps
+	}
+}
+
+// withDay moves the streaks forward after day became active or stopped being. It
+// can't when the change is before the last active day or takes a day away, since
+// that may join or split runs it doesn't know about; ok is then false and the
+// streaks must be counted again from every day.
+func (s userStats) withDay(day time.Time, was, is bool) (next userStats, ok bool) {
+	switch {
+	case was == is:
+		return s, true
+	case was:
+		return s, false
+	case s.LastActiveDay == nil || day.After(*s.LastActiveDay):
+		if s.LastActiveDay != nil && day.Equal(s.LastActiveDay.AddDate(0, 0, 1)) {
+			s.CurrentStreak++
+		} else {
+			s.CurrentStreak = 1
+		}
+		s.LongestStreak = max(s.LongestStreak, s.CurrentStreak)
+		s.LastActiveDay = &day
+		return s, true
+	default:
+		return s, false
+	}
+}
+
+// localDate is t's calendar date in loc, at midnight UTC as a DATE scans.
+func localDate(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// summarizeUserDays derives a user's streaks from their distinct active days, oldest first.
+// Days are local dates at midnight UTC, as a DATE scans.
+func summarizeUserDays(days []time.Time) userStats {
+	var stats userStats
+	run := 0
+	for i, d := range days {
+		if i > 0 && d.Equal(days[i-1].AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		stats.LongestStreak = max(stats.LongestStreak, run)
+	}
+
+	if len(days) > 0 {
+		last := days[len(days)-1]
+		stats.LastActiveDay = &last
+		stats.CurrentStreak = run
+	}
+	return stats
+}
+
+// countUserStats derives one key's stats from all of a user's rollup rows.
+func countUserStats(rows []dailyReps, key statsKey) userStats {
+	var days []time.Time
+	var totals userStats
+	for _, r := range rows {
+		if !key.counts(r) {
+			continue
+		}
+		days = append(days, r.Day)
+		totals.add(r, 1)
+	}
+	slices.SortFunc(days, time.Time.Compare)
+	days = slices.CompactFunc(days, time.Time.Equal)
+
+	stats := summarizeUserDays(days)
+	stats.LifetimeReps = totals.LifetimeReps
+	stats.LifetimeQualityReps = totals.LifetimeQualityReps
+	stats.LifetimeProvenance = totals.LifetimeProvenance
+	return stats
+}
+
+// advanceUserStats applies the recount of days to a user's stats under every key.
+// before and after are the user's rollup rows on those days either side of the recount.
+// changed holds the keys whose stats moved; recount the keys whose streaks must be
+// counted again from every day (see withDay).
+func advanceUserStats(current map[statsKey]userStats, days []time.Time, before, after []dailyReps) (changed map[statsKey]userStats, recount []statsKey) {
+	days = slices.Clone(days)
+	slices.SortFunc(days, time.Time.Compare)
+	days = slices.CompactFunc(days, time.Time.Equal)
+
+	changed = make(map[statsKey]userStats)
+	for _, key := range allStatsKeys() {
+		stats := current[key]
+		ok := true
+		for _, d := range days {
+			was, is := false, false
+			for _, r := range before {
+				if r.Day.Equal(d) && key.counts(r) {
+					was = true
+					stats.add(r, -1)
+				}
+			}
+			for _, r := range after {
+				if r.Day.Equal(d) && key.counts(r) {
+					is = true
+					stats.add(r, 1)
+				}
+			}
+			if ok {
+				stats, ok = stats.withDay(d, was, is)
+			}
+		}
+
+		switch {
+		case !ok:
+			recount = append(recount, key)
+		case stats != current[key]:
+			changed[key] = stats
+		}
+	}
+	return changed, recount
+}
+
+// loadUserStats reads every user_stats row of a user.
+func loadUserStats(ctx context.Context, db dbQuerier, userID int64) (map[statsKey]userStats, error) {
+	const q = `
+		SELECT
+			scope,
+			sources,
+			lifetime_reps,
+			lifetime_quality_reps,
+			lifetime_manual_reps,
+			lifetime_device_reps,
+			lifetime_verified_reps,
+			current_streak,
+			longest_streak,
+			last_active_day
+		FROM user_stats
+		WHERE user_id = $1;
+	`
+
+	rows, err := db.Query(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[statsKey]userStats)
+	for rows.Next() {
+		var (
+			key     statsKey
+			sources int16
+			s       userStats
+		)
+		if err := rows.Scan(
+			&key.Scope,
+			&sources,
+			&s.LifetimeReps,
+			&s.LifetimeQualityReps,
+			&s.LifetimeProvenance.Manual,
+			&s.LifetimeProvenance.DeviceReported,
+			&s.LifetimeProvenance.ServerVerified,
+			&s.CurrentStreak,
+			&s.LongestStreak,
+			&s.LastActiveDay,
+		); err != nil {
+			return nil, err
+		}
+		key.Sources = sourceMask(sources)
+		out[key] = s
+	}
+	return out, rows.Err()
+}
+
+// loadDailyReps reads the given users' rollup rows on days, or on every day when days is nil.
+func loadDailyReps(ctx context.Context, db dbQuerier, userIDs []int64, days []time.Time) (map[int64][]dailyReps, error) {
+	const q = `
+		SELECT user_id, day, source, scope, reps, quality_reps
+		FROM user_daily_reps
+		WHERE user_id = ANY($1)
+		  AND ($2::date[] IS NULL OR day = ANY($2::date[]));
+	`
+
+	rows, err := db.Query(ctx, q, userIDs, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64][]dailyReps, len(userIDs))
+	for rows.Next() {
+		var userID int64
+		var r dailyReps
+		if err := rows.Scan(&userID, &r.Day, &r.Source, &r.Scope, &r.Reps, &r.QualityReps); err != nil {
+			return nil, err
+		}
+		out[userID] = append(out[userID], r)
+	}
+	return out, rows.Err()
+}
+
+// refreshUserStats brings a user's rollup up to date after their sessions changed, moved,
+// or were reviewed: the local days holding the changed sessions' old and new start times
+// are recounted from rep_sessions, and the stats are moved forward from what changed on
+// them. It should run in the transaction that made the change.
+func refreshUserStats(ctx context.Context, db dbQuerier, userID int64, changed ...time.Time) error {
+	if err := lockUserStats(ctx, db, []int64{userID}); err != nil {
+		return err
+	}
+
+	const daysQ = `
+		SELECT DISTINCT (t AT TIME ZONE COALESCE(u.time_zone, 'UTC'))::date
+		FROM unnest($2::timestamptz[]) t, users u
+		WHERE u.id = $1;
+	`
+	rows, err := db.Query(ctx, daysQ, userID, changed)
+	if err != nil {
+		return err
+	}
+	days, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return err
+	}
+	if len(days) == 0 {
+		return nil
+	}
+
+	before, err := loadDailyReps(ctx, db, []int64{userID}, days)
+	if err != nil {
+		return err
+	}
+
+	const recountQ = `
+		WITH tz AS (
+			SELECT COALESCE(time_zone, 'UTC') AS name
+			FROM users
+			WHERE id = $1
+		),
+		totals AS (
+			SELECT
+				d.day,
+				rs.source,
+				rs.scope,
+				SUM(rs.reps)::int AS reps,
+				COALESCE(SUM(rs.quality_reps), 0)::int AS quality_reps,
+				COUNT(*)::int AS sessions
+			FROM unnest($2::date[]) d(day)
+			CROSS JOIN tz
+			JOIN rep_sessions rs
+			  ON rs.user_id = $1
+			 AND rs.review_status NOT IN ('flagged', 'rejected')
+			 AND rs.started_at >= (d.day::timestamp AT TIME ZONE tz.name)
+			 AND rs.started_at < ((d.day + 1)::timestamp AT TIME ZONE tz.name)
+			GROUP BY d.day, rs.source, rs.scope
+		),
+		emptied AS (
+			DELETE FROM user_daily_reps udr
+			WHERE udr.user_id = $1
+			  AND udr.day = ANY($2::date[])
+			  AND NOT EXISTS (
+				SELECT 1
+				FROM totals t
+				WHERE t.day = udr.day
+				  AND t.source = udr.source
+				  AND t.scope = udr.scope
+			  )
+		)
+		INSERT INTO user_daily_reps (user_id, day, source, scope, reps, quality_reps, sessions)
+		SELECT $1, t.day, t.source, t.scope, t.reps, t.quality_reps, t.sessions
+		FROM totals t
+		ON CONFLICT (user_id, day, source, scope) DO UPDATE
+		SET reps = EXCLUDED.reps,
+		    quality_reps = EXCLUDED.quality_reps,
+		    sessions = EXCLUDED.sessions;
+	`
+	if _, err := db.Exec(ctx, recountQ, userID, days); err != nil {
+		return err
+	}
+
+	after, err := loadDailyReps(ctx, db, []int64{userID}, days)
+	if err != nil {
+		return err
+	}
+	current, err := loadUserStats(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+
+	next, recount := advanceUserStats(current, days, before[userID], after[userID])
+	if len(recount) > 0 {
+		// A past day was taken away or filled in: count those keys from every day.
+		history, err := loadDailyReps(ctx, db, []int64{userID}, nil)
+		if err != nil {
+			return err
+		}
+		for _, key := range recount {
+			if stats := countUserStats(history[userID], key); stats != current[key] {
+				next[key] = stats
+			}
+		}
+	}
+	return writeUserStats(ctx, db, userID, next)
+}
+
+// rebuildUserStats recounts every day of the given users from rep_sessions and their
+// stats from those days, as after a change of time zone or to repair the rollup.
+func rebuildUserStats(ctx context.Context, db dbQuerier, userIDs []int64) error {
+	if err := lockUserStats(ctx, db, userIDs); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(ctx, `DELETE FROM user_daily_reps WHERE user_id = ANY($1);`, userIDs); err != nil {
+		return err
+	}
+	if _, err := db.Exec(ctx, `DELETE FROM user_stats WHERE user_id = ANY($1);`, userIDs); err != nil {
+		return err
+	}
+
+	const q = `
+		INSERT INTO user_daily_reps (user_id, day, source, scope, reps, quality_reps, sessions)
+		SELECT
+			rs.user_id,
+			(rs.started_at AT TIME ZONE COALESCE(u.time_zone, 'UTC'))::date AS day,
+			rs.source,
+			rs.scope,
+			SUM(rs.reps)::int,
+			COALESCE(SUM(rs.quality_reps), 0)::int,
+			COUNT(*)::int
+		FROM rep_sessions rs
+		JOIN users u ON u.id = rs.user_id
+		WHERE rs.user_id = ANY($1)
+		  AND rs.review_status NOT IN ('flagged', 'rejected')
+		GROUP BY 1, 2, 3, 4;
+	`
+	if _, err := db.Exec(ctx, q, userIDs); err != nil {
+		return err
+	}
+
+	history, err := loadDailyReps(ctx, db, userIDs, nil)
+	if err != nil {
+		return err
+	}
+	for userID, rows := range history {
+		stats := make(map[statsKey]userStats)
+		for _, key := range allStatsKeys() {
+			if s := countUserStats(rows, key); s.LastActiveDay != nil {
+				stats[key] = s
+			}
+		}
+		if err := writeUserStats(ctx, db, userID, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockUserStats holds the users' rows for the rest of the transaction, so concurrent
+// changes for one user recount their days and move their stats one at a time.
+func lockUserStats(ctx context.Context, db dbQuerier, userIDs []int64) error {
+	const q = `
+		SELECT id
+		FROM users
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR NO KEY UPDATE;
+	`
+
+	_, err := db.Exec(ctx, q, userIDs)
+	return err
+}
+
+// writeUserStats stores a user's changed stats. A key left with no active day loses its row.
+func writeUserStats(ctx context.Context, db dbQuerier, userID int64, stats map[statsKey]userStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	var (
+		scopes, goneScopes   []string
+		sources, goneSources []int16
+		lifetime, quality    []int64
+		manual, device       []int64
+		verified             []int64
+		current, longest     []int
+		lastActive           []*time.Time
+	)
+	for key, s := range stats {
+		if s.LastActiveDay == nil {
+			goneScopes = append(goneScopes, key.Scope)
+			goneSources = append(goneSources, int16(key.Sources))
+			continue
+		}
+		scopes = append(scopes, key.Scope)
+		sources = append(sources, int16(key.Sources))
+		lifetime = append(lifetime, s.LifetimeReps)
+		quality = append(quality, s.LifetimeQualityReps)
+		manual = append(manual, s.LifetimeProvenance.Manual)
+		device = append(device, s.LifetimeProvenance.DeviceReported)
+		verified = append(verified, s.LifetimeProvenance.ServerVerified)
+		current = append(current, s.CurrentStreak)
+		longest = append(longest, s.LongestStreak)
+		lastActive = append(lastActive, s.LastActiveDay)
+	}
+
+	if len(goneScopes) > 0 {
+		const deleteQ = `
+			DELETE FROM user_stats us
+			USING unnest($2::text[], $3::smallint[]) AS gone(scope, sources)
+			WHERE us.user_id = $1
+			  AND us.scope = gone.scope
+			  AND us.sources = gone.sources;
+		`
+		if _, err := db.Exec(ctx, deleteQ, userID, goneScopes, goneSources); err != nil {
+			return err
+		}
+	}
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	const upsertQ = `
+		INSERT INTO user_stats (
+			user_id, scope, sources,
+			lifetime_reps, lifetime_quality_reps, lifetime_manual_reps, lifetime_device_reps, lifetime_verified_reps,
+			current_streak, longest_streak, last_active_day
+		)
+		SELECT $1, s.*
+		FROM unnest(
+			$2::text[], $3::smallint[],
+			$4::bigint[], $5::bigint[], $6::bigint[], $7::bigint[], $8::bigint[],
+			$9::int[], $10::int[], $11::date[]
+		) AS s
+		ON CONFLICT (user_id, scope, sources) DO UPDATE
+		SET
+			lifetime_reps = EXCLUDED.lifetime_reps,
+			lifetime_quality_reps = EXCLUDED.lifetime_quality_reps,
+			lifetime_manual_reps = EXCLUDED.lifetime_manual_reps,
+			lifetime_device_reps = EXCLUDED.lifetime_device_reps,
+			lifetime_verified_reps = EXCLUDED.lifetime_verified_reps,
+			current_streak = EXCLUDED.current_streak,
+			longest_streak = EXCLUDED.longest_streak,
+			last_active_day = EXCLUDED.last_active_day,
+			updated_at = now();
+	`
+	_, err := db.Exec(ctx, upsertQ, userID,
+		scopes, sources,
+		lifetime, quality, manual, device, verified,
+		current, longest, lastActive,
+	)
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestSummarizeUserDays(t *testing.T) {
+	days := []time.Time{
+		day("2026-02-26"),
+		day("2026-02-27"),
+		day("2026-02-28"),
+		day("2026-03-01"), // runs across the end of the month
+		day("2026-03-05"),
+		day("2026-03-06"),
+	}
+
+	got := summarizeUserDays(days)
+	if got.CurrentStreak != 2 || got.LongestStreak != 4 {
+		t.Fatalf("stats %+v", got)
+	}
+	if got.LastActiveDay == nil || !got.LastActiveDay.Equal(day("2026-03-06")) {
+		t.Fatalf("last active %v", got.LastActiveDay)
+	}
+
+	// The current run can be the longest.
+	got = summarizeUserDays(append(days, day("2026-03-07"), day("2026-03-08"), day("2026-03-09")))
+	if got.CurrentStreak != 5 || got.LongestStreak != 5 {
+		t.Fatalf("stats %+v", got)
+	}
+
+	if got := summarizeUserDays(nil); got != (userStats{}) {
+		t.Fatalf("no days: %+v", got)
+	}
+	if got := summarizeUserDays(days[4:5]); got.CurrentStreak != 1 || got.LongestStreak != 1 {
+		t.Fatalf("one day: %+v", got)
+	}
+}
+
+func TestUserStatsStreakOn(t *testing.T) {
+	stats := summarizeUserDays([]time.Time{day("2026-03-05"), day("2026-03-06")})
+	if got := stats.streakOn(day("2026-03-06")); got != 2 {
+		t.Fatalf("active today: streak %d", got)
+	}
+	// A run that ended yesterday is no longer a streak.
+	if got := stats.streakOn(day("2026-03-07")); got != 0 {
+		t.Fatalf("inactive today: streak %d", got)
+	}
+	if got := (userStats{}).streakOn(day("2026-03-06")); got != 0 {
+		t.Fatalf("no days: streak %d", got)
+	}
+
+	// Just after midnight UTC it is still the previous day in Los Angeles.
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 7, 2, 0, 0, 0, time.UTC)
+	if got := localDate(now, la); !got.Equal(day("2026-03-06")) {
+		t.Fatalf("local date %v", got)
+	}
+}
+
+func TestSourceMaskOf(t *testing.T) {
+	if got := sourceMaskOf(nil, false); got != allSources || len(got.sources()) != len(sessionSources) {
+		t.Fatalf("no filter: %b", got)
+	}
+	got := sourceMaskOf([]string{SourceServerDetected, SourceManual}, false)
+	if names := got.sources(); len(names) != 2 || names[0] != SourceManual || names[1] != SourceServerDetected {
+		t.Fatalf("sources %v", names)
+	}
+	if got := sourceMaskOf(nil, true); got != sourceBit(SourceServerDetected) {
+		t.Fatalf("verified: %b", got)
+	}
+	// Verified only and no server-detected source: nothing counts.
+	if got := sourceMaskOf([]string{SourceManual}, true); got != 0 {
+		t.Fatalf("exclusive filters: %b", got)
+	}
+}
+
+func TestStatsKeyCounts(t *testing.T) {
+	friendsOnly := dailyReps{Scope: ScopeFriends, Source: SourceDevice}
+	cases := []struct {
+		key  statsKey
+		want bool
+	}{
+		{statsKey{ScopePublic, allSources}, false},
+		{statsKey{ScopeFriends, allSources}, true},
+		{statsKey{ScopePrivate, allSources}, true},
+		{statsKey{ScopePrivate, sourceBit(SourceManual)}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.key.counts(friendsOnly); got != tc.want {
+			t.Fatalf("%+v: counts %v", tc.key, got)
+		}
+	}
+}
+
+func TestUserStatsWithDay(t *testing.T) {
+	stats := summarizeUserDays([]time.Time{day("2026-03-05"), day("2026-03-06")})
+
+	next, ok := stats.withDay(day("2026-03-07"), false, true)
+	if !ok || next.CurrentStreak != 3 || next.LongestStreak != 3 || !next.LastActiveDay.Equal(day("2026-03-07")) {
+		t.Fatalf("next day: %+v %v", next, ok)
+	}
+	next, ok = stats.withDay(day("2026-03-09"), false, true)
+	if !ok || next.CurrentStreak != 1 || next.LongestStreak != 2 {
+		t.Fatalf("after a gap: %+v %v", next, ok)
+	}
+	if next, ok = stats.withDay(day("2026-03-06"), true, true); !ok || next != stats {
+		t.Fatalf("more reps on an active day: %+v %v", next, ok)
+	}
+
+	// Days taken away or filled in behind the last active day need every day.
+	if _, ok := stats.withDay(day("2026-03-06"), true, false); ok {
+		t.Fatal("removed day moved forward")
+	}
+	if _, ok := stats.withDay(day("2026-03-01"), false, true); ok {
+		t.Fatal("backfilled day moved forward")
+	}
+}
+
+func TestAdvanceUserStats(t *testing.T) {
+	history := []dailyReps{
+		{Day: day("2026-03-05"), Source: SourceDevice, Scope: ScopePublic, Reps: 20, QualityReps: 15},
+		{Day: day("2026-03-06"), Source: SourceManual, Scope: ScopeFriends, Reps: 10},
+	}
+	current := make(map[statsKey]userStats)
+	for _, key := range allStatsKeys() {
+		if s := countUserStats(history, key); s.LastActiveDay != nil {
+			current[key] = s
+		}
+	}
+
+	// A new public device set today moves every key that counts it forward.
+	added := dailyReps{Day: day("2026-03-07"), Source: SourceDevice, Scope: ScopePublic, Reps: 30, QualityReps: 30}
+	changed, recount := advanceUserStats(current, []time.Time{added.Day}, nil, []dailyReps{added})
+	if len(recount) != 0 {
+		t.Fatalf("recount %v", recount)
+	}
+	all := append(slices.Clone(history), added)
+	for _, key := range allStatsKeys() {
+		want := countUserStats(all, key)
+		got, ok := changed[key]
+		if !ok {
+			got = current[key]
+		}
+		if got.CurrentStreak != want.CurrentStreak || got.LongestStreak != want.LongestStreak ||
+			got.LifetimeReps != want.LifetimeReps || got.LifetimeQualityReps != want.LifetimeQualityReps ||
+			got.LifetimeProvenance != want.LifetimeProvenance {
+			t.Fatalf("%+v: got %+v; want %+v", key, got, want)
+		}
+	}
+	public := changed[statsKey{ScopePublic, allSources}]
+	if public.CurrentStreak != 1 || public.LifetimeReps != 50 || public.LifetimeProvenance.DeviceReported != 50 {
+		t.Fatalf("public: %+v", public)
+	}
+	if owner := changed[statsKey{ScopePrivate, allSources}]; owner.CurrentStreak != 3 || owner.LifetimeReps != 60 {
+		t.Fatalf("owner: %+v", owner)
+	}
+	if _, ok := changed[statsKey{ScopePrivate, sourceBit(SourceManual)}]; ok {
+		t.Fatal("manual-only stats changed")
+	}
+
+	// More reps on a day that was already active change only the totals.
+	more := history[1]
+	more.Reps = 25
+	changed, recount = advanceUserStats(current, []time.Time{more.Day}, history[1:], []dailyReps{more})
+	if len(recount) != 0 {
+		t.Fatalf("recount %v", recount)
+	}
+	if owner := changed[statsKey{ScopePrivate, allSources}]; owner.CurrentStreak != 2 || owner.LifetimeReps != 45 {
+		t.Fatalf("owner: %+v", owner)
+	}
+
+	// Deleting a day's only session needs the history for every key that counted it.
+	_, recount = advanceUserStats(current, []time.Time{day("2026-03-05")}, history[:1], nil)
+	for _, key := range recount {
+		if !key.counts(history[0]) {
+			t.Fatalf("recounts %+v, which never counted the day", key)
+		}
+	}
+	if len(recount) == 0 {
+		t.Fatal("deleted day moved forward")
+	}
+}
@@ -0,0 +1,71 @@
+import argparse
+import json
+import os
+
+
+def _export_pipeline(model, features):
+    try:
+        from sklearn.linear_model import LogisticRegression
+        from sklearn.pipeline import Pipeline
+        from sklearn.preprocessing import StandardScaler
+    except Exception as exc:
+        raise SystemExit(
+            "scikit-learn is required. Install with: pip install scikit-learn"
+        ) from exc
+
+    if not isinstance(model, Pipeline):
+        raise SystemExit("Expected the Pipeline saved by train_model.py.")
+
+    steps = dict(model.named_steps)
+    scaler = steps.get("scaler")
+    clf = steps.get("model")
+    if not isinstance(scaler, StandardScaler) or not isinstance(clf, LogisticRegression):
+        raise SystemExit("Only StandardScaler + LogisticRegression pipelines can be exported.")
+    if len(clf.classes_) != 2:
+        raise SystemExit("Only binary classifiers can be exported.")
+    if len(features) != clf.coef_.shape[1]:
+        raise SystemExit(
+            f"Feature list has {len(features)} columns but the model expects {clf.coef_.shape[1]}."
+        )
+
+    return {
+        "format": "standard_scaler+logistic_regression",
+        "version": 1,
+        "features": list(features),
+        "classes": [int(c) for c in clf.classes_],
+        "scaler_mean": [float(v) for v in scaler.mean_],
+        "scaler_scale": [float(v) for v in scaler.scale_],
+        "coef": [float(v) for v in clf.coef_[0]],
+        "intercept": float(clf.intercept_[0]),
+    }
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Export the trained model to JSON for the Go server.")
+    parser.add_argument("--model", default="data/data_processing/processed/model.joblib")
+    parser.add_argument("--features", default="data/data_processing/processed/model_features.json")
+    parser.add_argument("--out", default="data/data_processing/processed/model.json")
+    args = parser.parse_args()
+
+    try:
+        import joblib
+    except Exception as exc:
+        raise SystemExit(
+            "joblib is required (usually installed with scikit-learn)."
+        ) from exc
+
+    with open(args.features, "r", encoding="utf-8") as f:
+        features = json.load(f)
+
+    model = joblib.load(args.model)
+    exported = _export_pipeline(model, features)
+
+    os.makedirs(os.path.dirname(args.out), exist_ok=True)
+    with open(args.out, "w", encoding="utf-8") as f:
+        json.dump(exported, f, indent=2)
+
+    print(f"Wrote model export to {args.out}")
+
+
+if __name__ == "__main__":
+    main()
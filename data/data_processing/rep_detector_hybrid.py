@@ -110,6 +110,8 @@ def main():
     parser.add_argument("--features", default="data/data_processing/processed/model_features.json")
     parser.add_argument("--out-events", default="data/data_processing/processed/rep_events_hybrid.csv")
     parser.add_argument("--out-report", default="data/data_processing/processed/rep_report_hybrid.md")
+    parser.add_argument("--out-windows", default="data/data_processing/processed/window_predictions.csv",
+                        help="Per-window probabilities used to gate peak detection.")
     parser.add_argument("--threshold", type=float, default=0.5)
     parser.add_argument("--min-depth-mm", type=float, default=80.0)
     parser.add_argument("--min-interval-s", type=float, default=0.6)
@@ -141,6 +143,11 @@ def main():
     windows["pred_prob"] = probs
     windows["pred_label"] = (windows["pred_prob"] >= args.threshold).astype(int)
 
+    os.makedirs(os.path.dirname(args.out_windows), exist_ok=True)
+    windows[["session_id", "segment_id", "window_start_s", "window_end_s", "pred_prob", "pred_label"]].to_csv(
+        args.out_windows, index=False
+    )
+
     events_rows = []
     report_lines = ["# Hybrid Rep Detection Report", ""]
 
@@ -204,6 +211,7 @@ def main():
 
     print(f"Wrote rep events to {args.out_events}")
     print(f"Wrote report to {args.out_report}")
+    print(f"Wrote window predictions to {args.out_windows}")
 
 
 if __name__ == "__main__":